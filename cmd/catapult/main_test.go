@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/itcaat/catapult/internal/config"
 	"github.com/itcaat/catapult/internal/repository"
@@ -45,6 +46,16 @@ func (m *MockRepository) UpdateFile(ctx context.Context, path, content string) e
 	return args.Error(0)
 }
 
+func (m *MockRepository) PutFile(ctx context.Context, path, content, mode string) error {
+	args := m.Called(ctx, path, content, mode)
+	return args.Error(0)
+}
+
+func (m *MockRepository) MoveFile(ctx context.Context, oldPath, newPath, content, mode string) error {
+	args := m.Called(ctx, oldPath, newPath, content, mode)
+	return args.Error(0)
+}
+
 func (m *MockRepository) DeleteFile(ctx context.Context, path string) error {
 	args := m.Called(ctx, path)
 	return args.Error(0)
@@ -65,6 +76,46 @@ func (m *MockRepository) GetAllFilesWithContent(ctx context.Context) (map[string
 	return args.Get(0).(map[string]*repository.RemoteFileInfo), args.Error(1)
 }
 
+func (m *MockRepository) GetFileHistory(ctx context.Context, path string, limit int) ([]repository.FileRevision, error) {
+	args := m.Called(ctx, path, limit)
+	revisions, _ := args.Get(0).([]repository.FileRevision)
+	return revisions, args.Error(1)
+}
+
+func (m *MockRepository) GetFileAt(ctx context.Context, path, ref string) (*repository.RemoteFileInfo, error) {
+	args := m.Called(ctx, path, ref)
+	file, _ := args.Get(0).(*repository.RemoteFileInfo)
+	return file, args.Error(1)
+}
+
+func (m *MockRepository) GetFilesAt(ctx context.Context, ref string, paths []string) (map[string]*repository.RemoteFileInfo, error) {
+	args := m.Called(ctx, ref, paths)
+	files, _ := args.Get(0).(map[string]*repository.RemoteFileInfo)
+	return files, args.Error(1)
+}
+
+func (m *MockRepository) GetAllFilesAt(ctx context.Context, ref string, have map[string]string) (map[string]*repository.RemoteFileInfo, error) {
+	args := m.Called(ctx, ref, have)
+	files, _ := args.Get(0).(map[string]*repository.RemoteFileInfo)
+	return files, args.Error(1)
+}
+
+func (m *MockRepository) ResolveCommitAt(ctx context.Context, at time.Time) (string, error) {
+	args := m.Called(ctx, at)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) GetHeadSHA(ctx context.Context) (string, error) {
+	args := m.Called(ctx)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) CompareCommits(ctx context.Context, base, head string) ([]repository.FileChange, error) {
+	args := m.Called(ctx, base, head)
+	changes, _ := args.Get(0).([]repository.FileChange)
+	return changes, args.Error(1)
+}
+
 func TestStatusCommand(t *testing.T) {
 	// Create temporary directory for test
 	tempDir, err := os.MkdirTemp("", "catapult-test-*")
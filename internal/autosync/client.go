@@ -0,0 +1,153 @@
+package autosync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// controlDialTimeout bounds connecting to the control socket
+const controlDialTimeout = 2 * time.Second
+
+// Client talks to a running daemon through its control socket
+type Client struct {
+	http *http.Client
+}
+
+// Dial connects to the daemon running on stateDir. It fails if no daemon
+// answers on the control socket.
+func Dial(ctx context.Context, stateDir string) (*Client, error) {
+	socketPath := ControlSocketPath(stateDir)
+	if _, err := os.Stat(socketPath); err != nil {
+		return nil, fmt.Errorf("no control socket: %w", err)
+	}
+
+	dialer := &net.Dialer{Timeout: controlDialTimeout}
+	client := &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, controlDialTimeout)
+	defer cancel()
+	if _, err := client.Status(pingCtx); err != nil {
+		return nil, fmt.Errorf("daemon not responding: %w", err)
+	}
+	return client, nil
+}
+
+// Status returns what the daemon is doing
+func (c *Client) Status(ctx context.Context) (*DaemonStatus, error) {
+	var status DaemonStatus
+	if err := c.do(ctx, http.MethodGet, "/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Pause holds back the daemon's syncs
+func (c *Client) Pause(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/pause", nil, nil)
+}
+
+// Resume lets the daemon sync again
+func (c *Client) Resume(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/resume", nil, nil)
+}
+
+// Sync runs a full sync in the daemon and waits until it finished
+func (c *Client) Sync(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/sync", nil, nil)
+}
+
+// Queue returns the daemon's offline queue
+func (c *Client) Queue(ctx context.Context) (*QueueSnapshot, error) {
+	var snapshot QueueSnapshot
+	if err := c.do(ctx, http.MethodGet, "/queue", nil, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// Retry puts a queued operation back in line to run now
+func (c *Client) Retry(ctx context.Context, operationID string) error {
+	return c.do(ctx, http.MethodPost, "/queue/retry", queueRequest{ID: operationID}, nil)
+}
+
+// RetryAll makes every pending operation due now and puts every dead letter
+// back in the queue, returning how many there were
+func (c *Client) RetryAll(ctx context.Context) (int, error) {
+	var response retryResponse
+	if err := c.do(ctx, http.MethodPost, "/queue/retry", queueRequest{}, &response); err != nil {
+		return 0, err
+	}
+	return response.Retried, nil
+}
+
+// Drop removes a queued operation without running it
+func (c *Client) Drop(ctx context.Context, operationID string) error {
+	return c.do(ctx, http.MethodPost, "/queue/drop", queueRequest{ID: operationID}, nil)
+}
+
+// Flush processes every pending operation now
+func (c *Client) Flush(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/queue/flush", nil, nil)
+}
+
+// Reload makes the daemon apply the config file again
+func (c *Client) Reload(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/reload", nil, nil)
+}
+
+// do sends a control request with an optional JSON body and decodes the
+// response into result, if given
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	// The host is ignored; requests go to the socket
+	request, err := http.NewRequestWithContext(ctx, method, "http://catapult"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to reach the daemon: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		var failure errorResponse
+		if err := json.NewDecoder(response.Body).Decode(&failure); err != nil || failure.Error == "" {
+			return fmt.Errorf("daemon answered %s", response.Status)
+		}
+		return fmt.Errorf("daemon: %s", failure.Error)
+	}
+	if result != nil {
+		if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to read daemon response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package autosync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ControlSocketName is the Unix socket in the state directory through which
+// other catapult processes talk to the running daemon
+const ControlSocketName = "catapult.sock"
+
+// DaemonStatus describes what the running daemon is doing
+type DaemonStatus struct {
+	PID         int       `json:"pid"`
+	StartedAt   time.Time `json:"started_at"`
+	Paused      bool      `json:"paused"`
+	Syncing     bool      `json:"syncing"`
+	LastSync    time.Time `json:"last_sync,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	Pending     int       `json:"pending"`
+	DeadLetters int       `json:"dead_letters"`
+	WatchedDirs int       `json:"watched_dirs"`
+}
+
+// QueueSnapshot lists the operations of the daemon's offline queue
+type QueueSnapshot struct {
+	Pending     []*QueueOperation `json:"pending"`
+	DeadLetters []*QueueOperation `json:"dead_letters"`
+}
+
+// queueRequest names the queued operation to retry or drop; retrying
+// without an ID makes every pending operation due now and puts every dead
+// letter back in the queue
+type queueRequest struct {
+	ID string `json:"id,omitempty"`
+}
+
+// retryResponse reports how many operations were put back in the queue
+type retryResponse struct {
+	Retried int `json:"retried"`
+}
+
+// errorResponse carries the error of a failed control request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// errPaused is returned for syncs requested while the daemon is paused
+var errPaused = errors.New("auto-sync is paused, resume it first")
+
+// ControlSocketPath returns the path of the control socket in stateDir
+func ControlSocketPath(stateDir string) string {
+	return filepath.Join(stateDir, ControlSocketName)
+}
+
+// serveControl serves the control API on the socket in the state directory
+// until ctx is cancelled
+func (m *Manager) serveControl(ctx context.Context) error {
+	socketPath := ControlSocketPath(filepath.Dir(m.appConfig.Storage.StatePath))
+
+	// The daemon holds the state lock, so a socket left behind is stale
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	defer os.Remove(socketPath)
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           m.controlHandler(ctx),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve control socket: %w", err)
+	}
+	return nil
+}
+
+// controlHandler routes control requests; syncs it starts end with ctx
+func (m *Manager) controlHandler(ctx context.Context) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.Status())
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		m.Pause()
+		writeJSON(w, http.StatusOK, m.Status())
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		m.Resume()
+		writeJSON(w, http.StatusOK, m.Status())
+	})
+	mux.HandleFunc("POST /sync", func(w http.ResponseWriter, r *http.Request) {
+		if m.scheduler.Paused() {
+			writeError(w, http.StatusConflict, errPaused)
+			return
+		}
+		syncCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+		defer cancel()
+		if err := m.scheduler.Sync(syncCtx); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /queue", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, QueueSnapshot{
+			Pending:     m.queue.GetPending(),
+			DeadLetters: m.queue.DeadLetters(),
+		})
+	})
+	mux.HandleFunc("POST /queue/retry", func(w http.ResponseWriter, r *http.Request) {
+		var request queueRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+			return
+		}
+		if request.ID == "" {
+			retried, err := m.queue.RetryAll()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, retryResponse{Retried: retried})
+			return
+		}
+		if err := m.queue.Retry(request.ID); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, retryResponse{Retried: 1})
+	})
+	mux.HandleFunc("POST /queue/drop", func(w http.ResponseWriter, r *http.Request) {
+		var request queueRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.ID == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("no operation to drop"))
+			return
+		}
+		if err := m.queue.Drop(request.ID); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /queue/flush", func(w http.ResponseWriter, r *http.Request) {
+		if m.scheduler.Paused() {
+			writeError(w, http.StatusConflict, errPaused)
+			return
+		}
+		m.flushQueue()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /metrics", m.handleMetrics)
+	mux.HandleFunc("POST /reload", func(w http.ResponseWriter, r *http.Request) {
+		if err := m.reloadConfig(); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+// Status reports what the manager is doing
+func (m *Manager) Status() DaemonStatus {
+	status := DaemonStatus{
+		PID:         os.Getpid(),
+		StartedAt:   m.startedAt,
+		Paused:      m.scheduler.Paused(),
+		Pending:     m.queue.Size(),
+		DeadLetters: len(m.queue.DeadLetters()),
+		WatchedDirs: m.watcher.WatchedCount(),
+	}
+
+	m.statusMu.Lock()
+	status.Syncing = m.syncing
+	status.LastSync = m.lastSync
+	if m.lastSyncErr != nil {
+		status.LastError = m.lastSyncErr.Error()
+	}
+	m.statusMu.Unlock()
+	return status
+}
+
+// Pause holds back syncs and queued operations until Resume; changes keep
+// being collected meanwhile
+func (m *Manager) Pause() {
+	if !m.scheduler.Paused() {
+		m.logger.Printf("Auto-sync paused")
+	}
+	m.scheduler.SetPaused(true)
+}
+
+// Resume runs the syncs held back while paused and continues syncing
+func (m *Manager) Resume() {
+	if m.scheduler.Paused() {
+		m.logger.Printf("Auto-sync resumed")
+	}
+	m.scheduler.SetPaused(false)
+}
+
+// writeJSON answers a control request with v
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers a failed control request
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
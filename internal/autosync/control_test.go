@@ -0,0 +1,112 @@
+package autosync
+
+import (
+	"context"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/itcaat/catapult/internal/config"
+)
+
+func TestControl_RoundTrip(t *testing.T) {
+	stateDir := t.TempDir()
+	logger := log.New(io.Discard, "", 0)
+	watcher, err := NewWatcher(DefaultWatchConfig(), logger)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	appConfig := &config.Config{}
+	appConfig.Storage.StatePath = filepath.Join(stateDir, "state.json")
+
+	var syncs int32
+	m := &Manager{
+		config:        DefaultConfig(),
+		appConfig:     appConfig,
+		watcher:       watcher,
+		queue:         NewQueue(filepath.Join(stateDir, QueueFileName), 100),
+		logger:        logger,
+		configChanged: make(chan struct{}, 1),
+		startedAt:     time.Now(),
+	}
+	m.scheduler = newScheduler(func(ctx context.Context, batch *syncBatch) error {
+		atomic.AddInt32(&syncs, 1)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go m.scheduler.Run(ctx)
+	served := make(chan error, 1)
+	go func() { served <- m.serveControl(ctx) }()
+
+	// Wait for the socket to be served
+	var client *Client
+	for client == nil {
+		if client, err = Dial(ctx, stateDir); err != nil {
+			if ctx.Err() != nil {
+				t.Fatalf("Failed to reach the control socket: %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	status, err := client.Status(ctx)
+	if err != nil || status.Paused || status.PID == 0 {
+		t.Fatalf("Expected a running, unpaused daemon, got %+v, %v", status, err)
+	}
+
+	// Syncs are refused while paused and run once resumed
+	if err := client.Pause(ctx); err != nil {
+		t.Fatalf("Failed to pause: %v", err)
+	}
+	if err := client.Sync(ctx); err == nil || !strings.Contains(err.Error(), "paused") {
+		t.Errorf("Expected sync to be refused while paused, got %v", err)
+	}
+	if status, _ := client.Status(ctx); !status.Paused {
+		t.Errorf("Expected status to report the pause")
+	}
+	if err := client.Resume(ctx); err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	if err := client.Sync(ctx); err != nil {
+		t.Errorf("Expected sync to succeed, got %v", err)
+	}
+	if atomic.LoadInt32(&syncs) != 1 {
+		t.Errorf("Expected 1 sync, got %d", syncs)
+	}
+
+	// The queue can be inspected and changed
+	m.queue.Add(&QueueOperation{FilePath: "a.txt", Operation: OperationWrite})
+	snapshot, err := client.Queue(ctx)
+	if err != nil || len(snapshot.Pending) != 1 {
+		t.Fatalf("Expected 1 pending operation, got %+v, %v", snapshot, err)
+	}
+	if err := client.Retry(ctx, snapshot.Pending[0].ID); err != nil {
+		t.Errorf("Expected retry to succeed, got %v", err)
+	}
+	if err := client.Drop(ctx, snapshot.Pending[0].ID); err != nil {
+		t.Errorf("Expected drop to succeed, got %v", err)
+	}
+	if err := client.Drop(ctx, "missing"); err == nil {
+		t.Errorf("Expected dropping an unknown operation to fail")
+	}
+	if status, _ := client.Status(ctx); status.Pending != 0 {
+		t.Errorf("Expected the queue to be empty, got %d pending", status.Pending)
+	}
+
+	// The socket is removed on shutdown
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("Expected the control socket to shut down cleanly, got %v", err)
+	}
+	if _, err := Dial(context.Background(), stateDir); err == nil {
+		t.Errorf("Expected no daemon to answer after shutdown")
+	}
+}
@@ -50,6 +50,14 @@ func (d *Debouncer) Add(key string, callback func()) {
 	})
 }
 
+// SetDelay changes the delay of callbacks added from now on
+func (d *Debouncer) SetDelay(delay time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.delay = delay
+}
+
 // Cancel removes a pending callback
 func (d *Debouncer) Cancel(key string) {
 	d.mutex.Lock()
@@ -9,10 +9,29 @@ import (
 // FileEvent represents a file system event
 type FileEvent struct {
 	Path      string
+	OldPath   string // Previous path of a file renamed within the watched tree
 	Op        fsnotify.Op
 	Timestamp time.Time
 }
 
+// Operation returns the queue operation that applies the event
+func (e FileEvent) Operation() string {
+	switch FromFsnotifyOp(e.Op) {
+	case EventCreate:
+		return OperationCreate
+	case EventRemove:
+		return OperationDelete
+	case EventRename:
+		if e.OldPath != "" {
+			return OperationRename
+		}
+		// Moved out of the watched tree
+		return OperationDelete
+	default:
+		return OperationWrite
+	}
+}
+
 // EventType represents the type of file system event
 type EventType int
 
@@ -2,10 +2,13 @@ package autosync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	gosync "sync"
 	"time"
 
 	"github.com/itcaat/catapult/internal/config"
@@ -25,8 +28,12 @@ type Config struct {
 	OfflineQueue        bool          `yaml:"offline_queue"`
 	MaxQueueSize        int           `yaml:"max_queue_size"`
 	NotificationLevel   string        `yaml:"notification_level"` // silent, minimal, verbose
+	IgnorePatterns      []string      `yaml:"ignore_patterns"`    // Added to the built-in patterns
 }
 
+// syncTimeout bounds a single scheduled sync
+const syncTimeout = 10 * time.Minute
+
 // DefaultConfig returns sensible defaults for auto-sync
 func DefaultConfig() *Config {
 	return &Config{
@@ -41,10 +48,44 @@ func DefaultConfig() *Config {
 	}
 }
 
+// NewConfig creates the auto-sync configuration from the autosync section of
+// the config file, whose defaults are already filled in
+func NewConfig(settings *config.AutoSyncConfig) *Config {
+	autoSyncConfig := DefaultConfig()
+	if settings.Enabled != nil {
+		autoSyncConfig.Enabled = *settings.Enabled
+	}
+	if settings.WatchLocalChanges != nil {
+		autoSyncConfig.WatchLocalChanges = *settings.WatchLocalChanges
+	}
+	if settings.OfflineQueue != nil {
+		autoSyncConfig.OfflineQueue = *settings.OfflineQueue
+	}
+	if settings.CheckRemoteInterval > 0 {
+		autoSyncConfig.CheckRemoteInterval = settings.CheckRemoteInterval
+	}
+	if settings.DebounceDelay > 0 {
+		autoSyncConfig.DebounceDelay = settings.DebounceDelay
+	}
+	if settings.RetryAttempts > 0 {
+		autoSyncConfig.RetryAttempts = settings.RetryAttempts
+	}
+	if settings.MaxQueueSize > 0 {
+		autoSyncConfig.MaxQueueSize = settings.MaxQueueSize
+	}
+	if settings.NotificationLevel != "" {
+		autoSyncConfig.NotificationLevel = settings.NotificationLevel
+	}
+	autoSyncConfig.IgnorePatterns = settings.IgnorePatterns
+	return autoSyncConfig
+}
+
 // Manager coordinates automatic synchronization
 type Manager struct {
 	watcher         *Watcher
-	config          *Config
+	config          *Config // Replaced on reload, read through settings
+	configMu        gosync.RWMutex
+	configChanged   chan struct{}
 	appConfig       *config.Config
 	syncer          *sync.Syncer
 	fileManager     *storage.FileManager
@@ -53,6 +94,15 @@ type Manager struct {
 	done            chan struct{}
 	networkDetector *network.Detector
 	queue           *Queue
+	scheduler       *scheduler
+	processing      gosync.Mutex // Held while queued operations run
+
+	startedAt   time.Time
+	statusMu    gosync.Mutex
+	syncing     bool
+	lastSync    time.Time
+	lastSyncErr error
+	metrics     metrics
 }
 
 // NewManager creates a new auto-sync manager
@@ -63,13 +113,10 @@ func NewManager(
 	repo repository.Repository,
 	logger *log.Logger,
 ) (*Manager, error) {
-	autoSyncConfig := DefaultConfig()
+	autoSyncConfig := NewConfig(&appConfig.AutoSync)
 
 	// Create watcher
-	watchConfig := &WatchConfig{
-		DebounceDelay: autoSyncConfig.DebounceDelay,
-	}
-	watcher, err := NewWatcher(watchConfig, logger)
+	watcher, err := NewWatcher(NewWatchConfig(autoSyncConfig), logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create watcher: %w", err)
 	}
@@ -78,7 +125,7 @@ func NewManager(
 	networkDetector := network.NewDetector()
 
 	// Create offline queue
-	queuePath := filepath.Join(filepath.Dir(appConfig.Storage.StatePath), "queue.json")
+	queuePath := filepath.Join(filepath.Dir(appConfig.Storage.StatePath), QueueFileName)
 	queue := NewQueue(queuePath, autoSyncConfig.MaxQueueSize)
 
 	// Load existing queue
@@ -86,7 +133,7 @@ func NewManager(
 		logger.Printf("Warning: failed to load offline queue: %v", err)
 	}
 
-	return &Manager{
+	m := &Manager{
 		watcher:         watcher,
 		config:          autoSyncConfig,
 		appConfig:       appConfig,
@@ -97,25 +144,39 @@ func NewManager(
 		done:            make(chan struct{}),
 		networkDetector: networkDetector,
 		queue:           queue,
-	}, nil
+		configChanged:   make(chan struct{}, 1),
+	}
+	m.scheduler = newScheduler(m.runSync)
+	return m, nil
+}
+
+// settings returns the current auto-sync configuration
+func (m *Manager) settings() *Config {
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+	return m.config
 }
 
 // Start begins automatic synchronization
 func (m *Manager) Start(ctx context.Context) error {
-	if !m.config.Enabled {
+	if !m.settings().Enabled {
 		m.logger.Printf("Auto-sync is disabled")
 		return nil
 	}
 
 	m.logger.Printf("Starting auto-sync manager")
+	m.startedAt = time.Now()
+
+	// Every sync below goes through the scheduler, one at a time
+	go m.scheduler.Run(ctx)
 
 	// Process any pending queue items first
-	if m.config.OfflineQueue {
+	if m.settings().OfflineQueue {
 		go m.processOfflineQueue(ctx)
 	}
 
 	// Start file watcher if enabled
-	if m.config.WatchLocalChanges {
+	if m.settings().WatchLocalChanges {
 		go func() {
 			if err := m.startFileWatcher(ctx); err != nil {
 				m.logger.Printf("File watcher error: %v", err)
@@ -124,15 +185,43 @@ func (m *Manager) Start(ctx context.Context) error {
 	}
 
 	// Start periodic remote checks if enabled
-	if m.config.CheckRemoteInterval > 0 {
+	if m.settings().CheckRemoteInterval > 0 {
 		go func() {
 			m.startPeriodicRemoteCheck(ctx)
 		}()
 	}
 
+	// Apply changes to the config file without a restart
+	go m.watchConfigFile(ctx)
+
+	// Let other catapult processes control this one
+	go func() {
+		if err := m.serveControl(ctx); err != nil {
+			m.logger.Printf("Control socket error: %v", err)
+		}
+	}()
+
 	// Start periodic queue cleanup
 	go m.startQueueCleanup(ctx)
 
+	// Pull pushes from other devices as soon as GitHub reports them
+	if m.appConfig.Webhook.Enabled {
+		go func() {
+			if err := m.serveWebhooks(ctx); err != nil {
+				m.logger.Printf("Webhook listener error: %v", err)
+			}
+		}()
+	}
+
+	// Expose metrics for monitoring
+	if m.appConfig.Metrics.Enabled {
+		go func() {
+			if err := m.serveMetrics(ctx); err != nil {
+				m.logger.Printf("Metrics endpoint error: %v", err)
+			}
+		}()
+	}
+
 	m.logger.Printf("Auto-sync manager started successfully")
 
 	// Wait for context cancellation
@@ -148,94 +237,179 @@ func (m *Manager) startFileWatcher(ctx context.Context) error {
 
 // onFileChange handles file change events
 func (m *Manager) onFileChange(event FileEvent) {
-	m.logger.Printf("Processing file change: %s", event.Path)
-
-	// Check if file should be synced
-	relPath, err := filepath.Rel(m.appConfig.Storage.BaseDir, event.Path)
+	op, err := m.operationForEvent(event)
 	if err != nil {
-		m.logger.Printf("Failed to get relative path for %s: %v", event.Path, err)
+		m.logger.Printf("Failed to handle change of %s: %v", event.Path, err)
 		return
 	}
 
-	// Skip if file doesn't exist (might be a temporary file)
-	if _, err := os.Stat(event.Path); os.IsNotExist(err) {
-		m.logger.Printf("File no longer exists, skipping: %s", event.Path)
-		return
-	}
+	m.logger.Printf("Processing file change: %s %s", op.Operation, event.Path)
+	m.metrics.watcherEvent(op.Operation)
 
 	// Try to sync immediately if online, otherwise queue
-	if m.networkDetector.IsConnected() {
-		m.syncFile(relPath)
+	if m.isConnected() {
+		m.scheduler.Schedule(op.Paths()...)
 	} else {
-		m.queueOperation(relPath, "sync")
+		m.queueOperation(op)
 	}
 }
 
-// syncFile synchronizes a specific file
-func (m *Manager) syncFile(relPath string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// operationForEvent translates a file event into a queue operation on
+// relative paths
+func (m *Manager) operationForEvent(event FileEvent) (*QueueOperation, error) {
+	relPath, err := filepath.Rel(m.appConfig.Storage.BaseDir, event.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relative path: %w", err)
+	}
+
+	op := &QueueOperation{
+		FilePath:  relPath,
+		Operation: event.Operation(),
+		Timestamp: event.Timestamp,
+	}
+
+	// Editors often save by replacing the file, which looks like a create.
+	// Only files unknown to the remote count as created, so a create and a
+	// delete can safely cancel out in the queue.
+	if op.Operation == OperationCreate {
+		if info, err := m.fileManager.GetFileInfo(event.Path); err == nil && info.LastSyncedRemoteSHA != "" {
+			op.Operation = OperationWrite
+		}
+	}
+	if op.Operation == OperationRename {
+		if op.OldPath, err = filepath.Rel(m.appConfig.Storage.BaseDir, event.OldPath); err != nil {
+			return nil, fmt.Errorf("failed to get relative path: %w", err)
+		}
+	}
+	return op, nil
+}
+
+// runSync performs a batch of syncs requested through the scheduler. Paths
+// nobody waits for are queued if they fail to sync, and dead letters of
+// paths that synced are resolved.
+func (m *Manager) runSync(ctx context.Context, batch *syncBatch) error {
+	ctx, cancel := context.WithTimeout(ctx, syncTimeout)
 	defer cancel()
 
-	m.logger.Printf("Syncing file: %s", relPath)
+	m.statusMu.Lock()
+	m.syncing = true
+	m.statusMu.Unlock()
+
+	start := time.Now()
+	err := m.syncBatch(ctx, batch)
+	m.metrics.observeSync(batchKind(batch), time.Since(start), err)
+
+	m.statusMu.Lock()
+	m.syncing = false
+	m.lastSync = time.Now()
+	m.lastSyncErr = err
+	m.statusMu.Unlock()
+
+	// A sync where only some files failed still synced the others
+	var fileErrs sync.FileErrors
+	partial := errors.As(err, &fileErrs)
+	if err == nil || partial {
+		requested := make(map[string]bool)
+		for _, relPath := range batch.Paths {
+			requested[relPath] = true
+		}
+		if err := m.queue.ResolveDeadLetters(func(relPath string) bool {
+			if relPath == "" {
+				return batch.Full && len(fileErrs) == 0
+			}
+			return (batch.Full || requested[relPath]) && fileErrs[relPath] == nil
+		}); err != nil {
+			m.logger.Printf("Failed to update dead letters: %v", err)
+		}
+	}
+
+	if err != nil {
+		m.logger.Printf("Failed to sync %s: %v", describeBatch(batch), err)
+		for _, relPath := range batch.Detached {
+			if !partial || fileErrs[relPath] != nil {
+				m.queueOperation(&QueueOperation{FilePath: relPath, Operation: OperationSync})
+			}
+		}
+		return err
+	}
+
+	if m.settings().NotificationLevel != "silent" {
+		fmt.Printf("✅ Auto-synced: %s\n", describeBatch(batch))
+	}
+	return nil
+}
+
+// syncBatch reloads the state, syncs the batch and saves the state
+func (m *Manager) syncBatch(ctx context.Context, batch *syncBatch) error {
+	m.logger.Printf("Syncing %s", describeBatch(batch))
 
 	// Wait for network connectivity with timeout
 	connectCtx, connectCancel := context.WithTimeout(ctx, 10*time.Second)
 	defer connectCancel()
 
 	if err := m.networkDetector.WaitForGitHubConnectivity(connectCtx); err != nil {
-		m.logger.Printf("No GitHub connectivity, queueing sync for %s", relPath)
-		m.queueOperation(relPath, "sync")
-		return
+		return fmt.Errorf("no GitHub connectivity: %w", err)
 	}
 
 	// Reload file manager state to get latest file info
 	if err := m.fileManager.LoadState(m.appConfig.Storage.StatePath); err != nil {
-		m.logger.Printf("Failed to load state: %v", err)
-		m.queueOperation(relPath, "sync")
-		return
+		return fmt.Errorf("failed to load state: %w", err)
 	}
 
-	// Scan directory to update file info
-	if err := m.fileManager.ScanDirectory(); err != nil {
-		m.logger.Printf("Failed to scan directory: %v", err)
-		m.queueOperation(relPath, "sync")
-		return
+	// Perform sync, rescanning only the changed files unless syncing
+	// everything. Syncing local changes also brings in remote ones, so only
+	// a batch of nothing but remote changes just pulls them.
+	var err error
+	switch {
+	case batch.Full:
+		err = m.syncer.SyncAll(ctx, os.Stdout)
+	case len(batch.Paths) > 0:
+		err = m.syncer.SyncFiles(ctx, batch.Paths, os.Stdout)
+	default:
+		err = m.syncer.PullChanges(ctx, os.Stdout)
 	}
-
-	// Perform sync
-	if err := m.syncer.SyncAll(ctx, os.Stdout); err != nil {
-		m.logger.Printf("Failed to sync file %s: %v", relPath, err)
-		m.queueOperation(relPath, "sync")
-		return
+	if err != nil {
+		return fmt.Errorf("failed to sync: %w", err)
 	}
 
 	// Save state after sync
 	if err := m.fileManager.SaveState(m.appConfig.Storage.StatePath); err != nil {
-		m.logger.Printf("Failed to save state: %v", err)
+		return fmt.Errorf("failed to save state: %w", err)
 	}
 
-	if m.config.NotificationLevel != "silent" {
-		fmt.Printf("✅ Auto-synced: %s\n", relPath)
+	// Report the files of the batch that failed
+	fileErrs := m.syncer.LastErrors()
+	if len(fileErrs) == 0 {
+		return nil
+	}
+	if batch.Full {
+		return fileErrs
 	}
+	return fileErrs.Only(batch.Paths)
 }
 
-// queueOperation adds an operation to the offline queue
-func (m *Manager) queueOperation(filePath, operation string) {
-	if !m.config.OfflineQueue {
-		return
+// describeBatch names the files of a batch for logs and notifications
+func describeBatch(batch *syncBatch) string {
+	if batch.Full {
+		return "all files"
 	}
+	if len(batch.Paths) == 0 {
+		return "remote changes"
+	}
+	return strings.Join(batch.Paths, ", ")
+}
 
-	op := &QueueOperation{
-		FilePath:  filePath,
-		Operation: operation,
-		Timestamp: time.Now(),
+// queueOperation adds an operation to the offline queue
+func (m *Manager) queueOperation(op *QueueOperation) {
+	if !m.settings().OfflineQueue {
+		return
 	}
 
 	if err := m.queue.Add(op); err != nil {
-		m.logger.Printf("Failed to queue operation for %s: %v", filePath, err)
+		m.logger.Printf("Failed to queue %s of %s: %v", op.Operation, op.FilePath, err)
 	} else {
-		if m.config.NotificationLevel == "verbose" {
-			fmt.Printf("📥 Queued for sync: %s\n", filePath)
+		if m.settings().NotificationLevel == "verbose" {
+			fmt.Printf("📥 Queued for sync: %s %s\n", op.Operation, op.FilePath)
 		}
 	}
 }
@@ -250,44 +424,106 @@ func (m *Manager) processOfflineQueue(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			if m.networkDetector.IsConnected() {
+			if m.isConnected() {
 				m.processPendingOperations()
 			}
 		}
 	}
 }
 
-// processPendingOperations executes all pending queue operations
+// processPendingOperations executes the pending queue operations that are
+// due. Failed operations are retried with backoff; those that can't succeed
+// or run out of attempts are moved to the dead-letter list.
 func (m *Manager) processPendingOperations() {
-	pending := m.queue.GetPending()
-	if len(pending) == 0 {
+	if m.scheduler.Paused() {
 		return
 	}
+	m.processOperations(m.queue.Due(time.Now()))
+}
 
-	m.logger.Printf("Processing %d pending operations", len(pending))
+// FlushQueue processes every pending operation now, regardless of backoff,
+// through the same path as the running manager. It is for managers that
+// weren't started; a running one flushes on request of 'catapult queue'.
+func (m *Manager) FlushQueue(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go m.scheduler.Run(ctx)
+	m.flushQueue()
+}
+
+// flushQueue processes every pending operation now
+func (m *Manager) flushQueue() {
+	m.processOperations(m.queue.GetPending())
+}
+
+// Queue returns the offline queue of the manager
+func (m *Manager) Queue() *Queue {
+	return m.queue
+}
+
+// processOperations executes queued operations in order
+func (m *Manager) processOperations(ops []*QueueOperation) {
+	if len(ops) == 0 {
+		return
+	}
+
+	m.processing.Lock()
+	defer m.processing.Unlock()
+
+	m.logger.Printf("Processing %d pending operations", len(ops))
 
-	for _, op := range pending {
-		// Skip operations that have exceeded retry limit
-		if op.Retries >= m.config.RetryAttempts {
-			m.logger.Printf("Operation %s exceeded retry limit, removing", op.ID)
-			m.queue.Remove(op.ID)
-			continue
+	for _, op := range ops {
+		err := m.executeQueuedOperation(op)
+
+		// Only the files of this operation matter; a full sync hands its
+		// failed files over to operations of their own
+		var fileErrs sync.FileErrors
+		if errors.As(err, &fileErrs) {
+			if op.IsFullSync() {
+				m.queue.Complete(op)
+				for relPath, fileErr := range fileErrs {
+					m.queueOperation(&QueueOperation{FilePath: relPath, Operation: OperationSync, LastError: fileErr.Error()})
+				}
+				continue
+			}
+			err = fileErrs.Only(op.Paths())
 		}
 
-		// Try to execute operation
-		if err := m.executeQueuedOperation(op); err != nil {
-			m.logger.Printf("Failed to execute operation %s: %v", op.ID, err)
-			m.queue.UpdateRetry(op.ID, err)
-		} else {
+		switch {
+		case err == nil:
 			// Success - remove from queue
-			m.queue.Remove(op.ID)
-			if m.config.NotificationLevel != "silent" {
+			m.queue.Complete(op)
+			if m.settings().NotificationLevel != "silent" {
 				fmt.Printf("✅ Processed queued sync: %s\n", op.FilePath)
 			}
+		case isPermanent(err):
+			m.deadLetter(op, err)
+		case op.Retries+1 >= m.settings().RetryAttempts:
+			err = fmt.Errorf("gave up after %d attempts: %w", op.Retries+1, err)
+			m.deadLetter(op, err)
+			m.syncer.ReportFailure(filepath.Join(m.appConfig.Storage.BaseDir, op.FilePath), err)
+		default:
+			next := time.Now().Add(retryDelay(op.Retries + 1))
+			m.logger.Printf("Failed to execute operation %s, retrying at %s: %v", op.ID, next.Format(time.TimeOnly), err)
+			if err := m.queue.RetryLater(op.ID, err, next); err != nil {
+				m.logger.Printf("Failed to reschedule operation %s: %v", op.ID, err)
+			}
 		}
 	}
 }
 
+// deadLetter gives up on an operation, keeping it in the dead-letter list
+func (m *Manager) deadLetter(op *QueueOperation, err error) {
+	m.logger.Printf("Giving up on operation %s: %v", op.ID, err)
+	if err := m.queue.DeadLetter(op.ID, err); err != nil {
+		m.logger.Printf("Failed to move operation %s to the dead-letter list: %v", op.ID, err)
+	}
+	if m.settings().NotificationLevel != "silent" {
+		fmt.Printf("❌ Can't sync %s: %v\n", op.FilePath, err)
+	}
+}
+
 // executeQueuedOperation executes a single queued operation
 func (m *Manager) executeQueuedOperation(op *QueueOperation) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
@@ -298,99 +534,62 @@ func (m *Manager) executeQueuedOperation(op *QueueOperation) error {
 		return fmt.Errorf("no GitHub connectivity: %w", err)
 	}
 
-	// Execute the operation based on type
+	// Execute the operation based on type by syncing the paths it touched:
+	// creates and writes upload the file, deletes remove it remotely, and a
+	// rename, syncing both of its paths, is committed as a single move.
 	switch op.Operation {
-	case "sync":
-		return m.executeSyncOperation(ctx, op.FilePath)
+	case OperationSync, OperationCreate, OperationWrite, OperationDelete, OperationRename:
+		return m.scheduler.Sync(ctx, op.Paths()...)
 	default:
-		return fmt.Errorf("unknown operation type: %s", op.Operation)
+		return &unknownOperationError{op.Operation}
 	}
 }
 
-// executeSyncOperation executes a sync operation
-func (m *Manager) executeSyncOperation(ctx context.Context, relPath string) error {
-	// Reload state
-	if err := m.fileManager.LoadState(m.appConfig.Storage.StatePath); err != nil {
-		return fmt.Errorf("failed to load state: %w", err)
-	}
-
-	// Scan directory
-	if err := m.fileManager.ScanDirectory(); err != nil {
-		return fmt.Errorf("failed to scan directory: %w", err)
-	}
-
-	// Perform sync
-	if err := m.syncer.SyncAll(ctx, os.Stdout); err != nil {
-		return fmt.Errorf("failed to sync: %w", err)
-	}
-
-	// Save state
-	if err := m.fileManager.SaveState(m.appConfig.Storage.StatePath); err != nil {
-		return fmt.Errorf("failed to save state: %w", err)
-	}
-
-	return nil
-}
-
 // startPeriodicRemoteCheck checks for remote changes periodically
 func (m *Manager) startPeriodicRemoteCheck(ctx context.Context) {
-	ticker := time.NewTicker(m.config.CheckRemoteInterval)
+	interval := m.settings().CheckRemoteInterval
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			if m.networkDetector.IsConnected() {
+			if m.isConnected() {
 				m.checkRemoteChanges()
 			}
+		case <-m.configChanged:
+			if newInterval := m.settings().CheckRemoteInterval; newInterval != interval {
+				interval = newInterval
+				ticker.Reset(interval)
+			}
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-// checkRemoteChanges looks for changes in the remote repository
+// checkRemoteChanges looks for changes in the remote repository. Comparing
+// the head commit with the last synced one takes a single request; what
+// changed is only looked up by the sync it triggers.
 func (m *Manager) checkRemoteChanges() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	m.logger.Printf("Checking for remote changes")
-
-	// Get remote files
-	remoteFiles, err := m.repo.GetAllFilesWithContent(ctx)
+	headSHA, err := m.repo.GetHeadSHA(ctx)
 	if err != nil {
-		m.logger.Printf("Failed to get remote files: %v", err)
+		m.logger.Printf("Failed to check for remote changes: %v", err)
 		return
 	}
 
-	// Check if we have any remote-only files or modified files
-	localFiles := m.fileManager.GetTrackedFiles()
-	hasChanges := false
-
-	// Check for remote-only files
-	for remotePath := range remoteFiles {
-		found := false
-		for _, localFile := range localFiles {
-			if relPath, err := filepath.Rel(m.appConfig.Storage.BaseDir, localFile.Path); err == nil {
-				if relPath == remotePath {
-					found = true
-					break
-				}
-			}
-		}
-		if !found {
-			hasChanges = true
-			break
-		}
+	if manifest := m.fileManager.RemoteManifest(); manifest != nil && manifest.Head() == headSHA {
+		return
 	}
 
-	if hasChanges {
-		m.logger.Printf("Remote changes detected, syncing...")
-		m.syncFile("") // Sync all files
-	}
+	m.logger.Printf("Remote changes detected, syncing...")
+	m.scheduler.Pull()
 }
 
-// startQueueCleanup periodically cleans up old queue entries
+// startQueueCleanup periodically gives up on queued operations out of attempts
 func (m *Manager) startQueueCleanup(ctx context.Context) {
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
@@ -400,14 +599,27 @@ func (m *Manager) startQueueCleanup(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			// Clean up operations older than 24 hours or with too many retries
-			if err := m.queue.Cleanup(24*time.Hour, m.config.RetryAttempts); err != nil {
-				m.logger.Printf("Failed to cleanup queue: %v", err)
-			}
+			// Give up on operations out of attempts. Age alone doesn't
+			// count: operations wait as long as the device is offline.
+			m.giveUpExhausted()
 		}
 	}
 }
 
+// giveUpExhausted moves the operations that used up their attempts to the
+// dead-letter list, reporting them like failed operations
+func (m *Manager) giveUpExhausted() {
+	m.processing.Lock()
+	defer m.processing.Unlock()
+
+	retryAttempts := m.settings().RetryAttempts
+	for _, op := range m.queue.Exhausted(retryAttempts) {
+		err := fmt.Errorf("gave up after %d attempts: %s", op.Retries, op.LastError)
+		m.deadLetter(op, err)
+		m.syncer.ReportFailure(filepath.Join(m.appConfig.Storage.BaseDir, op.FilePath), err)
+	}
+}
+
 // Stop gracefully stops the auto-sync manager
 func (m *Manager) Stop() error {
 	m.logger.Printf("Stopping auto-sync manager")
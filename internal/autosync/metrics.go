@@ -0,0 +1,226 @@
+package autosync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	gosync "sync"
+	"time"
+
+	"github.com/itcaat/catapult/internal/repository"
+)
+
+// syncDurationBuckets are the upper bounds of the sync duration histogram,
+// in seconds
+var syncDurationBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// histogram counts observations into syncDurationBuckets
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// observe records a value
+func (h *histogram) observe(value float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(syncDurationBuckets))
+	}
+	for i, bound := range syncDurationBuckets {
+		if value <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// metrics collects what the manager did for the metrics endpoint. The zero
+// value is ready to use.
+type metrics struct {
+	mu            gosync.Mutex
+	syncDurations map[string]*histogram // By batch kind
+	syncFailures  map[string]uint64     // By batch kind
+	lastSuccess   time.Time
+	watcherEvents map[string]uint64 // By operation
+	online        bool
+	onlineKnown   bool
+}
+
+// observeSync records a finished sync of a kind of batch
+func (mt *metrics) observeSync(kind string, duration time.Duration, err error) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	if mt.syncDurations == nil {
+		mt.syncDurations = make(map[string]*histogram)
+		mt.syncFailures = make(map[string]uint64)
+	}
+	if mt.syncDurations[kind] == nil {
+		mt.syncDurations[kind] = &histogram{}
+	}
+	mt.syncDurations[kind].observe(duration.Seconds())
+	if err != nil {
+		mt.syncFailures[kind]++
+	} else {
+		mt.lastSuccess = time.Now()
+	}
+}
+
+// watcherEvent counts a file change reported by the watcher
+func (mt *metrics) watcherEvent(operation string) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	if mt.watcherEvents == nil {
+		mt.watcherEvents = make(map[string]uint64)
+	}
+	mt.watcherEvents[operation]++
+}
+
+// setOnline records the outcome of a connectivity check
+func (mt *metrics) setOnline(online bool) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	mt.online = online
+	mt.onlineKnown = true
+}
+
+// batchKind names the kind of sync a batch runs, for metrics
+func batchKind(batch *syncBatch) string {
+	switch {
+	case batch.Full:
+		return "full"
+	case len(batch.Paths) > 0:
+		return "files"
+	default:
+		return "pull"
+	}
+}
+
+// isConnected checks connectivity, recording the outcome for metrics
+func (m *Manager) isConnected() bool {
+	online := m.networkDetector.IsConnected()
+	m.metrics.setOnline(online)
+	return online
+}
+
+// serveMetrics serves Prometheus metrics until ctx is cancelled
+func (m *Manager) serveMetrics(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", m.handleMetrics)
+	server := &http.Server{
+		Addr:              m.appConfig.Metrics.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	m.logger.Printf("Serving metrics on http://%s/metrics", m.appConfig.Metrics.Listen)
+	if err := listenAndServe(ctx, server); err != nil {
+		return fmt.Errorf("failed to serve metrics: %w", err)
+	}
+	return nil
+}
+
+// handleMetrics answers a scrape in the Prometheus text format
+func (m *Manager) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.writeMetrics(w)
+}
+
+// writeMetrics writes the metrics of the manager and its syncer in the
+// Prometheus text format
+func (m *Manager) writeMetrics(w io.Writer) {
+	if m.syncer != nil {
+		stats := m.syncer.Stats()
+		writeMetric(w, "catapult_files_uploaded_total", "counter", "Files uploaded to the repository.", float64(stats.Uploaded))
+		writeMetric(w, "catapult_files_downloaded_total", "counter", "Files downloaded from the repository.", float64(stats.Downloaded))
+		writeMetric(w, "catapult_files_deleted_total", "counter", "Files deleted from the repository.", float64(stats.Deleted))
+		writeMetric(w, "catapult_files_conflicted_total", "counter", "Conflicts resolved by keeping the local version.", float64(stats.Conflicts))
+	}
+
+	writeMetric(w, "catapult_queue_depth", "gauge", "Operations waiting in the offline queue.", float64(m.queue.Size()))
+	writeMetric(w, "catapult_dead_letters", "gauge", "Operations given up on.", float64(len(m.queue.DeadLetters())))
+	writeMetric(w, "catapult_sync_paused", "gauge", "Whether syncing is paused.", boolValue(m.scheduler.Paused()))
+	writeMetric(w, "catapult_watched_directories", "gauge", "Directories watched for changes.", float64(m.watcher.WatchedCount()))
+
+	if rate, ok := repository.RateLimitOf(m.repo); ok {
+		writeMetric(w, "catapult_github_rate_limit_remaining", "gauge", "GitHub API requests left in the current window.", float64(rate.Remaining))
+		writeMetric(w, "catapult_github_rate_limit_reset_timestamp_seconds", "gauge", "When the GitHub API rate limit window resets.", float64(rate.Reset.Unix()))
+	}
+
+	mt := &m.metrics
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	var lastSuccess float64
+	if !mt.lastSuccess.IsZero() {
+		lastSuccess = float64(mt.lastSuccess.UnixNano()) / 1e9
+	}
+	writeMetric(w, "catapult_last_successful_sync_timestamp_seconds", "gauge", "When a sync last succeeded, 0 if none did yet.", lastSuccess)
+
+	if mt.onlineKnown {
+		writeMetric(w, "catapult_network_online", "gauge", "Whether the last connectivity check succeeded.", boolValue(mt.online))
+	}
+
+	writeHeader(w, "catapult_sync_duration_seconds", "histogram", "Duration of syncs by kind: full, files or pull.")
+	for _, kind := range sortedKeys(mt.syncDurations) {
+		h := mt.syncDurations[kind]
+		var cumulative uint64
+		for i, bound := range syncDurationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "catapult_sync_duration_seconds_bucket{kind=%q,le=%q} %d\n", kind, formatValue(bound), cumulative)
+		}
+		fmt.Fprintf(w, "catapult_sync_duration_seconds_bucket{kind=%q,le=\"+Inf\"} %d\n", kind, h.count)
+		fmt.Fprintf(w, "catapult_sync_duration_seconds_sum{kind=%q} %s\n", kind, formatValue(h.sum))
+		fmt.Fprintf(w, "catapult_sync_duration_seconds_count{kind=%q} %d\n", kind, h.count)
+	}
+
+	writeHeader(w, "catapult_sync_failures_total", "counter", "Syncs that failed, by kind.")
+	for _, kind := range sortedKeys(mt.syncFailures) {
+		fmt.Fprintf(w, "catapult_sync_failures_total{kind=%q} %d\n", kind, mt.syncFailures[kind])
+	}
+
+	writeHeader(w, "catapult_watcher_events_total", "counter", "File changes reported by the watcher, by operation.")
+	for _, operation := range sortedKeys(mt.watcherEvents) {
+		fmt.Fprintf(w, "catapult_watcher_events_total{operation=%q} %d\n", operation, mt.watcherEvents[operation])
+	}
+}
+
+// writeHeader writes the help and type lines of a metric
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeMetric writes a metric with a single unlabelled sample
+func writeMetric(w io.Writer, name, kind, help string, value float64) {
+	writeHeader(w, name, kind, help)
+	fmt.Fprintf(w, "%s %s\n", name, formatValue(value))
+}
+
+// formatValue formats a sample value as Prometheus expects
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// boolValue turns a flag into a 0 or 1 sample
+func boolValue(flag bool) float64 {
+	if flag {
+		return 1
+	}
+	return 0
+}
+
+// sortedKeys returns the keys of a map in order, so scrapes are stable
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
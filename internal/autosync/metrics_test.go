@@ -0,0 +1,72 @@
+package autosync
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManager_Metrics(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	watcher, err := NewWatcher(DefaultWatchConfig(), logger)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	m := &Manager{
+		config:  DefaultConfig(),
+		watcher: watcher,
+		queue:   NewQueue(filepath.Join(t.TempDir(), "queue.json"), 100),
+		logger:  logger,
+	}
+	m.scheduler = newScheduler(func(ctx context.Context, batch *syncBatch) error { return nil })
+
+	m.queue.Add(&QueueOperation{FilePath: "a.txt", Operation: OperationWrite})
+	m.metrics.observeSync(batchKind(&syncBatch{Paths: []string{"a.txt"}}), 3*time.Second, nil)
+	m.metrics.observeSync(batchKind(&syncBatch{Full: true}), 700*time.Millisecond, errors.New("offline"))
+	m.metrics.watcherEvent(OperationWrite)
+	m.metrics.watcherEvent(OperationWrite)
+	m.metrics.watcherEvent(OperationDelete)
+	m.metrics.setOnline(true)
+
+	recorder := httptest.NewRecorder()
+	m.handleMetrics(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Expected the Prometheus text format, got %s", contentType)
+	}
+
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE catapult_queue_depth gauge",
+		"catapult_queue_depth 1",
+		"catapult_dead_letters 0",
+		"catapult_network_online 1",
+		"# TYPE catapult_sync_duration_seconds histogram",
+		`catapult_sync_duration_seconds_bucket{kind="files",le="2.5"} 0`,
+		`catapult_sync_duration_seconds_bucket{kind="files",le="5"} 1`,
+		`catapult_sync_duration_seconds_bucket{kind="files",le="+Inf"} 1`,
+		`catapult_sync_duration_seconds_sum{kind="files"} 3`,
+		`catapult_sync_duration_seconds_bucket{kind="full",le="1"} 1`,
+		`catapult_sync_failures_total{kind="full"} 1`,
+		`catapult_watcher_events_total{operation="delete"} 1`,
+		`catapult_watcher_events_total{operation="write"} 2`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "catapult_last_successful_sync_timestamp_seconds 0\n") {
+		t.Errorf("Expected the successful sync to be recorded")
+	}
+	if strings.Contains(body, "catapult_github_rate_limit_remaining") {
+		t.Errorf("Expected no rate limit without a repository reporting it")
+	}
+}
@@ -5,60 +5,257 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/itcaat/catapult/internal/storage"
+)
+
+// QueueFileName is the name of the offline queue file in the state directory
+const QueueFileName = "queue.json"
+
+// queueVersion is the current format of the queue file. Version 0 is the
+// unordered map of operations by ID.
+const queueVersion = 1
+
+// resyncID identifies the marker that replaces the queue when it overflows
+const resyncID = "resync"
+
+// Operation types. Every operation is applied by syncing the paths it
+// touches, so the remote ends up matching the local files at that time.
+const (
+	OperationSync   = "sync"   // Sync a path, or everything if it is empty
+	OperationCreate = "create" // A file was created
+	OperationWrite  = "write"  // A file was modified
+	OperationDelete = "delete" // A file or directory was removed
+	OperationRename = "rename" // A file was moved from OldPath to FilePath
 )
 
 // QueueOperation represents a queued sync operation
 type QueueOperation struct {
 	ID        string    `json:"id"`
+	Seq       uint64    `json:"seq"` // Position in the queue, increasing
 	FilePath  string    `json:"file_path"`
-	Operation string    `json:"operation"` // "sync", "delete", "create"
+	OldPath   string    `json:"old_path,omitempty"` // Source of a rename
+	Operation string    `json:"operation"`          // One of the Operation types
 	Timestamp time.Time `json:"timestamp"`
 	Retries   int       `json:"retries"`
 	LastError string    `json:"last_error,omitempty"`
+	Revision  int       `json:"revision,omitempty"` // Bumped when a later operation is merged in
+
+	NextAttempt time.Time `json:"next_attempt,omitempty"` // Not retried before this time
+	FailedAt    time.Time `json:"failed_at,omitempty"`    // When it was given up on
+}
+
+// Paths returns the relative paths the operation touches, or nil if it
+// covers every file
+func (op *QueueOperation) Paths() []string {
+	if op.FilePath == "" {
+		return nil
+	}
+	if op.Operation == OperationRename && op.OldPath != "" {
+		return []string{op.OldPath, op.FilePath}
+	}
+	return []string{op.FilePath}
+}
+
+// IsFullSync reports whether the operation syncs every file
+func (op *QueueOperation) IsFullSync() bool {
+	return op.FilePath == ""
+}
+
+// queueFile is the persisted form of the queue
+type queueFile struct {
+	Version     int               `json:"version"`
+	NextSeq     uint64            `json:"next_seq"`
+	Operations  []*QueueOperation `json:"operations"`
+	DeadLetters []*QueueOperation `json:"dead_letters,omitempty"`
 }
 
-// Queue manages offline sync operations
+// Queue manages offline sync operations in the order they were made. Each
+// path has at most one pending operation: a new operation on a path is
+// merged into the pending one, so a file created, edited and deleted while
+// offline leaves nothing to do.
+//
+// Operations that can't succeed are moved to a dead-letter list, kept until
+// the files sync again or the operations are retried or dropped.
 type Queue struct {
-	operations map[string]*QueueOperation
-	queuePath  string
-	maxSize    int
-	mutex      sync.RWMutex
+	operations  []*QueueOperation // Ordered by Seq
+	deadLetters []*QueueOperation // Ordered by FailedAt
+	nextSeq     uint64
+	queuePath   string
+	maxSize     int // Unlimited if not positive
+	mutex       sync.RWMutex
 }
 
 // NewQueue creates a new offline operations queue
 func NewQueue(queuePath string, maxSize int) *Queue {
 	return &Queue{
-		operations: make(map[string]*QueueOperation),
-		queuePath:  queuePath,
-		maxSize:    maxSize,
+		nextSeq:   1,
+		queuePath: queuePath,
+		maxSize:   maxSize,
 	}
 }
 
-// Add adds a new operation to the queue
+// Add adds a new operation to the queue, merging it with a pending operation
+// on the same path. When the queue is full, everything is replaced by a
+// single full resync, so no change is lost.
 func (q *Queue) Add(operation *QueueOperation) error {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	// Check if queue is at capacity
-	if len(q.operations) >= q.maxSize {
-		// Remove oldest operation
-		q.removeOldest()
+	// Set timestamp if not provided
+	if operation.Timestamp.IsZero() {
+		operation.Timestamp = time.Now()
 	}
 
+	// A pending full sync covers every later change
+	if q.resyncNeeded() {
+		return nil
+	}
+	if operation.IsFullSync() {
+		q.operations = nil
+		q.append(operation)
+		return q.persist()
+	}
+
+	if !q.coalesce(operation) {
+		return q.persist()
+	}
+
+	// Degrade to a full resync rather than dropping operations
+	if q.maxSize > 0 && len(q.operations) >= q.maxSize {
+		q.operations = nil
+		q.append(&QueueOperation{
+			ID:        resyncID,
+			Operation: OperationSync,
+			Timestamp: time.Now(),
+			LastError: fmt.Sprintf("queue exceeded %d operations", q.maxSize),
+		})
+		return q.persist()
+	}
+
+	q.append(operation)
+	return q.persist()
+}
+
+// append adds an operation at the end of the queue
+func (q *Queue) append(operation *QueueOperation) {
+	operation.Seq = q.nextSeq
+	q.nextSeq++
+
 	// Generate ID if not provided
 	if operation.ID == "" {
-		operation.ID = fmt.Sprintf("%s_%d", operation.FilePath, time.Now().UnixNano())
+		operation.ID = strconv.FormatUint(operation.Seq, 10)
 	}
+	q.operations = append(q.operations, operation)
+}
 
-	// Set timestamp if not provided
-	if operation.Timestamp.IsZero() {
-		operation.Timestamp = time.Now()
+// coalesce merges operation into the pending operations on its paths. It
+// reports whether operation still needs to be added; a merged operation
+// keeps the position of the pending one.
+func (q *Queue) coalesce(operation *QueueOperation) bool {
+	if operation.Operation == OperationRename {
+		// Pending changes of either path are covered by the rename, which
+		// syncs both. Other renames are kept, since they sync a third path.
+		if pending := q.find(operation.OldPath); pending != nil && pending.FilePath == operation.OldPath && pending.Operation != OperationRename {
+			q.remove(pending.ID)
+			if pending.Operation == OperationCreate {
+				// The source never reached the remote
+				operation.Operation = OperationCreate
+				operation.OldPath = ""
+			}
+		}
+		if pending := q.find(operation.FilePath); pending != nil && pending.FilePath == operation.FilePath && pending.Operation != OperationRename {
+			q.remove(pending.ID)
+		}
+		return true
 	}
 
-	q.operations[operation.ID] = operation
-	return q.persist()
+	pending := q.find(operation.FilePath)
+	if pending == nil {
+		return true
+	}
+	if pending.FilePath != operation.FilePath {
+		// The path is the source of a pending rename, which syncs it anyway
+		return false
+	}
+
+	switch merged := mergeOperations(pending.Operation, operation.Operation); merged {
+	case "":
+		q.remove(pending.ID)
+	default:
+		pending.Operation = merged
+		pending.Revision++
+	}
+	return false
+}
+
+// mergeOperations returns the net effect of two operations on the same path,
+// or "" if they cancel out
+func mergeOperations(pending, next string) string {
+	switch {
+	case pending == OperationCreate && next == OperationDelete:
+		return ""
+	case next == OperationDelete:
+		if pending == OperationRename {
+			// The source is still gone and the target must be synced
+			return OperationRename
+		}
+		return OperationDelete
+	case pending == OperationDelete:
+		// The file was replaced
+		if next == OperationSync {
+			return OperationSync
+		}
+		return OperationWrite
+	default:
+		// Creates and renames still need their kind, and everything else
+		// is a change of the content
+		return pending
+	}
+}
+
+// find returns the pending operation touching path, if any
+func (q *Queue) find(path string) *QueueOperation {
+	for _, op := range q.operations {
+		if op.FilePath == path || (op.Operation == OperationRename && op.OldPath == path) {
+			return op
+		}
+	}
+	return nil
+}
+
+// remove deletes the operation with the given ID, reporting whether it existed
+func (q *Queue) remove(operationID string) bool {
+	for i, op := range q.operations {
+		if op.ID == operationID {
+			q.operations = append(q.operations[:i], q.operations[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// resyncNeeded reports whether the queue holds a full sync
+func (q *Queue) resyncNeeded() bool {
+	for _, op := range q.operations {
+		if op.IsFullSync() {
+			return true
+		}
+	}
+	return false
+}
+
+// ResyncNeeded reports whether a full sync is pending, for example because
+// the queue overflowed
+func (q *Queue) ResyncNeeded() bool {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return q.resyncNeeded()
 }
 
 // Remove removes an operation from the queue
@@ -66,18 +263,34 @@ func (q *Queue) Remove(operationID string) error {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	delete(q.operations, operationID)
+	q.remove(operationID)
 	return q.persist()
 }
 
-// GetPending returns all pending operations
+// Complete removes an executed operation, unless a later operation was merged
+// into it meanwhile
+func (q *Queue) Complete(operation *QueueOperation) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, op := range q.operations {
+		if op.ID == operation.ID && op.Revision == operation.Revision {
+			q.remove(op.ID)
+			return q.persist()
+		}
+	}
+	return nil
+}
+
+// GetPending returns copies of all pending operations, oldest first
 func (q *Queue) GetPending() []*QueueOperation {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
 
 	operations := make([]*QueueOperation, 0, len(q.operations))
 	for _, op := range q.operations {
-		operations = append(operations, op)
+		copied := *op
+		operations = append(operations, &copied)
 	}
 
 	return operations
@@ -95,12 +308,14 @@ func (q *Queue) UpdateRetry(operationID string, err error) error {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	if op, exists := q.operations[operationID]; exists {
-		op.Retries++
-		if err != nil {
-			op.LastError = err.Error()
+	for _, op := range q.operations {
+		if op.ID == operationID {
+			op.Retries++
+			if err != nil {
+				op.LastError = err.Error()
+			}
+			return q.persist()
 		}
-		return q.persist()
 	}
 
 	return fmt.Errorf("operation %s not found", operationID)
@@ -130,56 +345,274 @@ func (q *Queue) Load() error {
 	}
 
 	// Parse JSON
-	var operations map[string]*QueueOperation
-	if err := json.Unmarshal(data, &operations); err != nil {
+	file, err := decodeQueue(data)
+	if err != nil {
 		return fmt.Errorf("failed to parse queue file: %w", err)
 	}
 
-	q.operations = operations
-	if q.operations == nil {
-		q.operations = make(map[string]*QueueOperation)
+	q.operations = file.Operations
+	q.deadLetters = file.DeadLetters
+	q.nextSeq = file.NextSeq
+	return nil
+}
+
+// decodeQueue parses a queue file, ordering the operations of an older
+// unordered queue by time
+func decodeQueue(data []byte) (*queueFile, error) {
+	var file queueFile
+	if err := json.Unmarshal(data, &file); err == nil && file.Version > 0 {
+		if file.Version > queueVersion {
+			return nil, fmt.Errorf("queue version %d is newer than supported version %d", file.Version, queueVersion)
+		}
+		sort.SliceStable(file.Operations, func(i, j int) bool {
+			return file.Operations[i].Seq < file.Operations[j].Seq
+		})
+		for _, ops := range [][]*QueueOperation{file.Operations, file.DeadLetters} {
+			for _, op := range ops {
+				if op.Seq >= file.NextSeq {
+					file.NextSeq = op.Seq + 1
+				}
+			}
+		}
+		return &file, nil
 	}
 
-	return nil
+	var legacy map[string]*QueueOperation
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, err
+	}
+
+	operations := make([]*QueueOperation, 0, len(legacy))
+	for _, op := range legacy {
+		operations = append(operations, op)
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].Timestamp.Before(operations[j].Timestamp)
+	})
+	for i, op := range operations {
+		op.Seq = uint64(i + 1)
+	}
+	return &queueFile{NextSeq: uint64(len(operations) + 1), Operations: operations}, nil
 }
 
 // persist saves the queue to persistent storage
 func (q *Queue) persist() error {
-	// Create directory if it doesn't exist
-	dir := filepath.Dir(q.queuePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create queue directory: %w", err)
-	}
-
 	// Marshal to JSON
-	data, err := json.MarshalIndent(q.operations, "", "  ")
+	operations := q.operations
+	if operations == nil {
+		operations = []*QueueOperation{}
+	}
+	data, err := json.MarshalIndent(queueFile{
+		Version:     queueVersion,
+		NextSeq:     q.nextSeq,
+		Operations:  operations,
+		DeadLetters: q.deadLetters,
+	}, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal queue: %w", err)
 	}
 
-	// Write to file
-	if err := os.WriteFile(q.queuePath, data, 0644); err != nil {
+	// Write to file; a crash mid-write must not lose the queue
+	if err := storage.WriteDataAtomic(q.queuePath, data); err != nil {
 		return fmt.Errorf("failed to write queue file: %w", err)
 	}
 
 	return nil
 }
 
-// removeOldest removes the oldest operation from the queue
-func (q *Queue) removeOldest() {
-	var oldest *QueueOperation
-	var oldestID string
+// Due returns copies of the pending operations whose next attempt is due,
+// oldest first
+func (q *Queue) Due(now time.Time) []*QueueOperation {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	var due []*QueueOperation
+	for _, op := range q.operations {
+		if !op.NextAttempt.After(now) {
+			copied := *op
+			due = append(due, &copied)
+		}
+	}
+	return due
+}
+
+// RetryLater records a failed attempt of an operation and when to try again
+func (q *Queue) RetryLater(operationID string, err error, next time.Time) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, op := range q.operations {
+		if op.ID == operationID {
+			op.Retries++
+			op.LastError = err.Error()
+			op.NextAttempt = next
+			return q.persist()
+		}
+	}
+
+	return fmt.Errorf("operation %s not found", operationID)
+}
+
+// DeadLetter moves an operation that can't succeed to the dead-letter list
+func (q *Queue) DeadLetter(operationID string, err error) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, op := range q.operations {
+		if op.ID == operationID {
+			q.remove(op.ID)
+			op.LastError = err.Error()
+			q.addDeadLetter(op)
+			return q.persist()
+		}
+	}
+
+	return fmt.Errorf("operation %s not found", operationID)
+}
+
+// addDeadLetter adds an operation to the dead-letter list, replacing older
+// dead letters of the same paths
+func (q *Queue) addDeadLetter(operation *QueueOperation) {
+	operation.FailedAt = time.Now()
+	operation.NextAttempt = time.Time{}
+
+	kept := q.deadLetters[:0]
+	for _, op := range q.deadLetters {
+		if !slices.Equal(op.Paths(), operation.Paths()) {
+			kept = append(kept, op)
+		}
+	}
+	q.deadLetters = append(kept, operation)
+}
+
+// DeadLetters returns copies of the operations that were given up on,
+// oldest first
+func (q *Queue) DeadLetters() []*QueueOperation {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	deadLetters := make([]*QueueOperation, 0, len(q.deadLetters))
+	for _, op := range q.deadLetters {
+		copied := *op
+		deadLetters = append(deadLetters, &copied)
+	}
+	return deadLetters
+}
+
+// ResolveDeadLetters removes the dead letters whose paths all synced. A dead
+// full sync, such as the overflow marker, is resolved once synced("") reports
+// that every file synced.
+func (q *Queue) ResolveDeadLetters(synced func(path string) bool) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	kept := q.deadLetters[:0]
+	for _, op := range q.deadLetters {
+		resolved := !op.IsFullSync() || synced("")
+		for _, path := range op.Paths() {
+			resolved = resolved && synced(path)
+		}
+		if !resolved {
+			kept = append(kept, op)
+		}
+	}
+
+	if len(kept) < len(q.deadLetters) {
+		q.deadLetters = kept
+		return q.persist()
+	}
+	return nil
+}
 
-	for id, op := range q.operations {
-		if oldest == nil || op.Timestamp.Before(oldest.Timestamp) {
-			oldest = op
-			oldestID = id
+// Retry makes an operation due now: a pending one skips its backoff, and a
+// dead letter goes back to the queue with fresh attempts
+func (q *Queue) Retry(operationID string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !q.retry(operationID) {
+		return fmt.Errorf("operation %s not found", operationID)
+	}
+	return q.persist()
+}
+
+// RetryAll makes every pending operation and dead letter due now, returning
+// how many there were
+func (q *Queue) RetryAll() (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var ids []string
+	for _, op := range q.operations {
+		ids = append(ids, op.ID)
+	}
+	for _, op := range q.deadLetters {
+		ids = append(ids, op.ID)
+	}
+	for _, id := range ids {
+		q.retry(id)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return len(ids), q.persist()
+}
+
+// retry makes an operation due now, reporting whether it exists
+func (q *Queue) retry(operationID string) bool {
+	for _, op := range q.operations {
+		if op.ID == operationID {
+			op.NextAttempt = time.Time{}
+			return true
+		}
+	}
+
+	for i, op := range q.deadLetters {
+		if op.ID != operationID {
+			continue
+		}
+		q.deadLetters = append(q.deadLetters[:i], q.deadLetters[i+1:]...)
+		op.Retries = 0
+		op.FailedAt = time.Time{}
+		if op.IsFullSync() {
+			q.operations = nil
+			q.append(op)
+		} else if !q.resyncNeeded() && q.coalesce(op) {
+			q.append(op)
 		}
+		return true
 	}
+	return false
+}
 
-	if oldestID != "" {
-		delete(q.operations, oldestID)
+// Drop removes a pending operation or dead letter
+func (q *Queue) Drop(operationID string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !q.remove(operationID) {
+		found := false
+		for i, op := range q.deadLetters {
+			if op.ID == operationID {
+				q.deadLetters = append(q.deadLetters[:i], q.deadLetters[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("operation %s not found", operationID)
+		}
 	}
+	return q.persist()
+}
+
+// SetMaxSize changes the number of operations kept before the queue
+// collapses into a full resync
+func (q *Queue) SetMaxSize(maxSize int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.maxSize = maxSize
 }
 
 // Clear removes all operations from the queue
@@ -187,7 +620,7 @@ func (q *Queue) Clear() error {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	q.operations = make(map[string]*QueueOperation)
+	q.operations = nil
 	return q.persist()
 }
 
@@ -208,27 +641,18 @@ func (q *Queue) GetOldOperations(maxAge time.Duration) []*QueueOperation {
 	return oldOps
 }
 
-// Cleanup removes operations that are too old or have too many retries
-func (q *Queue) Cleanup(maxAge time.Duration, maxRetries int) error {
-	q.mutex.Lock()
-	defer q.mutex.Unlock()
-
-	cutoff := time.Now().Add(-maxAge)
-	toRemove := make([]string, 0)
+// Exhausted returns the pending operations that used up their attempts,
+// for example because the number of attempts was lowered
+func (q *Queue) Exhausted(maxRetries int) []*QueueOperation {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
 
-	for id, op := range q.operations {
-		if op.Timestamp.Before(cutoff) || op.Retries >= maxRetries {
-			toRemove = append(toRemove, id)
+	var exhausted []*QueueOperation
+	for _, op := range q.operations {
+		if op.Retries >= maxRetries {
+			copied := *op
+			exhausted = append(exhausted, &copied)
 		}
 	}
-
-	for _, id := range toRemove {
-		delete(q.operations, id)
-	}
-
-	if len(toRemove) > 0 {
-		return q.persist()
-	}
-
-	return nil
+	return exhausted
 }
@@ -1,6 +1,8 @@
 package autosync
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -93,9 +95,162 @@ func TestQueue_MaxSize(t *testing.T) {
 		time.Sleep(10 * time.Millisecond) // Ensure different timestamps
 	}
 
-	// Should only have 2 operations (oldest one removed)
-	if queue.Size() != 2 {
-		t.Errorf("Expected queue size 2 after exceeding max size, got %d", queue.Size())
+	// Overflowing degrades to a single full resync instead of dropping work
+	if queue.Size() != 1 || !queue.ResyncNeeded() {
+		t.Errorf("Expected a single resync marker after exceeding max size, got %d operations", queue.Size())
+	}
+
+	// Later operations are covered by the resync
+	queue.Add(&QueueOperation{FilePath: "later.txt", Operation: OperationWrite})
+	if queue.Size() != 1 {
+		t.Errorf("Expected the resync marker to absorb later operations, got %d", queue.Size())
+	}
+}
+
+func TestQueue_Order(t *testing.T) {
+	queuePath := filepath.Join(t.TempDir(), "queue.json")
+	queue := NewQueue(queuePath, 100)
+
+	paths := []string{"c.txt", "a.txt", "b.txt", "d.txt"}
+	for _, path := range paths {
+		if err := queue.Add(&QueueOperation{FilePath: path, Operation: OperationWrite}); err != nil {
+			t.Fatalf("Failed to add operation: %v", err)
+		}
+	}
+
+	// The order survives a restart, and new operations go to the end
+	loaded := NewQueue(queuePath, 100)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Failed to load queue: %v", err)
+	}
+	loaded.Add(&QueueOperation{FilePath: "e.txt", Operation: OperationWrite})
+	paths = append(paths, "e.txt")
+
+	pending := loaded.GetPending()
+	if len(pending) != len(paths) {
+		t.Fatalf("Expected %d pending operations, got %d", len(paths), len(pending))
+	}
+	for i, op := range pending {
+		if op.FilePath != paths[i] {
+			t.Errorf("Expected operation %d to be %s, got %s", i, paths[i], op.FilePath)
+		}
+		if i > 0 && op.Seq <= pending[i-1].Seq {
+			t.Errorf("Expected increasing sequence numbers, got %d after %d", op.Seq, pending[i-1].Seq)
+		}
+	}
+}
+
+func TestQueue_Coalesce(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []QueueOperation
+		want []string // Operation and paths of what is left, in order
+	}{
+		{
+			name: "edits",
+			ops:  []QueueOperation{{FilePath: "a", Operation: OperationWrite}, {FilePath: "b", Operation: OperationWrite}, {FilePath: "a", Operation: OperationWrite}},
+			want: []string{"write [a]", "write [b]"},
+		},
+		{
+			name: "created and deleted",
+			ops:  []QueueOperation{{FilePath: "a", Operation: OperationCreate}, {FilePath: "a", Operation: OperationWrite}, {FilePath: "a", Operation: OperationDelete}},
+			want: []string{},
+		},
+		{
+			name: "edited and deleted",
+			ops:  []QueueOperation{{FilePath: "a", Operation: OperationWrite}, {FilePath: "a", Operation: OperationDelete}},
+			want: []string{"delete [a]"},
+		},
+		{
+			name: "replaced",
+			ops:  []QueueOperation{{FilePath: "a", Operation: OperationDelete}, {FilePath: "a", Operation: OperationCreate}},
+			want: []string{"write [a]"},
+		},
+		{
+			name: "edited and renamed",
+			ops:  []QueueOperation{{FilePath: "a", Operation: OperationWrite}, {FilePath: "b", OldPath: "a", Operation: OperationRename}, {FilePath: "b", Operation: OperationWrite}},
+			want: []string{"rename [a b]"},
+		},
+		{
+			name: "created and renamed",
+			ops:  []QueueOperation{{FilePath: "a", Operation: OperationCreate}, {FilePath: "b", OldPath: "a", Operation: OperationRename}},
+			want: []string{"create [b]"},
+		},
+		{
+			name: "full sync",
+			ops:  []QueueOperation{{FilePath: "a", Operation: OperationWrite}, {Operation: OperationSync}, {FilePath: "b", Operation: OperationWrite}},
+			want: []string{"sync []"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := NewQueue(filepath.Join(t.TempDir(), "queue.json"), 100)
+			for i := range tt.ops {
+				op := tt.ops[i]
+				if err := queue.Add(&op); err != nil {
+					t.Fatalf("Failed to add operation: %v", err)
+				}
+			}
+
+			got := []string{}
+			for _, op := range queue.GetPending() {
+				got = append(got, fmt.Sprintf("%s %v", op.Operation, op.Paths()))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestQueue_LoadLegacy(t *testing.T) {
+	queuePath := filepath.Join(t.TempDir(), "queue.json")
+	legacy := `{
+  "b_2": {"id": "b_2", "file_path": "b.txt", "operation": "sync", "timestamp": "2025-01-02T00:00:00Z"},
+  "a_1": {"id": "a_1", "file_path": "a.txt", "operation": "sync", "timestamp": "2025-01-01T00:00:00Z"}
+}`
+	if err := os.WriteFile(queuePath, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	queue := NewQueue(queuePath, 100)
+	if err := queue.Load(); err != nil {
+		t.Fatalf("Failed to load legacy queue: %v", err)
+	}
+
+	pending := queue.GetPending()
+	if len(pending) != 2 || pending[0].ID != "a_1" || pending[1].ID != "b_2" {
+		t.Errorf("Expected legacy operations ordered by time, got %v", pending)
+	}
+}
+
+func TestQueue_PersistIsAtomic(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	queuePath := filepath.Join(dir, "queue.json")
+	queue := NewQueue(queuePath, 10)
+
+	for i := 0; i < 3; i++ {
+		if err := queue.Add(&QueueOperation{FilePath: fmt.Sprintf("file%d.txt", i), Operation: "sync"}); err != nil {
+			t.Fatalf("Failed to add operation: %v", err)
+		}
+	}
+
+	// Only the queue itself is left behind, no temp files
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "queue.json" {
+		t.Errorf("Expected only queue.json in the state directory, got %v", entries)
+	}
+
+	loaded := NewQueue(queuePath, 10)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Failed to load queue: %v", err)
+	}
+	if loaded.Size() != 3 {
+		t.Errorf("Expected loaded queue size 3, got %d", loaded.Size())
 	}
 }
 
@@ -132,56 +287,29 @@ func TestQueue_UpdateRetry(t *testing.T) {
 	}
 }
 
-func TestQueue_Cleanup(t *testing.T) {
-	tempDir, err := os.MkdirTemp("", "queue_test")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	queuePath := filepath.Join(tempDir, "test_queue.json")
-	queue := NewQueue(queuePath, 10)
+func TestQueue_Exhausted(t *testing.T) {
+	queue := NewQueue(filepath.Join(t.TempDir(), "test_queue.json"), 10)
 
-	// Add old operation
-	oldOp := &QueueOperation{
+	// An old operation still has attempts left
+	queue.Add(&QueueOperation{
 		ID:        "old_op",
 		FilePath:  "old.txt",
 		Operation: "sync",
-		Timestamp: time.Now().Add(-25 * time.Hour), // 25 hours ago
-	}
-	queue.Add(oldOp)
-
-	// Add operation with too many retries
-	retryOp := &QueueOperation{
+		Timestamp: time.Now().Add(-72 * time.Hour),
+	})
+	queue.Add(&QueueOperation{
 		ID:        "retry_op",
 		FilePath:  "retry.txt",
 		Operation: "sync",
 		Retries:   5,
-	}
-	queue.Add(retryOp)
+	})
 
-	// Add normal operation
-	normalOp := &QueueOperation{
-		ID:        "normal_op",
-		FilePath:  "normal.txt",
-		Operation: "sync",
+	exhausted := queue.Exhausted(3)
+	if len(exhausted) != 1 || exhausted[0].ID != "retry_op" {
+		t.Errorf("Expected only retry_op to be out of attempts, got %v", exhausted)
 	}
-	queue.Add(normalOp)
-
-	// Cleanup operations older than 24 hours or with more than 3 retries
-	err = queue.Cleanup(24*time.Hour, 3)
-	if err != nil {
-		t.Errorf("Failed to cleanup queue: %v", err)
-	}
-
-	// Should only have the normal operation left
-	if queue.Size() != 1 {
-		t.Errorf("Expected 1 operation after cleanup, got %d", queue.Size())
-	}
-
-	pending := queue.GetPending()
-	if len(pending) != 1 || pending[0].ID != "normal_op" {
-		t.Error("Expected only normal_op to remain after cleanup")
+	if queue.Size() != 2 {
+		t.Errorf("Expected listing exhausted operations to leave the queue alone, got %d", queue.Size())
 	}
 }
 
@@ -251,3 +379,160 @@ func TestQueue_Clear(t *testing.T) {
 		t.Errorf("Expected queue size 0 after clear, got %d", queue.Size())
 	}
 }
+
+func TestQueueOperation_Paths(t *testing.T) {
+	rename := &QueueOperation{FilePath: "new.txt", OldPath: "old.txt", Operation: OperationRename}
+	if paths := rename.Paths(); len(paths) != 2 || paths[0] != "old.txt" || paths[1] != "new.txt" {
+		t.Errorf("Expected a rename to touch both paths, got %v", paths)
+	}
+
+	deletion := &QueueOperation{FilePath: "gone.txt", Operation: OperationDelete}
+	if paths := deletion.Paths(); len(paths) != 1 || paths[0] != "gone.txt" {
+		t.Errorf("Expected a deletion to touch its path, got %v", paths)
+	}
+
+	full := &QueueOperation{Operation: OperationSync}
+	if paths := full.Paths(); paths != nil {
+		t.Errorf("Expected a full sync to cover every file, got %v", paths)
+	}
+}
+
+func TestQueue_Complete(t *testing.T) {
+	queue := NewQueue(filepath.Join(t.TempDir(), "queue.json"), 100)
+	queue.Add(&QueueOperation{FilePath: "a.txt", Operation: OperationWrite})
+	executing := queue.GetPending()[0]
+
+	// A deletion merged in while the write runs must not be lost
+	queue.Add(&QueueOperation{FilePath: "a.txt", Operation: OperationDelete})
+	queue.Complete(executing)
+	pending := queue.GetPending()
+	if len(pending) != 1 || pending[0].Operation != OperationDelete {
+		t.Fatalf("Expected the merged deletion to stay queued, got %v", pending)
+	}
+
+	queue.Complete(pending[0])
+	if queue.Size() != 0 {
+		t.Errorf("Expected the completed operation to be removed, got %d", queue.Size())
+	}
+}
+
+func TestQueue_RetryAndDeadLetter(t *testing.T) {
+	queuePath := filepath.Join(t.TempDir(), "queue.json")
+	queue := NewQueue(queuePath, 100)
+	queue.Add(&QueueOperation{ID: "big", FilePath: "big.bin", Operation: OperationWrite})
+	queue.Add(&QueueOperation{ID: "flaky", FilePath: "flaky.txt", Operation: OperationWrite})
+
+	// An operation waiting for its next attempt isn't due
+	now := time.Now()
+	if err := queue.RetryLater("flaky", errors.New("timeout"), now.Add(time.Minute)); err != nil {
+		t.Fatalf("Failed to reschedule operation: %v", err)
+	}
+	due := queue.Due(now)
+	if len(due) != 1 || due[0].ID != "big" {
+		t.Errorf("Expected only big to be due, got %v", due)
+	}
+	if due := queue.Due(now.Add(2 * time.Minute)); len(due) != 2 {
+		t.Errorf("Expected both operations to be due later, got %d", len(due))
+	}
+
+	// Dead letters survive a restart
+	if err := queue.DeadLetter("big", errors.New("too large")); err != nil {
+		t.Fatalf("Failed to dead-letter operation: %v", err)
+	}
+	loaded := NewQueue(queuePath, 100)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Failed to load queue: %v", err)
+	}
+	deadLetters := loaded.DeadLetters()
+	if loaded.Size() != 1 || len(deadLetters) != 1 || deadLetters[0].LastError != "too large" || deadLetters[0].FailedAt.IsZero() {
+		t.Fatalf("Expected big to be dead-lettered, got %v", deadLetters)
+	}
+
+	// A dead letter is resolved once its file syncs
+	loaded.ResolveDeadLetters(func(path string) bool { return path == "other.txt" })
+	if len(loaded.DeadLetters()) != 1 {
+		t.Errorf("Expected the dead letter to stay until its file syncs")
+	}
+	loaded.ResolveDeadLetters(func(path string) bool { return path == "big.bin" })
+	if len(loaded.DeadLetters()) != 0 {
+		t.Errorf("Expected the dead letter to be resolved")
+	}
+
+	// A dead full sync is resolved by a full sync
+	loaded.Add(&QueueOperation{Operation: OperationSync})
+	pending := loaded.GetPending()
+	loaded.DeadLetter(pending[len(pending)-1].ID, errors.New("offline"))
+	loaded.ResolveDeadLetters(func(path string) bool { return path != "" })
+	if len(loaded.DeadLetters()) != 1 {
+		t.Errorf("Expected the dead full sync to stay until everything syncs")
+	}
+	loaded.ResolveDeadLetters(func(path string) bool { return true })
+	if len(loaded.DeadLetters()) != 0 {
+		t.Errorf("Expected the dead full sync to be resolved")
+	}
+}
+
+func TestQueue_RetryAndDrop(t *testing.T) {
+	queue := NewQueue(filepath.Join(t.TempDir(), "queue.json"), 100)
+	queue.Add(&QueueOperation{ID: "waiting", FilePath: "waiting.txt", Operation: OperationWrite})
+	queue.Add(&QueueOperation{ID: "dead", FilePath: "dead.txt", Operation: OperationWrite})
+	queue.Add(&QueueOperation{ID: "unwanted", FilePath: "unwanted.txt", Operation: OperationWrite})
+
+	now := time.Now()
+	queue.RetryLater("waiting", errors.New("timeout"), now.Add(time.Hour))
+	queue.DeadLetter("dead", errors.New("too large"))
+
+	// Retrying skips the backoff of a pending operation
+	if err := queue.Retry("waiting"); err != nil {
+		t.Fatalf("Failed to retry operation: %v", err)
+	}
+	if due := queue.Due(now); len(due) != 2 {
+		t.Errorf("Expected the retried operation to be due, got %v", due)
+	}
+
+	// Retrying a dead letter queues it again with fresh attempts
+	if err := queue.Retry("dead"); err != nil {
+		t.Fatalf("Failed to retry dead letter: %v", err)
+	}
+	if len(queue.DeadLetters()) != 0 || queue.Size() != 3 {
+		t.Fatalf("Expected the dead letter to be queued again, got %d pending and %d dead letters", queue.Size(), len(queue.DeadLetters()))
+	}
+	if pending := queue.GetPending(); pending[2].FilePath != "dead.txt" || pending[2].Retries != 0 {
+		t.Errorf("Expected dead.txt to be queued last with no retries, got %+v", pending[2])
+	}
+
+	if err := queue.Drop("unwanted"); err != nil {
+		t.Fatalf("Failed to drop operation: %v", err)
+	}
+	if queue.Size() != 2 {
+		t.Errorf("Expected 2 operations after dropping one, got %d", queue.Size())
+	}
+
+	if err := queue.Retry("missing"); err == nil {
+		t.Errorf("Expected retrying an unknown operation to fail")
+	}
+	if err := queue.Drop("missing"); err == nil {
+		t.Errorf("Expected dropping an unknown operation to fail")
+	}
+}
+
+func TestQueue_RetryAll(t *testing.T) {
+	queue := NewQueue(filepath.Join(t.TempDir(), "queue.json"), 100)
+	queue.Add(&QueueOperation{ID: "a", FilePath: "a.txt", Operation: OperationWrite})
+	queue.Add(&QueueOperation{ID: "b", FilePath: "b.txt", Operation: OperationWrite})
+
+	now := time.Now()
+	queue.RetryLater("a", errors.New("timeout"), now.Add(time.Hour))
+	queue.DeadLetter("b", errors.New("too large"))
+
+	count, err := queue.RetryAll()
+	if err != nil {
+		t.Fatalf("Failed to retry all operations: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 operations to be retried, got %d", count)
+	}
+	if due := queue.Due(now); len(due) != 2 || len(queue.DeadLetters()) != 0 {
+		t.Errorf("Expected every operation to be due, got %v", due)
+	}
+}
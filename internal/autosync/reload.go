@@ -0,0 +1,92 @@
+package autosync
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/itcaat/catapult/internal/config"
+)
+
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 2 * time.Second
+
+// watchConfigFile applies changes to the autosync section of the config file
+// while running. An invalid file is reported and the current settings kept.
+func (m *Manager) watchConfigFile(ctx context.Context) {
+	configPath, err := config.Path()
+	if err != nil {
+		m.logger.Printf("Config reload disabled: %v", err)
+		return
+	}
+	lastInfo, _ := os.Stat(configPath)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(configPath)
+		if err != nil || !fileChanged(lastInfo, info) {
+			continue
+		}
+		lastInfo = info
+
+		if err := m.reloadConfig(); err != nil {
+			m.logger.Printf("Ignoring changed config, keeping current settings: %v", err)
+		}
+	}
+}
+
+// reloadConfig reads the config file again and applies its autosync section
+func (m *Manager) reloadConfig() error {
+	appConfig, err := config.Load()
+	if err != nil {
+		return err
+	}
+	m.applyConfig(NewConfig(&appConfig.AutoSync))
+	return nil
+}
+
+// fileChanged reports whether a file was modified between two stats
+func fileChanged(before, after os.FileInfo) bool {
+	if before == nil {
+		return true
+	}
+	return !before.ModTime().Equal(after.ModTime()) || before.Size() != after.Size()
+}
+
+// applyConfig switches to new auto-sync settings. Turning auto-sync, the file
+// watcher or the offline queue on or off only takes effect after a restart.
+func (m *Manager) applyConfig(newConfig *Config) {
+	m.configMu.Lock()
+	oldConfig := m.config
+	if newConfig.Enabled != oldConfig.Enabled || newConfig.WatchLocalChanges != oldConfig.WatchLocalChanges || newConfig.OfflineQueue != oldConfig.OfflineQueue {
+		m.logger.Printf("Restart auto-sync to turn auto-sync, file watching or the offline queue on or off")
+		newConfig.Enabled = oldConfig.Enabled
+		newConfig.WatchLocalChanges = oldConfig.WatchLocalChanges
+		newConfig.OfflineQueue = oldConfig.OfflineQueue
+	}
+	m.config = newConfig
+	m.configMu.Unlock()
+
+	if reflect.DeepEqual(newConfig, oldConfig) {
+		return
+	}
+
+	m.watcher.SetConfig(NewWatchConfig(newConfig))
+	m.queue.SetMaxSize(newConfig.MaxQueueSize)
+	select {
+	case m.configChanged <- struct{}{}:
+	default:
+	}
+
+	m.logger.Printf("Applied new auto-sync settings: check remote every %s, debounce %s, %d retry attempts, queue up to %d operations, %s notifications",
+		newConfig.CheckRemoteInterval, newConfig.DebounceDelay, newConfig.RetryAttempts, newConfig.MaxQueueSize, newConfig.NotificationLevel)
+}
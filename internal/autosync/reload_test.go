@@ -0,0 +1,80 @@
+package autosync
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/itcaat/catapult/internal/config"
+)
+
+func TestNewConfig(t *testing.T) {
+	disabled := false
+	autoSyncConfig := NewConfig(&config.AutoSyncConfig{
+		WatchLocalChanges: &disabled,
+		RetryAttempts:     7,
+		IgnorePatterns:    []string{"*.bak"},
+	})
+
+	if !autoSyncConfig.Enabled || autoSyncConfig.WatchLocalChanges {
+		t.Errorf("Expected only the file watcher to be turned off, got %+v", autoSyncConfig)
+	}
+	if autoSyncConfig.RetryAttempts != 7 || autoSyncConfig.DebounceDelay != 2*time.Second {
+		t.Errorf("Expected configured retries and default debounce, got %+v", autoSyncConfig)
+	}
+
+	watchConfig := NewWatchConfig(autoSyncConfig)
+	if !watchConfig.ShouldIgnore("notes/draft.bak") || !watchConfig.ShouldIgnore("node_modules") {
+		t.Errorf("Expected configured patterns to be added to the built-in ones")
+	}
+}
+
+func TestManager_ApplyConfig(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	watcher, err := NewWatcher(DefaultWatchConfig(), logger)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	m := &Manager{
+		config:        DefaultConfig(),
+		watcher:       watcher,
+		queue:         NewQueue(filepath.Join(t.TempDir(), "queue.json"), 100),
+		logger:        logger,
+		configChanged: make(chan struct{}, 1),
+	}
+
+	newConfig := DefaultConfig()
+	newConfig.CheckRemoteInterval = time.Minute
+	newConfig.NotificationLevel = "silent"
+	newConfig.MaxQueueSize = 1
+	newConfig.OfflineQueue = false
+	newConfig.IgnorePatterns = []string{"*.bak"}
+	m.applyConfig(newConfig)
+
+	settings := m.settings()
+	if settings.CheckRemoteInterval != time.Minute || settings.NotificationLevel != "silent" {
+		t.Errorf("Expected new settings to apply, got %+v", settings)
+	}
+	if !settings.OfflineQueue {
+		t.Errorf("Expected turning the offline queue off to wait for a restart")
+	}
+	if !watcher.shouldIgnore("draft.bak") {
+		t.Errorf("Expected new ignore patterns to apply to the watcher")
+	}
+	select {
+	case <-m.configChanged:
+	default:
+		t.Errorf("Expected the remote check to be told about the change")
+	}
+
+	// The new queue size applies
+	m.queue.Add(&QueueOperation{FilePath: "a.txt", Operation: OperationWrite})
+	m.queue.Add(&QueueOperation{FilePath: "b.txt", Operation: OperationWrite})
+	if !m.queue.ResyncNeeded() {
+		t.Errorf("Expected the smaller queue to overflow into a full resync")
+	}
+}
@@ -0,0 +1,65 @@
+package autosync
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/itcaat/catapult/internal/repository"
+	"github.com/itcaat/catapult/internal/sync"
+)
+
+// Backoff bounds for retrying queued operations
+const (
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = time.Hour
+)
+
+// retryDelay returns how long to wait before the given retry of an
+// operation: exponential backoff with jitter, so operations that failed
+// together don't all retry at once
+func retryDelay(retries int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < retries && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+
+	// Wait between half and all of the delay
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// unknownOperationError is returned for operations written by a newer version
+type unknownOperationError struct {
+	operation string
+}
+
+func (e *unknownOperationError) Error() string {
+	return fmt.Sprintf("unknown operation type: %s", e.operation)
+}
+
+// isPermanent reports whether err can't go away by retrying, such as a file
+// exceeding GitHub's size limit. A sync where some files failed is permanent
+// only if all of them failed permanently.
+func isPermanent(err error) bool {
+	var fileErrs sync.FileErrors
+	if errors.As(err, &fileErrs) {
+		if len(fileErrs) == 0 {
+			return false
+		}
+		for _, fileErr := range fileErrs {
+			if !isPermanent(fileErr) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var sizeErr *repository.FileSizeError
+	var validationErr *repository.GitHubValidationError
+	var unknownErr *unknownOperationError
+	return errors.As(err, &sizeErr) || errors.As(err, &validationErr) || errors.As(err, &unknownErr)
+}
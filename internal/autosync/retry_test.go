@@ -0,0 +1,53 @@
+package autosync
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/itcaat/catapult/internal/repository"
+	"github.com/itcaat/catapult/internal/sync"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		retries int
+		max     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{20, time.Hour},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			delay := retryDelay(tt.retries)
+			if delay < tt.max/2 || delay > tt.max {
+				t.Fatalf("retryDelay(%d) = %v, want between %v and %v", tt.retries, delay, tt.max/2, tt.max)
+			}
+		}
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	sizeErr := &repository.FileSizeError{FilePath: "big.bin", FileSize: 200 << 20, Limit: 100 << 20}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("connection reset"), false},
+		{sizeErr, true},
+		{fmt.Errorf("failed to upload: %w", &repository.GitHubValidationError{FilePath: "a"}), true},
+		{sync.FileErrors{"big.bin": sizeErr}, true},
+		{sync.FileErrors{"big.bin": sizeErr, "a.txt": errors.New("timeout")}, false},
+		{&unknownOperationError{"chown"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := isPermanent(tt.err); got != tt.want {
+			t.Errorf("isPermanent(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package autosync
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// syncBatch is a set of coalesced sync requests run as one sync
+type syncBatch struct {
+	Full     bool     // Sync everything; Paths only lists what was asked for
+	Pull     bool     // Sync the files changed remotely
+	Paths    []string // Relative paths to sync, sorted
+	Detached []string // Paths nobody waits for, to queue if the sync fails
+}
+
+// scheduler serializes syncs: requests made while a sync runs are coalesced
+// into the next one, so at most one sync touches the state at a time
+type scheduler struct {
+	run func(ctx context.Context, batch *syncBatch) error
+
+	mu       sync.Mutex
+	paused   bool
+	full     bool
+	pull     bool
+	paths    map[string]bool
+	detached map[string]bool
+	waiters  []chan error
+	wake     chan struct{}
+}
+
+// newScheduler creates a scheduler running batches with run
+func newScheduler(run func(ctx context.Context, batch *syncBatch) error) *scheduler {
+	return &scheduler{
+		run:      run,
+		paths:    make(map[string]bool),
+		detached: make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Schedule requests a sync of relPaths, or of everything if there are none,
+// without waiting for it
+func (s *scheduler) Schedule(relPaths ...string) {
+	s.add(relPaths, true, nil)
+}
+
+// Sync requests a sync of relPaths, or of everything if there are none, and
+// waits until a sync covering them finished
+func (s *scheduler) Sync(ctx context.Context, relPaths ...string) error {
+	done := make(chan error, 1)
+	s.add(relPaths, false, done)
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pull requests a sync of the files changed remotely, without waiting for it
+func (s *scheduler) Pull() {
+	s.mu.Lock()
+	s.pull = true
+	s.mu.Unlock()
+	s.wakeUp()
+}
+
+// SetPaused holds back syncs while paused; requests keep being collected and
+// run once resumed
+func (s *scheduler) SetPaused(paused bool) {
+	s.mu.Lock()
+	s.paused = paused
+	s.mu.Unlock()
+	s.wakeUp()
+}
+
+// Paused reports whether syncs are held back
+func (s *scheduler) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// add records a request and wakes the scheduler
+func (s *scheduler) add(relPaths []string, detached bool, done chan error) {
+	s.mu.Lock()
+	if len(relPaths) == 0 {
+		s.full = true
+	}
+	for _, relPath := range relPaths {
+		s.paths[relPath] = true
+		if detached {
+			s.detached[relPath] = true
+		}
+	}
+	if done != nil {
+		s.waiters = append(s.waiters, done)
+	}
+	s.mu.Unlock()
+	s.wakeUp()
+}
+
+// wakeUp tells Run that requests are pending
+func (s *scheduler) wakeUp() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take removes the pending requests, returning nil if there are none or
+// syncs are paused
+func (s *scheduler) take() (*syncBatch, []chan error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.paused {
+		return nil, nil
+	}
+	if !s.full && !s.pull && len(s.paths) == 0 {
+		return nil, nil
+	}
+
+	batch := &syncBatch{Full: s.full, Pull: s.pull}
+	for path := range s.paths {
+		batch.Paths = append(batch.Paths, path)
+	}
+	for path := range s.detached {
+		batch.Detached = append(batch.Detached, path)
+	}
+	sort.Strings(batch.Paths)
+	sort.Strings(batch.Detached)
+	waiters := s.waiters
+
+	s.full = false
+	s.pull = false
+	s.paths = make(map[string]bool)
+	s.detached = make(map[string]bool)
+	s.waiters = nil
+	return batch, waiters
+}
+
+// Run executes requested syncs one at a time until ctx is cancelled
+func (s *scheduler) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		}
+
+		batch, waiters := s.take()
+		if batch == nil {
+			continue
+		}
+
+		err := s.run(ctx, batch)
+		for _, done := range waiters {
+			done <- err
+		}
+	}
+}
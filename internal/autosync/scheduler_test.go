@@ -0,0 +1,155 @@
+package autosync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler_Serializes(t *testing.T) {
+	var running, overlaps int32
+	var mu sync.Mutex
+	synced := make(map[string]bool)
+
+	s := newScheduler(func(ctx context.Context, batch *syncBatch) error {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		defer atomic.AddInt32(&running, -1)
+
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		for _, path := range batch.Paths {
+			synced[path] = true
+		}
+		mu.Unlock()
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go s.Run(ctx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("file%d.txt", i)
+			if err := s.Sync(ctx, path); err != nil {
+				t.Errorf("Expected sync of %s to succeed, got %v", path, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if overlaps > 0 {
+		t.Errorf("Expected syncs to run one at a time, %d overlapped", overlaps)
+	}
+	if len(synced) != 20 {
+		t.Errorf("Expected 20 files to be synced, got %d", len(synced))
+	}
+}
+
+func TestScheduler_Coalesces(t *testing.T) {
+	release := make(chan struct{})
+	batches := make(chan *syncBatch, 10)
+
+	s := newScheduler(func(ctx context.Context, batch *syncBatch) error {
+		batches <- batch
+		<-release
+		return errors.New("offline")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go s.Run(ctx)
+
+	// Requests made while a sync runs end up in the next batch
+	s.Schedule("first.txt")
+	<-batches
+	s.Schedule("a.txt")
+	s.Schedule("b.txt")
+	s.Schedule("a.txt")
+	s.Schedule()
+	result := make(chan error, 1)
+	go func() { result <- s.Sync(ctx, "c.txt") }()
+
+	// Let the waiting request register before the running sync finishes
+	time.Sleep(50 * time.Millisecond)
+	release <- struct{}{}
+
+	batch := <-batches
+	if !batch.Full {
+		t.Errorf("Expected a full sync request to make the batch full")
+	}
+	if fmt.Sprint(batch.Paths) != "[a.txt b.txt c.txt]" {
+		t.Errorf("Expected coalesced paths, got %v", batch.Paths)
+	}
+	if fmt.Sprint(batch.Detached) != "[a.txt b.txt]" {
+		t.Errorf("Expected only unwaited paths to be detached, got %v", batch.Detached)
+	}
+	release <- struct{}{}
+
+	if err := <-result; err == nil || err.Error() != "offline" {
+		t.Errorf("Expected the sync error to reach the waiter, got %v", err)
+	}
+}
+
+func TestScheduler_Pull(t *testing.T) {
+	batches := make(chan *syncBatch, 10)
+	s := newScheduler(func(ctx context.Context, batch *syncBatch) error {
+		batches <- batch
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A pull alone syncs neither everything nor any local paths
+	s.Pull()
+	s.Pull()
+	go s.Run(ctx)
+
+	batch := <-batches
+	if !batch.Pull || batch.Full || len(batch.Paths) != 0 {
+		t.Errorf("Expected a pull-only batch, got %+v", batch)
+	}
+
+	s.Schedule("a.txt")
+	if batch := <-batches; batch.Pull {
+		t.Errorf("Expected the pull to be taken by the first batch, got %+v", batch)
+	}
+}
+
+func TestScheduler_Pause(t *testing.T) {
+	batches := make(chan *syncBatch, 10)
+	s := newScheduler(func(ctx context.Context, batch *syncBatch) error {
+		batches <- batch
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go s.Run(ctx)
+
+	// Requests made while paused are held back and run once resumed
+	s.SetPaused(true)
+	s.Schedule("a.txt")
+	s.Schedule("b.txt")
+	select {
+	case batch := <-batches:
+		t.Fatalf("Expected no sync while paused, got %+v", batch)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	s.SetPaused(false)
+	batch := <-batches
+	if fmt.Sprint(batch.Paths) != "[a.txt b.txt]" {
+		t.Errorf("Expected held back requests to run together, got %v", batch.Paths)
+	}
+}
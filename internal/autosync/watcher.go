@@ -3,12 +3,17 @@ package autosync
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"log"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+
+	"github.com/itcaat/catapult/internal/storage"
 )
 
 // WatchConfig holds configuration for file watching
@@ -24,6 +29,7 @@ func DefaultWatchConfig() *WatchConfig {
 		IgnorePatterns: []string{
 			".git/",
 			".catapult/",
+			storage.TempFilePrefix, // Downloads in progress
 			"*.tmp",
 			"*.swp",
 			"*.swo",
@@ -37,12 +43,31 @@ func DefaultWatchConfig() *WatchConfig {
 	}
 }
 
-// Watcher monitors file system changes
+// NewWatchConfig creates the watch configuration for auto-sync settings: the
+// built-in ignore patterns plus the configured ones
+func NewWatchConfig(settings *Config) *WatchConfig {
+	watchConfig := DefaultWatchConfig()
+	watchConfig.DebounceDelay = settings.DebounceDelay
+	watchConfig.IgnorePatterns = append(watchConfig.IgnorePatterns, settings.IgnorePatterns...)
+	return watchConfig
+}
+
+// renamePairWindow is how soon after a rename the create of the new name
+// must arrive to be reported as a single rename
+const renamePairWindow = 100 * time.Millisecond
+
+// Watcher monitors file system changes in a directory tree. fsnotify only
+// watches single directories, so every subdirectory gets its own watch.
 type Watcher struct {
 	fsWatcher *fsnotify.Watcher
 	debouncer *Debouncer
 	config    *WatchConfig
+	configMu  sync.RWMutex
 	logger    *log.Logger
+
+	root    string
+	watched map[string]bool
+	mutex   sync.Mutex
 }
 
 // NewWatcher creates a new file watcher
@@ -63,17 +88,26 @@ func NewWatcher(config *WatchConfig, logger *log.Logger) (*Watcher, error) {
 		debouncer: debouncer,
 		config:    config,
 		logger:    logger,
+		watched:   make(map[string]bool),
 	}, nil
 }
 
-// Watch starts watching the specified directory for changes
+// Watch starts watching the specified directory and its subdirectories for
+// changes. Directories created later are watched as they appear.
 func (w *Watcher) Watch(ctx context.Context, directory string, callback func(FileEvent)) error {
-	// Add directory to watcher
-	if err := w.fsWatcher.Add(directory); err != nil {
+	w.root = filepath.Clean(directory)
+
+	// Add the directory tree to the watcher
+	if _, err := w.addTree(w.root); err != nil {
 		return fmt.Errorf("failed to add directory to watcher: %w", err)
 	}
 
-	w.logger.Printf("Started watching directory: %s", directory)
+	w.logger.Printf("Started watching directory: %s (%d directories)", directory, w.WatchedCount())
+
+	// fsnotify reports a rename as a rename of the old name followed by a
+	// create of the new one
+	var renamed string
+	var renamedAt time.Time
 
 	for {
 		select {
@@ -84,15 +118,28 @@ func (w *Watcher) Watch(ctx context.Context, directory string, callback func(Fil
 
 			w.logger.Printf("File event: %s %s", event.Op, event.Name)
 
-			// Use debouncer to group rapid changes
-			w.debouncer.Add(event.Name, func() {
-				fileEvent := FileEvent{
-					Path:      event.Name,
-					Op:        event.Op,
-					Timestamp: time.Now(),
+			if event.Op&fsnotify.Create != 0 {
+				if w.handleNewDirectory(event.Name, callback) {
+					continue
 				}
-				callback(fileEvent)
-			})
+				if renamed != "" && time.Since(renamedAt) < renamePairWindow {
+					w.debouncer.Cancel(renamed)
+					w.notifyRename(renamed, event.Name, callback)
+					renamed = ""
+					continue
+				}
+			}
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				w.forgetTree(event.Name)
+			}
+
+			// Without a matching create, the file was moved out of the tree
+			renamed = ""
+			if event.Op&fsnotify.Rename != 0 {
+				renamed, renamedAt = event.Name, time.Now()
+			}
+
+			w.notify(event.Name, event.Op, callback)
 
 		case err := <-w.fsWatcher.Errors:
 			w.logger.Printf("Watcher error: %v", err)
@@ -105,13 +152,143 @@ func (w *Watcher) Watch(ctx context.Context, directory string, callback func(Fil
 	}
 }
 
-// shouldIgnore checks if a file path should be ignored based on patterns
+// notify reports a change through the debouncer, which groups rapid changes
+func (w *Watcher) notify(path string, op fsnotify.Op, callback func(FileEvent)) {
+	w.debouncer.Add(path, func() {
+		callback(FileEvent{
+			Path:      path,
+			Op:        op,
+			Timestamp: time.Now(),
+		})
+	})
+}
+
+// notifyRename reports a file moved within the tree under its new path
+func (w *Watcher) notifyRename(oldPath, path string, callback func(FileEvent)) {
+	w.debouncer.Add(path, func() {
+		callback(FileEvent{
+			Path:      path,
+			OldPath:   oldPath,
+			Op:        fsnotify.Rename,
+			Timestamp: time.Now(),
+		})
+	})
+}
+
+// handleNewDirectory watches a newly created directory and reports the files
+// already inside it, which were created before its watch existed. It reports
+// whether path is a directory.
+func (w *Watcher) handleNewDirectory(path string, callback func(FileEvent)) bool {
+	info, err := os.Lstat(path)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+
+	files, err := w.addTree(path)
+	if err != nil {
+		w.logger.Printf("Failed to watch new directory %s: %v", path, err)
+	}
+	for _, file := range files {
+		w.notify(file, fsnotify.Create, callback)
+	}
+	return true
+}
+
+// addTree watches dir and every subdirectory not excluded by the ignore
+// patterns, returning the files found along the way. Subdirectories that
+// can't be watched are logged and skipped.
+func (w *Watcher) addTree(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			w.logger.Printf("Warning: skipping %s: %v", path, err)
+			return nil
+		}
+		if path != w.root && w.shouldIgnore(path) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() {
+			if entry.Type().IsRegular() {
+				files = append(files, path)
+			}
+			return nil
+		}
+
+		if err := w.fsWatcher.Add(path); err != nil {
+			if path == dir {
+				return err
+			}
+			w.logger.Printf("Warning: failed to watch %s: %v", path, err)
+			return filepath.SkipDir
+		}
+		w.mutex.Lock()
+		w.watched[path] = true
+		w.mutex.Unlock()
+		return nil
+	})
+	return files, err
+}
+
+// forgetTree drops the watches of a removed or renamed directory and its
+// subdirectories
+func (w *Watcher) forgetTree(path string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	prefix := path + string(filepath.Separator)
+	for dir := range w.watched {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			// The kernel usually dropped the watch already
+			w.fsWatcher.Remove(dir)
+			delete(w.watched, dir)
+		}
+	}
+}
+
+// WatchedCount returns the number of directories being watched
+func (w *Watcher) WatchedCount() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.watched)
+}
+
+// shouldIgnore checks if a file path should be ignored based on patterns,
+// matched against the path relative to the watched directory
 func (w *Watcher) shouldIgnore(path string) bool {
+	if w.root != "" {
+		if relPath, err := filepath.Rel(w.root, path); err == nil {
+			path = relPath
+		}
+	}
+	w.configMu.RLock()
+	defer w.configMu.RUnlock()
+	return w.config.ShouldIgnore(path)
+}
+
+// SetConfig applies a new configuration. The ignore patterns apply to changes
+// from now on; directories already watched stay watched.
+func (w *Watcher) SetConfig(config *WatchConfig) {
+	w.configMu.Lock()
+	w.config = config
+	w.configMu.Unlock()
+
+	w.debouncer.SetDelay(config.DebounceDelay)
+}
+
+// ShouldIgnore checks if a path relative to the watched directory matches
+// the ignore patterns
+func (c *WatchConfig) ShouldIgnore(path string) bool {
 	// Get relative path components
 	relPath := filepath.Base(path)
 	fullPath := filepath.Clean(path)
 
-	for _, pattern := range w.config.IgnorePatterns {
+	for _, pattern := range c.IgnorePatterns {
 		// Check exact match
 		if pattern == relPath {
 			return true
@@ -150,10 +327,19 @@ func (w *Watcher) Close() error {
 
 // AddPath adds a new path to watch
 func (w *Watcher) AddPath(path string) error {
-	return w.fsWatcher.Add(path)
+	if err := w.fsWatcher.Add(path); err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	w.watched[filepath.Clean(path)] = true
+	w.mutex.Unlock()
+	return nil
 }
 
 // RemovePath removes a path from watching
 func (w *Watcher) RemovePath(path string) error {
+	w.mutex.Lock()
+	delete(w.watched, filepath.Clean(path))
+	w.mutex.Unlock()
 	return w.fsWatcher.Remove(path)
 }
@@ -0,0 +1,216 @@
+package autosync
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/itcaat/catapult/internal/storage"
+)
+
+// waitForEvent waits until the watcher reports path
+func waitForEvent(t *testing.T, events <-chan FileEvent, path string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Path == path {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("No event received for %s", path)
+		}
+	}
+}
+
+// nextEvent waits for the next event the watcher reports
+func nextEvent(t *testing.T, events <-chan FileEvent) FileEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("No event received")
+		return FileEvent{}
+	}
+}
+
+// waitFor polls until condition holds
+func waitFor(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", description)
+}
+
+func TestWatcher_Recursive(t *testing.T) {
+	root := t.TempDir()
+	deep := filepath.Join(root, "notes", "deep")
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "node_modules", "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultWatchConfig()
+	config.DebounceDelay = 20 * time.Millisecond
+	watcher, err := NewWatcher(config, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan FileEvent, 100)
+	go watcher.Watch(ctx, root, func(event FileEvent) { events <- event })
+
+	// Root, notes and notes/deep, but not the ignored node_modules
+	waitFor(t, "initial watches", func() bool { return watcher.WatchedCount() == 3 })
+
+	// Changes in existing subdirectories are seen
+	edited := filepath.Join(deep, "edited.txt")
+	if err := os.WriteFile(edited, []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, events, edited)
+
+	// New directories are watched, and files already inside them reported
+	added := filepath.Join(root, "added", "nested")
+	if err := os.MkdirAll(added, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dropped := filepath.Join(added, "dropped.txt")
+	if err := os.WriteFile(dropped, []byte("dropped"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, events, dropped)
+	waitFor(t, "new directory watches", func() bool { return watcher.WatchedCount() == 5 })
+
+	// Removed directories are no longer watched
+	if err := os.RemoveAll(filepath.Join(root, "added")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "removed directory watches", func() bool { return watcher.WatchedCount() == 3 })
+}
+
+func TestWatchConfig_ShouldIgnore(t *testing.T) {
+	config := DefaultWatchConfig()
+
+	tests := map[string]bool{
+		"notes/todo.txt":           false,
+		"node_modules":             true,
+		"web/node_modules/pkg/a":   true,
+		".catapult/conflicts/a.md": true,
+		"notes/draft.swp":          true,
+		"notes/" + storage.TempFilePrefix + "todo.txt-1234": true,
+	}
+	for path, ignored := range tests {
+		if got := config.ShouldIgnore(filepath.FromSlash(path)); got != ignored {
+			t.Errorf("ShouldIgnore(%q) = %v, want %v", path, got, ignored)
+		}
+	}
+}
+
+func TestWatcher_RenameAndDelete(t *testing.T) {
+	root := t.TempDir()
+	oldPath := filepath.Join(root, "old.txt")
+	if err := os.WriteFile(oldPath, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultWatchConfig()
+	config.DebounceDelay = 50 * time.Millisecond
+	watcher, err := NewWatcher(config, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan FileEvent, 100)
+	go watcher.Watch(ctx, root, func(event FileEvent) { events <- event })
+	waitFor(t, "initial watches", func() bool { return watcher.WatchedCount() == 1 })
+
+	// A rename within the tree is reported once, under the new path
+	newPath := filepath.Join(root, "new.txt")
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+	event := nextEvent(t, events)
+	if event.Path != newPath || event.OldPath != oldPath || event.Operation() != OperationRename {
+		t.Errorf("Expected rename of %s to %s, got %+v", oldPath, newPath, event)
+	}
+
+	if err := os.Remove(newPath); err != nil {
+		t.Fatal(err)
+	}
+	event = nextEvent(t, events)
+	if event.Path != newPath || event.Operation() != OperationDelete {
+		t.Errorf("Expected deletion of %s, got %+v", newPath, event)
+	}
+}
+
+func TestFileEvent_Operation(t *testing.T) {
+	tests := []struct {
+		event FileEvent
+		want  string
+	}{
+		{FileEvent{Op: fsnotify.Create}, OperationCreate},
+		{FileEvent{Op: fsnotify.Write}, OperationWrite},
+		{FileEvent{Op: fsnotify.Chmod}, OperationWrite},
+		{FileEvent{Op: fsnotify.Remove}, OperationDelete},
+		{FileEvent{Op: fsnotify.Rename}, OperationDelete},
+		{FileEvent{Op: fsnotify.Rename, OldPath: "old.txt"}, OperationRename},
+	}
+	for _, tt := range tests {
+		if got := tt.event.Operation(); got != tt.want {
+			t.Errorf("Operation() of %+v = %s, want %s", tt.event, got, tt.want)
+		}
+	}
+}
+
+func TestWatcher_IgnoresDownloadTempFiles(t *testing.T) {
+	root := t.TempDir()
+
+	config := DefaultWatchConfig()
+	config.DebounceDelay = 20 * time.Millisecond
+	watcher, err := NewWatcher(config, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan FileEvent, 100)
+	go watcher.Watch(ctx, root, func(event FileEvent) { events <- event })
+	waitFor(t, "initial watches", func() bool { return watcher.WatchedCount() == 1 })
+
+	// A download writes a temp file and renames it into place
+	fm := storage.NewFileManager(root)
+	path := filepath.Join(root, "notes.txt")
+	if err := fm.WriteFileContent(path, []byte("downloaded"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	event := nextEvent(t, events)
+	if event.Path != path || event.OldPath != "" {
+		t.Errorf("Expected only a change of %s, got %+v", path, event)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Expected no further events, got %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
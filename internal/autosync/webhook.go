@@ -0,0 +1,198 @@
+package autosync
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// syncedRef is the branch catapult syncs with
+const syncedRef = "refs/heads/main"
+
+// maxWebhookPayload is the largest payload GitHub delivers
+const maxWebhookPayload = 25 << 20
+
+// pushEvent is the part of a GitHub push webhook payload catapult uses
+type pushEvent struct {
+	Ref     string `json:"ref"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
+	} `json:"commits"`
+}
+
+// Paths returns the paths the pushed commits touched, in order of appearance
+func (p *pushEvent) Paths() []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, commit := range p.Commits {
+		for _, list := range [][]string{commit.Added, commit.Removed, commit.Modified} {
+			for _, path := range list {
+				if !seen[path] {
+					seen[path] = true
+					paths = append(paths, path)
+				}
+			}
+		}
+	}
+	return paths
+}
+
+// webhookHandler receives GitHub webhook deliveries, verifying their
+// signature, and hands pushes to the synced branch to onPush
+type webhookHandler struct {
+	secret []byte
+	onPush func(push *pushEvent)
+	logger *log.Logger
+}
+
+// newWebhookHandler creates a handler accepting deliveries signed with secret
+func newWebhookHandler(secret string, onPush func(push *pushEvent), logger *log.Logger) *webhookHandler {
+	return &webhookHandler{
+		secret: []byte(secret),
+		onPush: onPush,
+		logger: logger,
+	}
+}
+
+// ServeHTTP handles a webhook delivery
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, "failed to read payload", http.StatusBadRequest)
+		return
+	}
+
+	if !verifySignature(h.secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		h.logger.Printf("Rejected webhook delivery with an invalid signature from %s", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	switch event := r.Header.Get("X-GitHub-Event"); event {
+	case "ping":
+		fmt.Fprintln(w, "pong")
+		return
+	case "push":
+	default:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	payload, err := webhookPayload(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var push pushEvent
+	if err := json.Unmarshal(payload, &push); err != nil {
+		http.Error(w, "invalid push payload", http.StatusBadRequest)
+		return
+	}
+	if push.Ref != syncedRef {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	h.onPush(&push)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// webhookPayload extracts the JSON payload of a delivery, which GitHub sends
+// either as is or form encoded depending on the webhook's content type
+func webhookPayload(contentType string, body []byte) ([]byte, error) {
+	if !strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return body, nil
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid form payload: %w", err)
+	}
+	return []byte(values.Get("payload")), nil
+}
+
+// verifySignature checks the HMAC-SHA256 signature GitHub computed over the
+// body with the webhook secret
+func verifySignature(secret, body []byte, signature string) bool {
+	hexDigest, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	digest, err := hex.DecodeString(hexDigest)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hmac.Equal(digest, mac.Sum(nil))
+}
+
+// serveWebhooks listens for push webhooks until ctx is cancelled, pulling
+// the pushed changes as soon as they arrive
+func (m *Manager) serveWebhooks(ctx context.Context) error {
+	webhookConfig := m.appConfig.Webhook
+	secret := webhookConfig.ResolveSecret()
+	if secret == "" {
+		return fmt.Errorf("no webhook secret configured: set webhook.secret or $%s", webhookConfig.SecretEnv)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(webhookConfig.Path, newWebhookHandler(secret, m.handlePush, m.logger))
+	server := &http.Server{
+		Addr:              webhookConfig.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	m.logger.Printf("Listening for push webhooks on http://%s%s", webhookConfig.Listen, webhookConfig.Path)
+	if err := listenAndServe(ctx, server); err != nil {
+		return fmt.Errorf("failed to serve webhooks: %w", err)
+	}
+	return nil
+}
+
+// listenAndServe runs server until ctx is cancelled
+func listenAndServe(ctx context.Context, server *http.Server) error {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handlePush pulls the changes of a push, unless it is one this device made
+func (m *Manager) handlePush(push *pushEvent) {
+	if manifest := m.fileManager.RemoteManifest(); manifest != nil && manifest.Head() == push.After {
+		return
+	}
+
+	m.logger.Printf("Push to %s received (%d files changed), syncing...", push.Ref, len(push.Paths()))
+	m.scheduler.Pull()
+}
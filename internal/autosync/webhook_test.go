@@ -0,0 +1,92 @@
+package autosync
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testPushPayload = `{
+	"ref": "refs/heads/main",
+	"before": "1111111",
+	"after": "2222222",
+	"commits": [
+		{"added": ["notes/new.md"], "removed": [], "modified": ["todo.txt"]},
+		{"added": [], "removed": ["old.txt"], "modified": ["todo.txt"]}
+	]
+}`
+
+// sign computes the signature GitHub sends for body
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver posts a webhook delivery to handler
+func deliver(handler http.Handler, event, contentType, body, signature string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	request.Header.Set("X-GitHub-Event", event)
+	request.Header.Set("Content-Type", contentType)
+	if signature != "" {
+		request.Header.Set("X-Hub-Signature-256", signature)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestWebhookHandler(t *testing.T) {
+	var pushes []*pushEvent
+	handler := newWebhookHandler("s3cret", func(push *pushEvent) {
+		pushes = append(pushes, push)
+	}, log.New(io.Discard, "", 0))
+
+	// A signed push is accepted
+	recorder := deliver(handler, "push", "application/json", testPushPayload, sign("s3cret", testPushPayload))
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("Expected signed push to be accepted, got %d", recorder.Code)
+	}
+	if len(pushes) != 1 || pushes[0].After != "2222222" {
+		t.Fatalf("Expected the push to be handed over, got %v", pushes)
+	}
+	if got := strings.Join(pushes[0].Paths(), ","); got != "notes/new.md,todo.txt,old.txt" {
+		t.Errorf("Expected pushed paths in order, got %s", got)
+	}
+
+	// Form encoded payloads are signed over the encoded body
+	form := "payload=" + url.QueryEscape(testPushPayload)
+	if recorder := deliver(handler, "push", "application/x-www-form-urlencoded", form, sign("s3cret", form)); recorder.Code != http.StatusAccepted {
+		t.Errorf("Expected form encoded push to be accepted, got %d", recorder.Code)
+	}
+
+	// Unsigned and wrongly signed deliveries are rejected
+	for _, signature := range []string{"", sign("wrong", testPushPayload), "sha256=zz", "sha1=abc"} {
+		if recorder := deliver(handler, "push", "application/json", testPushPayload, signature); recorder.Code != http.StatusUnauthorized {
+			t.Errorf("Expected signature %q to be rejected, got %d", signature, recorder.Code)
+		}
+	}
+
+	// Pings are answered; other events and branches are ignored
+	if recorder := deliver(handler, "ping", "application/json", `{}`, sign("s3cret", `{}`)); recorder.Code != http.StatusOK {
+		t.Errorf("Expected ping to be answered, got %d", recorder.Code)
+	}
+	if recorder := deliver(handler, "issues", "application/json", `{}`, sign("s3cret", `{}`)); recorder.Code != http.StatusNoContent {
+		t.Errorf("Expected other events to be ignored, got %d", recorder.Code)
+	}
+	other := strings.Replace(testPushPayload, "refs/heads/main", "refs/heads/feature", 1)
+	if recorder := deliver(handler, "push", "application/json", other, sign("s3cret", other)); recorder.Code != http.StatusNoContent {
+		t.Errorf("Expected pushes to other branches to be ignored, got %d", recorder.Code)
+	}
+
+	if len(pushes) != 2 {
+		t.Errorf("Expected 2 pushes to be handed over, got %d", len(pushes))
+	}
+}
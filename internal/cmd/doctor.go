@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/spf13/cobra"
+
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/doctor"
+	"github.com/itcaat/catapult/internal/network"
+	"github.com/itcaat/catapult/internal/service"
+)
+
+// NewDoctorCmd creates the doctor command
+func NewDoctorCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose common problems",
+		Long: `Check the configuration, GitHub token and repository, network, state and
+queue files, file watcher limits, service, clock and disk space.
+
+Each check passes, warns or fails, with a hint on how to fix it. The command
+exits with an error if any check fails, except with --json, where the status
+of every check is part of the output.`,
+		Args: cobra.NoArgs,
+		// Failed checks aren't usage errors
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var report *doctor.Report
+
+			cfg, err := config.Load()
+			if err != nil {
+				report = doctor.ConfigError(err)
+			} else {
+				client := github.NewClient(nil).WithAuthToken(cfg.GitHub.Token)
+
+				// Services are optional, so an unsupported platform isn't an error
+				var services service.ServiceManager
+				if manager, err := createServiceManager(); err == nil {
+					services = manager
+				}
+
+				report = doctor.New(cfg, client, network.NewDetector(), services).Run(context.Background())
+			}
+
+			out := cmd.OutOrStdout()
+			if jsonOutput {
+				return report.PrintJSON(out)
+			}
+
+			report.Print(out)
+			if failed := report.Failed(); failed > 0 {
+				return fmt.Errorf("%d checks failed", failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the results as JSON")
+
+	return cmd
+}
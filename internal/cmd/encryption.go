@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/encryption"
+)
+
+// NewPassphraseEnv is read for the new passphrase by 'encryption rotate-key'
+const NewPassphraseEnv = "CATAPULT_NEW_PASSPHRASE"
+
+// NewEncryptionCmd creates the encryption command
+func NewEncryptionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "encryption",
+		Short: "Manage client-side encryption",
+		Long:  `Encrypt synced files before they are uploaded, so the GitHub repository only ever holds ciphertext.`,
+	}
+
+	cmd.AddCommand(NewEncryptionInitCmd())
+	cmd.AddCommand(NewEncryptionRotateKeyCmd())
+
+	return cmd
+}
+
+// NewEncryptionInitCmd creates the encryption init command
+func NewEncryptionInitCmd() *cobra.Command {
+	var keyFile string
+	var generateKey bool
+	var encryptNames bool
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Enable encryption and encrypt existing files",
+		Long: `Enable client-side encryption for the repository and encrypt all files already in it.
+
+The key is derived from a passphrase (read from $CATAPULT_PASSPHRASE or prompted for on a terminal)
+or read from a key file. Other devices need the same passphrase or key file.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			stateLock, err := acquireLock(cfg, "encryption init", false)
+			if err != nil {
+				return err
+			}
+			defer stateLock.Release()
+
+			secret, err := newSecret(keyFile, generateKey, cfg.Encryption.PassphraseEnv)
+			if err != nil {
+				return err
+			}
+
+			repo, _, _, err := openRawRepository(context.Background(), cfg)
+			if err != nil {
+				return err
+			}
+
+			meta, err := encryption.Init(context.Background(), repo, secret, encryptNames, cmd.OutOrStdout())
+			if err != nil {
+				return fmt.Errorf("failed to initialize encryption: %w", err)
+			}
+
+			cfg.Encryption.Enabled = true
+			cfg.Encryption.KeyFile = secret.KeyFile
+			cfg.Encryption.EncryptNames = meta.EncryptNames
+			if err := cfg.Save(); err != nil {
+				return fmt.Errorf("failed to save config: %w", err)
+			}
+
+			fmt.Println("🔒 Encryption enabled")
+			printKeyHint(secret, cfg.Encryption.PassphraseEnv)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&keyFile, "key-file", "", "Use a key file instead of a passphrase")
+	cmd.Flags().BoolVar(&generateKey, "generate-key", false, "Generate a new random key file at --key-file")
+	cmd.Flags().BoolVar(&encryptNames, "encrypt-names", false, "Also encrypt file and directory names")
+
+	return cmd
+}
+
+// NewEncryptionRotateKeyCmd creates the encryption rotate-key command
+func NewEncryptionRotateKeyCmd() *cobra.Command {
+	var keyFile string
+	var generateKey bool
+	var encryptNames bool
+
+	cmd := &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Re-encrypt all files with a new key",
+		Long: `Re-encrypt all files in the repository with a new passphrase or key file.
+
+The current key is taken from the configuration. The new passphrase is read from
+$CATAPULT_NEW_PASSPHRASE or prompted for. An interrupted rotation can be resumed
+by running the command again with the same new passphrase or key file.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			if !cfg.Encryption.Enabled {
+				fmt.Println("❌ Encryption is not enabled")
+				fmt.Println("💡 Use 'catapult encryption init' to enable it")
+				return nil
+			}
+
+			stateLock, err := acquireLock(cfg, "encryption rotate-key", false)
+			if err != nil {
+				return err
+			}
+			defer stateLock.Release()
+
+			secret, err := newSecret(keyFile, generateKey, NewPassphraseEnv)
+			if err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("encrypt-names") {
+				encryptNames = cfg.Encryption.EncryptNames
+			}
+
+			repo, _, _, err := openRawRepository(context.Background(), cfg)
+			if err != nil {
+				return err
+			}
+
+			oldSecret := encryption.SecretFromConfig(&cfg.Encryption)
+			meta, err := encryption.Rotate(context.Background(), repo, oldSecret, secret, encryptNames, cmd.OutOrStdout())
+			if err != nil {
+				return fmt.Errorf("failed to rotate key: %w", err)
+			}
+
+			cfg.Encryption.KeyFile = secret.KeyFile
+			cfg.Encryption.EncryptNames = meta.EncryptNames
+			if err := cfg.Save(); err != nil {
+				return fmt.Errorf("failed to save config: %w", err)
+			}
+
+			fmt.Println("🔑 Encryption key rotated")
+			printKeyHint(secret, cfg.Encryption.PassphraseEnv)
+			fmt.Println("💡 Update the passphrase or key file on your other devices")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&keyFile, "key-file", "", "Use a key file instead of a passphrase")
+	cmd.Flags().BoolVar(&generateKey, "generate-key", false, "Generate a new random key file at --key-file")
+	cmd.Flags().BoolVar(&encryptNames, "encrypt-names", false, "Also encrypt file and directory names (default: keep current setting)")
+
+	return cmd
+}
+
+// newSecret returns the secret for a new key: a (possibly generated) key
+// file, or a passphrase from passphraseEnv or the terminal
+func newSecret(keyFile string, generateKey bool, passphraseEnv string) (encryption.Secret, error) {
+	if generateKey && keyFile == "" {
+		return encryption.Secret{}, fmt.Errorf("--generate-key requires --key-file")
+	}
+
+	if keyFile != "" {
+		absPath, err := filepath.Abs(keyFile)
+		if err != nil {
+			return encryption.Secret{}, fmt.Errorf("failed to resolve key file path: %w", err)
+		}
+		if generateKey {
+			if _, err := os.Stat(absPath); err == nil {
+				return encryption.Secret{}, fmt.Errorf("key file %s already exists", absPath)
+			}
+			if err := encryption.GenerateKeyFile(absPath); err != nil {
+				return encryption.Secret{}, err
+			}
+			fmt.Printf("🔑 Generated key file %s, keep a backup of it somewhere safe\n", absPath)
+		}
+		return encryption.Secret{KeyFile: absPath}, nil
+	}
+
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return encryption.Secret{Passphrase: passphrase}, nil
+	}
+
+	passphrase, err := promptPassphrase(passphraseEnv)
+	if err != nil {
+		return encryption.Secret{}, err
+	}
+	return encryption.Secret{Passphrase: passphrase}, nil
+}
+
+// promptPassphrase reads a new passphrase and its confirmation from the
+// terminal without echoing them. Without a terminal the passphrase has to
+// come from passphraseEnv or a key file instead.
+func promptPassphrase(passphraseEnv string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("no terminal to read the passphrase from: set $%s or use --key-file", passphraseEnv)
+	}
+
+	readPassphrase := func(prompt string) (string, error) {
+		fmt.Print(prompt)
+		passphrase, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		return string(passphrase), nil
+	}
+
+	passphrase, err := readPassphrase("Passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if len(passphrase) < 8 {
+		return "", fmt.Errorf("passphrase must be at least 8 characters")
+	}
+
+	confirm, err := readPassphrase("Confirm passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm != passphrase {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+
+	return passphrase, nil
+}
+
+// printKeyHint tells the user how the key is supplied on future runs
+func printKeyHint(secret encryption.Secret, passphraseEnv string) {
+	if secret.KeyFile != "" {
+		fmt.Printf("💡 Key file: %s\n", secret.KeyFile)
+		return
+	}
+	fmt.Printf("💡 Set $%s to the passphrase for sync, status and the background service\n", passphraseEnv)
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/repository"
+)
+
+// timeLayouts are the accepted formats for --at timestamps, in local time
+// unless the layout includes a zone
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// NewHistoryCmd creates the history command
+func NewHistoryCmd() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "history <path>",
+		Short: "Show the version history of a file",
+		Long:  `List the commits that changed a file, with the date, the device that made the change and the file size.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			relPath, err := relativeToBase(cfg.Storage.BaseDir, args[0])
+			if err != nil {
+				return err
+			}
+
+			repo, _, _, err := openRepository(context.Background(), cfg)
+			if err != nil {
+				return err
+			}
+
+			revisions, err := repo.GetFileHistory(context.Background(), relPath, limit)
+			if err != nil {
+				return fmt.Errorf("failed to get history: %w", err)
+			}
+
+			out := cmd.OutOrStdout()
+			if len(revisions) == 0 {
+				fmt.Fprintf(out, "No history for %s\n", relPath)
+				return nil
+			}
+
+			fmt.Fprintf(out, "History of %s:\n\n", relPath)
+			fmt.Fprintf(out, "%-8s  %-16s  %-20s  %s\n", "COMMIT", "DATE", "DEVICE", "SIZE")
+			for _, revision := range revisions {
+				size := formatSize(revision.Size)
+				if revision.Deleted {
+					size = "deleted"
+				}
+				fmt.Fprintf(out, "%-8s  %-16s  %-20s  %s\n",
+					repository.ShortSHA(revision.CommitSHA),
+					revision.Date.Local().Format("2006-01-02 15:04"),
+					revision.Device,
+					size)
+			}
+
+			fmt.Fprintf(out, "\n💡 Use 'catapult restore %s --at <commit>' to bring back a version\n", relPath)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Maximum number of versions to show")
+
+	return cmd
+}
+
+// relativeToBase converts a path argument to a path relative to the sync
+// directory. Relative arguments outside of it are taken relative to it.
+func relativeToBase(baseDir, arg string) (string, error) {
+	absPath, err := filepath.Abs(arg)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	relPath, err := filepath.Rel(baseDir, absPath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		if filepath.IsAbs(arg) {
+			return "", fmt.Errorf("'%s' is outside of the sync directory %s", arg, baseDir)
+		}
+		relPath = filepath.Clean(arg)
+	}
+
+	if relPath == "." || strings.HasPrefix(relPath, "..") {
+		return "", fmt.Errorf("'%s' is not a file in the sync directory %s", arg, baseDir)
+	}
+	return relPath, nil
+}
+
+// resolveRef turns a --at value into a commit: timestamps resolve to the last
+// commit at or before that time, anything else is used as a commit reference
+func resolveRef(ctx context.Context, repo repository.Repository, at string) (string, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, at, time.Local); err == nil {
+			return repo.ResolveCommitAt(ctx, t)
+		}
+	}
+	return at, nil
+}
+
+// formatSize formats a byte count for display
+func formatSize(size int) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
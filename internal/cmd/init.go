@@ -9,7 +9,6 @@ import (
 	"github.com/itcaat/catapult/internal/auth"
 	"github.com/itcaat/catapult/internal/config"
 	"github.com/itcaat/catapult/internal/repository"
-	"github.com/itcaat/catapult/internal/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -77,8 +76,14 @@ func NewInitCmd() *cobra.Command {
 				return fmt.Errorf("failed to create base directory: %w", err)
 			}
 
+			stateLock, err := acquireLock(cfg, "init", false)
+			if err != nil {
+				return err
+			}
+			defer stateLock.Release()
+
 			// Initialize file manager
-			fileManager := storage.NewFileManager(cfg.Storage.BaseDir)
+			fileManager := newFileManager(cfg)
 
 			// Save initial state
 			if err := fileManager.SaveState(cfg.Storage.StatePath); err != nil {
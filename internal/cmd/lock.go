@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/itcaat/catapult/internal/autosync"
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/lock"
+)
+
+// delegateTimeout bounds how long a delegated sync is waited for
+const delegateTimeout = 10 * time.Minute
+
+// stateDir returns the directory holding the state, journal and queue
+func stateDir(cfg *config.Config) string {
+	return filepath.Dir(cfg.Storage.StatePath)
+}
+
+// acquireLock takes the state directory lock for a command that mutates state
+func acquireLock(cfg *config.Config, command string, daemon bool) (*lock.Lock, error) {
+	stateLock, err := lock.Acquire(stateDir(cfg), lock.NewOwner(command, daemon))
+	var held *lock.HeldError
+	if errors.As(err, &held) {
+		return nil, lockHeldError(cfg, held)
+	}
+	return stateLock, err
+}
+
+// lockHeldError explains how to proceed when another process holds the lock
+func lockHeldError(cfg *config.Config, held *lock.HeldError) error {
+	if held.Owner.Daemon {
+		return fmt.Errorf("%w\n💡 The sync service is running: use 'catapult service pause' to hold it back, or stop it with 'catapult service stop'", held)
+	}
+	return fmt.Errorf("%w\n💡 Wait for '%s' to finish; if it is no longer running, remove %s",
+		held, held.Owner.Command, filepath.Join(stateDir(cfg), lock.FileName))
+}
+
+// dialDaemon connects to the control socket of the running daemon
+func dialDaemon(cfg *config.Config) (*autosync.Client, error) {
+	return autosync.Dial(context.Background(), stateDir(cfg))
+}
+
+// daemonClient connects to the daemon holding the lock
+func daemonClient(cfg *config.Config, held *lock.HeldError) (*autosync.Client, error) {
+	client, err := dialDaemon(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w\n💡 The sync service (pid %d) holds the lock but doesn't answer on its control socket (%v); restart it with 'catapult service restart'",
+			held, held.Owner.PID, err)
+	}
+	return client, nil
+}
+
+// delegateSync hands a sync over to the running daemon
+func delegateSync(cfg *config.Config, held *lock.HeldError) error {
+	fmt.Printf("🔄 Asking the sync service (pid %d) to sync...\n", held.Owner.PID)
+
+	client, err := daemonClient(cfg, held)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), delegateTimeout)
+	defer cancel()
+
+	if err := client.Sync(ctx); err != nil {
+		return err
+	}
+
+	fmt.Println("✅ Sync completed by the sync service")
+	return nil
+}
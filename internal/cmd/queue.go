@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itcaat/catapult/internal/autosync"
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/lock"
+	"github.com/itcaat/catapult/internal/sync"
+)
+
+// NewQueueCmd creates the queue command
+func NewQueueCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Inspect and manage pending sync operations",
+		Long: `Inspect and manage the offline queue of the auto-sync mode.
+
+Operations are queued when a sync can't run, for example while offline, and
+retried with backoff. Operations that fail permanently or run out of attempts
+are kept as dead letters until retried or dropped.
+
+Changes are handed over to the sync service if it is running.`,
+	}
+
+	cmd.AddCommand(newQueueListCmd())
+	cmd.AddCommand(newQueueRetryCmd())
+	cmd.AddCommand(newQueueDropCmd())
+	cmd.AddCommand(newQueueFlushCmd())
+
+	return cmd
+}
+
+// newQueueListCmd creates the queue list command
+func newQueueListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List pending operations and dead letters",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			// The sync service keeps the queue in memory
+			if client, err := dialDaemon(cfg); err == nil {
+				snapshot, err := client.Queue(context.Background())
+				if err != nil {
+					return err
+				}
+				printQueue(snapshot.Pending, snapshot.DeadLetters, time.Now(), cmd.OutOrStdout())
+				return nil
+			}
+
+			queue, err := loadQueue(cfg)
+			if err != nil {
+				return err
+			}
+
+			printQueue(queue.GetPending(), queue.DeadLetters(), time.Now(), cmd.OutOrStdout())
+			return nil
+		},
+	}
+}
+
+// newQueueRetryCmd creates the queue retry command
+func newQueueRetryCmd() *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "retry <id>",
+		Short: "Retry an operation now",
+		Long:  `Make a pending operation due now, skipping its backoff, or move a dead letter back to the queue with fresh attempts.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return modifyQueue(cmd, "queue retry", func(ctx context.Context, client *autosync.Client) error {
+				if all {
+					_, err := client.RetryAll(ctx)
+					return err
+				}
+				return client.Retry(ctx, args[0])
+			}, func(queue *autosync.Queue) (string, error) {
+				if all {
+					count, err := queue.RetryAll()
+					return fmt.Sprintf("%d operations will be retried", count), err
+				}
+				return fmt.Sprintf("Operation %s will be retried", args[0]), queue.Retry(args[0])
+			})
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Retry every pending operation now, skipping its backoff, and every dead letter")
+
+	return cmd
+}
+
+// newQueueDropCmd creates the queue drop command
+func newQueueDropCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "drop <id>",
+		Short: "Remove an operation from the queue",
+		Long:  `Remove a pending operation or dead letter. The file is left as it is and synced by the next sync that covers it.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return modifyQueue(cmd, "queue drop", func(ctx context.Context, client *autosync.Client) error {
+				return client.Drop(ctx, args[0])
+			}, func(queue *autosync.Queue) (string, error) {
+				return fmt.Sprintf("Operation %s dropped", args[0]), queue.Drop(args[0])
+			})
+		},
+	}
+}
+
+// newQueueFlushCmd creates the queue flush command
+func newQueueFlushCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "flush",
+		Short: "Process every pending operation now",
+		Long:  `Run every pending operation now, regardless of its backoff, the same way the auto-sync mode does.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			stateLock, err := acquireLock(cfg, "queue flush", false)
+			if err != nil {
+				var held *lock.HeldError
+				if !errors.As(err, &held) || !held.Owner.Daemon {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "🔄 Asking the sync service (pid %d) to flush the queue...\n", held.Owner.PID)
+				if err := delegateQueueAction(cfg, held, func(ctx context.Context, client *autosync.Client) error {
+					return client.Flush(ctx)
+				}); err != nil {
+					return err
+				}
+			} else {
+				err := flushQueue(cfg)
+				stateLock.Release()
+				if err != nil {
+					return err
+				}
+			}
+
+			queue, err := loadQueue(cfg)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "✅ Queue flushed: %d operations pending, %d dead letters\n",
+				len(queue.GetPending()), len(queue.DeadLetters()))
+			return nil
+		},
+	}
+}
+
+// loadQueue reads the offline queue from the state directory
+func loadQueue(cfg *config.Config) (*autosync.Queue, error) {
+	queue := autosync.NewQueue(filepath.Join(stateDir(cfg), autosync.QueueFileName), 0)
+	if err := queue.Load(); err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+// modifyQueue applies change to the offline queue, or has the sync service
+// do it through remote if it is running, since it keeps the queue in memory.
+// change returns what it did.
+func modifyQueue(cmd *cobra.Command, command string, remote func(ctx context.Context, client *autosync.Client) error, change func(queue *autosync.Queue) (string, error)) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	stateLock, err := acquireLock(cfg, command, false)
+	if err != nil {
+		var held *lock.HeldError
+		if !errors.As(err, &held) || !held.Owner.Daemon {
+			return err
+		}
+		if err := delegateQueueAction(cfg, held, remote); err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "✅ Done by the sync service")
+		return nil
+	}
+	defer stateLock.Release()
+
+	queue, err := loadQueue(cfg)
+	if err != nil {
+		return err
+	}
+	done, err := change(queue)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "✅ %s\n", done)
+	return nil
+}
+
+// delegateQueueAction has the running daemon holding the lock run action
+func delegateQueueAction(cfg *config.Config, held *lock.HeldError, action func(ctx context.Context, client *autosync.Client) error) error {
+	client, err := daemonClient(cfg, held)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), delegateTimeout)
+	defer cancel()
+	return action(ctx, client)
+}
+
+// flushQueue processes the pending operations with an auto-sync manager that
+// isn't watching, for when the sync service doesn't run
+func flushQueue(cfg *config.Config) error {
+	fileManager := newFileManager(cfg)
+	if err := loadState(cfg, fileManager, true); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	repo, _, _, err := openRepository(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	syncer := sync.New(repo, fileManager)
+	configureSyncer(syncer, cfg)
+
+	logger := log.New(os.Stdout, "[QUEUE] ", log.LstdFlags)
+	manager, err := autosync.NewManager(cfg, syncer, fileManager, repo, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create auto-sync manager: %w", err)
+	}
+
+	manager.FlushQueue(ctx)
+	return nil
+}
+
+// printQueue lists the pending operations and dead letters of a queue
+func printQueue(pending, deadLetters []*autosync.QueueOperation, now time.Time, out io.Writer) {
+	if len(pending) == 0 && len(deadLetters) == 0 {
+		fmt.Fprintln(out, "✅ The queue is empty")
+		return
+	}
+
+	if len(pending) > 0 {
+		fmt.Fprintf(out, "%d pending operations:\n\n", len(pending))
+		fmt.Fprintf(out, "%-6s  %-30s  %-8s  %-8s  %-7s  %-12s  %s\n", "ID", "PATH", "OP", "AGE", "RETRIES", "NEXT ATTEMPT", "LAST ERROR")
+		for _, op := range pending {
+			next := "now"
+			if op.NextAttempt.After(now) {
+				next = "in " + formatAge(op.NextAttempt.Sub(now))
+			}
+			fmt.Fprintf(out, "%-6s  %-30s  %-8s  %-8s  %-7d  %-12s  %s\n",
+				op.ID, queuedPath(op), op.Operation, formatAge(now.Sub(op.Timestamp)), op.Retries, next, op.LastError)
+		}
+	}
+
+	if len(deadLetters) > 0 {
+		if len(pending) > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "☠️  %d dead letters, not retried automatically:\n\n", len(deadLetters))
+		fmt.Fprintf(out, "%-6s  %-30s  %-8s  %-8s  %-7s  %s\n", "ID", "PATH", "OP", "FAILED", "RETRIES", "LAST ERROR")
+		for _, op := range deadLetters {
+			fmt.Fprintf(out, "%-6s  %-30s  %-8s  %-8s  %-7d  %s\n",
+				op.ID, queuedPath(op), op.Operation, formatAge(now.Sub(op.FailedAt)), op.Retries, op.LastError)
+		}
+		fmt.Fprintln(out, "\n💡 Use 'catapult queue retry <id>' to try again or 'catapult queue drop <id>' to discard")
+	}
+}
+
+// queuedPath describes the files an operation touches
+func queuedPath(op *autosync.QueueOperation) string {
+	switch {
+	case op.IsFullSync():
+		return "(all files)"
+	case op.OldPath != "":
+		return op.OldPath + " -> " + op.FilePath
+	default:
+		return op.FilePath
+	}
+}
+
+// formatAge formats a duration coarsely, like 45s, 12m or 3h
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
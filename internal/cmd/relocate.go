@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// NewRelocateCmd creates and returns the relocate command
+func NewRelocateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "relocate <newdir>",
+		Short: "Move the synced folder to a new location",
+		Long: `Move the synced folder (storage.basedir) to a new location and update the configuration.
+
+The sync state is keyed by paths relative to the folder, so files keep their
+sync status and nothing is uploaded or downloaded again. If the folder was
+already moved by hand, only the configuration is updated.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Load configuration
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			// Keep the sync service from syncing while the folder moves
+			stateLock, err := acquireLock(cfg, "relocate", false)
+			if err != nil {
+				return err
+			}
+			defer stateLock.Release()
+
+			oldDir, err := filepath.Abs(cfg.Storage.BaseDir)
+			if err != nil {
+				return fmt.Errorf("failed to get absolute path: %w", err)
+			}
+			newDir, err := filepath.Abs(expandHome(args[0]))
+			if err != nil {
+				return fmt.Errorf("failed to get absolute path: %w", err)
+			}
+
+			if err := moveBaseDir(oldDir, newDir); err != nil {
+				return err
+			}
+
+			cfg.Storage.BaseDir = newDir
+			if err := cfg.Save(); err != nil {
+				return fmt.Errorf("failed to save config: %w", err)
+			}
+
+			fmt.Printf("✅ Synced folder relocated to %s\n", newDir)
+			fmt.Println("💡 If you stopped the sync service to relocate, start it again: catapult service start")
+			return nil
+		},
+	}
+}
+
+// moveBaseDir moves the synced folder from oldDir to newDir. A folder that
+// was already moved by hand is left in place.
+func moveBaseDir(oldDir, newDir string) error {
+	if oldDir == newDir {
+		return fmt.Errorf("synced folder is already at %s", newDir)
+	}
+	if isWithin(newDir, oldDir) || isWithin(oldDir, newDir) {
+		return fmt.Errorf("can't relocate %s to %s: one folder contains the other", oldDir, newDir)
+	}
+
+	oldExists, err := dirExists(oldDir)
+	if err != nil {
+		return err
+	}
+	newEmpty, newExists, err := dirEmpty(newDir)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !oldExists && newExists:
+		// Already moved, only the configuration is outdated
+		fmt.Printf("📁 %s is missing, using the existing %s\n", oldDir, newDir)
+		return nil
+	case !oldExists:
+		return fmt.Errorf("synced folder %s does not exist", oldDir)
+	case newExists && !newEmpty:
+		return fmt.Errorf("%s already exists and is not empty", newDir)
+	}
+
+	if newExists {
+		if err := os.Remove(newDir); err != nil {
+			return fmt.Errorf("failed to replace empty directory: %w", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(newDir), 0755); err != nil {
+		return fmt.Errorf("failed to create parent directory: %w", err)
+	}
+
+	if err := os.Rename(oldDir, newDir); err != nil {
+		if errors.Is(err, syscall.EXDEV) {
+			return fmt.Errorf("failed to move %s: %s is on another device\n💡 Copy the folder there yourself, then run 'catapult relocate %s' again", oldDir, newDir, newDir)
+		}
+		return fmt.Errorf("failed to move synced folder: %w", err)
+	}
+
+	fmt.Printf("📁 Moved %s to %s\n", oldDir, newDir)
+	return nil
+}
+
+// dirExists reports whether path is an existing directory
+func dirExists(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return false, fmt.Errorf("%s is not a directory", path)
+	}
+	return true, nil
+}
+
+// dirEmpty reports whether path is an empty directory and whether it exists
+func dirEmpty(path string) (empty, exists bool, err error) {
+	exists, err = dirExists(path)
+	if err != nil || !exists {
+		return false, exists, err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return false, true, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return len(entries) == 0, true, nil
+}
+
+// isWithin reports whether path is inside dir
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// expandHome expands a leading ~ to the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
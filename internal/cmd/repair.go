@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/storage"
+	"github.com/itcaat/catapult/internal/sync"
+)
+
+// NewRepairCmd creates the repair command
+func NewRepairCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "repair",
+		Short: "Rebuild the sync state from local and remote files",
+		Long: `Rebuild the sync state when state.json is lost or corrupt.
+
+Every local file is matched against the repository by its git blob SHA.
+Identical files are recorded as synced. Files whose content differs are
+flagged as needing attention rather than treated as conflicts: sync leaves
+them alone until you edit the file (keeping the local version) or delete it
+(taking the remote version). Both versions are saved under .catapult/conflicts.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			stateLock, err := acquireLock(cfg, "repair", false)
+			if err != nil {
+				return err
+			}
+			defer stateLock.Release()
+
+			if err := os.MkdirAll(cfg.Storage.BaseDir, 0755); err != nil {
+				return fmt.Errorf("failed to create base directory: %w", err)
+			}
+
+			// Start from scratch; the existing state isn't trusted
+			fileManager := newFileManager(cfg)
+
+			ctx := context.Background()
+			repo, _, _, err := openRepository(ctx, cfg)
+			if err != nil {
+				return err
+			}
+
+			syncer := sync.New(repo, fileManager)
+			configureSyncer(syncer, cfg)
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintln(out, "🔧 Matching local files against the repository...")
+			report, err := syncer.Repair(ctx)
+			if err != nil {
+				return err
+			}
+
+			// The replaced state is kept as the backup generation
+			_, statErr := os.Stat(cfg.Storage.StatePath)
+			if err := fileManager.SaveState(cfg.Storage.StatePath); err != nil {
+				return fmt.Errorf("failed to save state: %w", err)
+			}
+
+			report.Print(out)
+			fmt.Fprintln(out)
+			if statErr == nil {
+				fmt.Fprintf(out, "✅ State rebuilt (previous state kept in %s%s)\n", cfg.Storage.StatePath, storage.BackupSuffix)
+			} else {
+				fmt.Fprintln(out, "✅ State rebuilt")
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/encryption"
+	"github.com/itcaat/catapult/internal/repository"
+)
+
+// openRawRepository connects to GitHub and returns the configured repository
+// without client-side encryption, along with the client and user login
+func openRawRepository(ctx context.Context, cfg *config.Config) (repository.Repository, *github.Client, string, error) {
+	client := repository.NewClient(cfg.GitHub.Token)
+
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return repository.New(client, user.GetLogin(), cfg.Repository.Name), client, user.GetLogin(), nil
+}
+
+// openRepository connects to GitHub and returns the configured repository,
+// wrapped with client-side encryption when it's enabled
+func openRepository(ctx context.Context, cfg *config.Config) (repository.Repository, *github.Client, string, error) {
+	repo, client, login, err := openRawRepository(ctx, cfg)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if cfg.Encryption.Enabled {
+		repo, err = encryption.Open(ctx, repo, &cfg.Encryption)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return repo, client, login, nil
+	}
+
+	// Never sync ciphertext as if it were plaintext
+	meta, err := encryption.LoadMetadata(ctx, repo)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if meta != nil {
+		return nil, nil, "", fmt.Errorf("repository '%s' is encrypted, set encryption.enabled and configure the key in config.yaml", cfg.Repository.Name)
+	}
+
+	return repo, client, login, nil
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/sync"
+)
+
+// NewRestoreCmd creates the restore command
+func NewRestoreCmd() *cobra.Command {
+	var at string
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "restore [path] --at <commit|timestamp>",
+		Short: "Restore files to an earlier version",
+		Long: `Restore a file, or with --all the whole folder, to the version at a commit or point in time.
+
+Timestamps use local time, e.g. "2024-05-01 14:30" or RFC 3339. The restored
+version is synced like a local edit, so newer versions stay in the history.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if at == "" {
+				return fmt.Errorf("--at is required")
+			}
+			if all == (len(args) == 1) {
+				return fmt.Errorf("specify either a path or --all")
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			stateLock, err := acquireLock(cfg, "restore", false)
+			if err != nil {
+				return err
+			}
+			defer stateLock.Release()
+
+			fileManager := newFileManager(cfg)
+			if err := loadState(cfg, fileManager, true); err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			repo, _, _, err := openRepository(ctx, cfg)
+			if err != nil {
+				return err
+			}
+
+			ref, err := resolveRef(ctx, repo, at)
+			if err != nil {
+				return err
+			}
+
+			syncer := sync.New(repo, fileManager)
+			configureSyncer(syncer, cfg)
+
+			out := cmd.OutOrStdout()
+			if all {
+				err = syncer.RestoreAll(ctx, ref, out)
+			} else {
+				relPath, relErr := relativeToBase(cfg.Storage.BaseDir, args[0])
+				if relErr != nil {
+					return relErr
+				}
+				err = syncer.RestoreFile(ctx, relPath, ref, out)
+			}
+
+			// Save state even after a partial restore
+			if saveErr := fileManager.SaveState(cfg.Storage.StatePath); saveErr != nil && err == nil {
+				err = fmt.Errorf("failed to save state: %w", saveErr)
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&at, "at", "", "Commit SHA or timestamp to restore")
+	cmd.Flags().BoolVar(&all, "all", false, "Roll the whole folder back")
+
+	return cmd
+}
@@ -21,6 +21,13 @@ with GitHub using device flow authentication.`,
 	rootCmd.AddCommand(NewServiceCmd())
 	rootCmd.AddCommand(NewOpenCmd())
 	rootCmd.AddCommand(NewIssuesCmd())
+	rootCmd.AddCommand(NewEncryptionCmd())
+	rootCmd.AddCommand(NewHistoryCmd())
+	rootCmd.AddCommand(NewRestoreCmd())
+	rootCmd.AddCommand(NewRelocateCmd())
+	rootCmd.AddCommand(NewRepairCmd())
+	rootCmd.AddCommand(NewDoctorCmd())
+	rootCmd.AddCommand(NewQueueCmd())
 
 	return rootCmd
 }
@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 
+	"github.com/itcaat/catapult/internal/autosync"
+	"github.com/itcaat/catapult/internal/config"
 	"github.com/itcaat/catapult/internal/service"
 	"github.com/spf13/cobra"
 )
@@ -33,6 +37,9 @@ Supported platforms:
 	cmd.AddCommand(NewServiceRestartCmd())
 	cmd.AddCommand(NewServiceStatusCmd())
 	cmd.AddCommand(NewServiceLogsCmd())
+	cmd.AddCommand(NewServicePauseCmd())
+	cmd.AddCommand(NewServiceResumeCmd())
+	cmd.AddCommand(NewServiceReloadCmd())
 
 	return cmd
 }
@@ -225,6 +232,7 @@ func NewServiceStatusCmd() *cobra.Command {
 			switch status {
 			case service.StatusRunning:
 				fmt.Println("✅ Service is running and monitoring file changes")
+				printServiceDetails()
 			case service.StatusStopped:
 				fmt.Println("⏸️  Service is installed but not running")
 			case service.StatusNotInstalled:
@@ -281,6 +289,93 @@ func NewServiceLogsCmd() *cobra.Command {
 	return cmd
 }
 
+// NewServicePauseCmd creates the service pause command
+func NewServicePauseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "pause",
+		Short: "Pause syncing of the running service",
+		Long:  `Hold back syncs of the running sync service. Changes keep being collected and are synced once resumed.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return controlDaemon(func(ctx context.Context, client *autosync.Client) error {
+				if err := client.Pause(ctx); err != nil {
+					return err
+				}
+				fmt.Println("⏸️  Sync service paused")
+				fmt.Println("💡 Use 'catapult service resume' to continue syncing")
+				return nil
+			})
+		},
+	}
+}
+
+// NewServiceResumeCmd creates the service resume command
+func NewServiceResumeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "resume",
+		Short: "Resume syncing of the running service",
+		Long:  `Let a paused sync service sync again, starting with the changes collected while paused.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return controlDaemon(func(ctx context.Context, client *autosync.Client) error {
+				if err := client.Resume(ctx); err != nil {
+					return err
+				}
+				fmt.Println("▶️  Sync service resumed")
+				return nil
+			})
+		},
+	}
+}
+
+// NewServiceReloadCmd creates the service reload command
+func NewServiceReloadCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reload",
+		Short: "Apply config changes to the running service",
+		Long:  `Make the running sync service read the autosync section of the config file again, without waiting for it to notice the change.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return controlDaemon(func(ctx context.Context, client *autosync.Client) error {
+				if err := client.Reload(ctx); err != nil {
+					return err
+				}
+				fmt.Println("✅ Configuration reloaded")
+				return nil
+			})
+		},
+	}
+}
+
+// controlDaemon runs control against the running sync service
+func controlDaemon(control func(ctx context.Context, client *autosync.Client) error) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	client, err := dialDaemon(cfg)
+	if err != nil {
+		return fmt.Errorf("the sync service is not running: %w", err)
+	}
+	return control(context.Background(), client)
+}
+
+// printServiceDetails prints what the running sync service is doing, if it
+// can be reached
+func printServiceDetails() {
+	controlDaemon(func(ctx context.Context, client *autosync.Client) error {
+		daemonStatus, err := client.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println(describeDaemon(daemonStatus, time.Now()))
+		fmt.Printf("   Running since %s, watching %d directories, %d dead letters\n",
+			daemonStatus.StartedAt.Format("2006-01-02 15:04:05"), daemonStatus.WatchedDirs, daemonStatus.DeadLetters)
+		return nil
+	})
+}
+
 // createServiceManager creates a service manager instance
 func createServiceManager() (service.ServiceManager, error) {
 	// Get current executable path
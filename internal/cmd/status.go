@@ -3,10 +3,11 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"time"
 
-	"github.com/google/go-github/v57/github"
+	"github.com/itcaat/catapult/internal/autosync"
 	"github.com/itcaat/catapult/internal/config"
-	"github.com/itcaat/catapult/internal/repository"
 	"github.com/itcaat/catapult/internal/status"
 	"github.com/itcaat/catapult/internal/storage"
 	"github.com/spf13/cobra"
@@ -14,29 +15,124 @@ import (
 
 // NewStatusCmd creates and returns the status command
 func NewStatusCmd() *cobra.Command {
-	return &cobra.Command{
+	var refresh bool
+
+	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show status of tracked files",
-		Long:  `Show status of all files and their synchronization state with GitHub.`,
+		Long: `Show status of all files and their synchronization state with GitHub.
+
+The repository is compared as of the last sync, so status works offline.
+Use --refresh to fetch the current state of the repository.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := config.Load()
 			if err != nil {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
 
-			fileManager := storage.NewFileManager(cfg.Storage.BaseDir)
-			if err := fileManager.LoadState(cfg.Storage.StatePath); err != nil {
-				return fmt.Errorf("failed to load state: %w", err)
+			fileManager := newFileManager(cfg)
+			if err := loadState(cfg, fileManager, false); err != nil {
+				return err
 			}
 
-			client := github.NewClient(nil).WithAuthToken(cfg.GitHub.Token)
-			user, _, err := client.Users.Get(context.Background(), "")
-			if err != nil {
-				return fmt.Errorf("failed to get user: %w", err)
+			// The sync service owns the state files while it runs
+			daemon, _ := dialDaemon(cfg)
+
+			if err := printFileStatus(cmd, cfg, fileManager, refresh, daemon == nil); err != nil {
+				return err
 			}
 
-			repo := repository.New(client, user.GetLogin(), cfg.Repository.Name)
-			return status.PrintStatus(fileManager, repo, cfg.Storage.BaseDir, cmd.OutOrStdout())
+			// Operations the auto-sync gave up on are listed after the files
+			if daemon != nil {
+				return printDaemonStatus(daemon, cmd)
+			}
+			printDeadLetters(cfg, cmd)
+			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&refresh, "refresh", false, "Fetch the current state of the repository instead of using the cached one")
+
+	return cmd
+}
+
+// printFileStatus prints the status of every file, against the cached remote
+// state unless refreshing. A refreshed state is cached if saveManifest is set.
+func printFileStatus(cmd *cobra.Command, cfg *config.Config, fileManager *storage.FileManager, refresh, saveManifest bool) error {
+	// Use the remote state cached by the last sync
+	if manifest := fileManager.RemoteManifest(); manifest != nil && !refresh {
+		return status.PrintCachedStatus(fileManager, manifest, cfg.Storage.BaseDir, cmd.OutOrStdout())
+	}
+
+	ctx := context.Background()
+	repo, _, _, err := openRepository(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	headSHA, _ := repo.GetHeadSHA(ctx)
+	if err := status.PrintStatus(fileManager, repo, cfg.Storage.BaseDir, cmd.OutOrStdout()); err != nil {
+		return err
+	}
+
+	if !saveManifest {
+		return nil
+	}
+
+	// Cache the fetched state for offline use
+	manifest := fileManager.RemoteManifest()
+	manifest.SetHead(headSHA)
+	if err := manifest.Save(storage.RemoteManifestPath(cfg.Storage.StatePath)); err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "⚠️  %v\n", err)
+	}
+	return nil
+}
+
+// printDeadLetters lists the operations of the offline queue that were given
+// up on, if the queue can be read
+func printDeadLetters(cfg *config.Config, cmd *cobra.Command) {
+	queue := autosync.NewQueue(filepath.Join(stateDir(cfg), autosync.QueueFileName), 0)
+	if err := queue.Load(); err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "⚠️  %v\n", err)
+		return
+	}
+	status.PrintDeadLetters(queue.DeadLetters(), cmd.OutOrStdout())
+}
+
+// printDaemonStatus describes what the running sync service is doing and
+// lists the operations it gave up on
+func printDaemonStatus(client *autosync.Client, cmd *cobra.Command) error {
+	ctx := context.Background()
+	daemonStatus, err := client.Status(ctx)
+	if err != nil {
+		return err
+	}
+	snapshot, err := client.Queue(ctx)
+	if err != nil {
+		return err
+	}
+
+	status.PrintDeadLetters(snapshot.DeadLetters, cmd.OutOrStdout())
+	fmt.Fprintf(cmd.OutOrStdout(), "\n%s\n", describeDaemon(daemonStatus, time.Now()))
+	return nil
+}
+
+// describeDaemon summarizes the state of the sync service in one line
+func describeDaemon(daemonStatus *autosync.DaemonStatus, now time.Time) string {
+	state := "watching"
+	switch {
+	case daemonStatus.Paused:
+		state = "paused"
+	case daemonStatus.Syncing:
+		state = "syncing"
+	}
+
+	line := fmt.Sprintf("🛰️  Sync service (pid %d) %s, %d pending operations", daemonStatus.PID, state, daemonStatus.Pending)
+	if !daemonStatus.LastSync.IsZero() {
+		line += fmt.Sprintf(", last sync %s ago", formatAge(now.Sub(daemonStatus.LastSync)))
+	}
+	if daemonStatus.LastError != "" {
+		line += fmt.Sprintf(" (failed: %s)", daemonStatus.LastError)
+	}
+	return line
 }
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/storage"
+)
+
+// newFileManager creates a file manager configured from the application config
+func newFileManager(cfg *config.Config) *storage.FileManager {
+	fileManager := storage.NewFileManager(cfg.Storage.BaseDir)
+	fileManager.SetSymlinkPolicy(storage.SymlinkPolicy(cfg.Sync.Symlinks))
+	return fileManager
+}
+
+// loadState loads the sync state into fileManager; a missing state file is
+// not an error. Commands holding the state lock pass migrate to upgrade the
+// file on disk to the current schema first.
+func loadState(cfg *config.Config, fileManager *storage.FileManager, migrate bool) error {
+	statePath := cfg.Storage.StatePath
+
+	if migrate {
+		if err := storage.MigrateState(statePath, cfg.Storage.BaseDir); err != nil {
+			return stateError(err)
+		}
+	}
+
+	err := fileManager.LoadState(statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return stateError(err)
+	}
+	return nil
+}
+
+// stateError explains how to recover from a state file that can't be loaded
+func stateError(err error) error {
+	var corruptErr *storage.CorruptStateError
+	if !errors.As(err, &corruptErr) {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	if corruptErr.BackupPath != "" {
+		return fmt.Errorf("%w\n💡 The previous state is intact, restore it with:\n   mv %s %s",
+			corruptErr, corruptErr.BackupPath, corruptErr.Path)
+	}
+	return fmt.Errorf("%w\n💡 Rebuild it from the local and remote files with 'catapult repair'", corruptErr)
+}
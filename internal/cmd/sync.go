@@ -2,16 +2,16 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 
-	"github.com/google/go-github/v57/github"
 	"github.com/itcaat/catapult/internal/autosync"
 	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/hooks"
 	"github.com/itcaat/catapult/internal/issues"
-	"github.com/itcaat/catapult/internal/repository"
-	"github.com/itcaat/catapult/internal/storage"
+	"github.com/itcaat/catapult/internal/lock"
 	"github.com/itcaat/catapult/internal/sync"
 	"github.com/spf13/cobra"
 )
@@ -19,11 +19,14 @@ import (
 // NewSyncCmd creates and returns the sync command
 func NewSyncCmd() *cobra.Command {
 	var watchMode bool
+	var rehash bool
 
 	cmd := &cobra.Command{
 		Use:   "sync",
 		Short: "Sync files with GitHub",
-		Long:  `Sync all files in the current directory with GitHub repository.`,
+		Long: `Sync all files in the current directory with GitHub repository.
+
+If the sync service is running, it is asked to sync instead.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Load configuration
 			cfg, err := config.Load()
@@ -31,36 +34,41 @@ func NewSyncCmd() *cobra.Command {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
 
+			// Hold the state lock for as long as state may change
+			stateLock, err := acquireLock(cfg, "sync", watchMode)
+			if err != nil {
+				var held *lock.HeldError
+				if !watchMode && errors.As(err, &held) && held.Owner.Daemon {
+					return delegateSync(cfg, held)
+				}
+				return err
+			}
+			defer stateLock.Release()
+
 			// Ensure base directory exists
 			if err := os.MkdirAll(cfg.Storage.BaseDir, 0755); err != nil {
 				return fmt.Errorf("failed to create base directory: %w", err)
 			}
 
 			// Create file manager
-			fileManager := storage.NewFileManager(cfg.Storage.BaseDir)
+			fileManager := newFileManager(cfg)
 
 			// Load state if exists
-			if err := fileManager.LoadState(cfg.Storage.StatePath); err != nil && !os.IsNotExist(err) {
-				return fmt.Errorf("failed to load state: %w", err)
+			if err := loadState(cfg, fileManager, true); err != nil {
+				return err
 			}
 
-			// Scan directory for files
-			if err := fileManager.ScanDirectory(); err != nil {
-				return fmt.Errorf("failed to scan directory: %w", err)
+			// Distrust the stat cache and hash every file on the next scan
+			if rehash {
+				fileManager.RehashAll()
 			}
 
-			// Create GitHub client
-			client := github.NewClient(nil).WithAuthToken(cfg.GitHub.Token)
-
-			// Get authenticated user
-			user, _, err := client.Users.Get(context.Background(), "")
+			// Connect to the repository, encrypted if enabled
+			repo, client, login, err := openRepository(context.Background(), cfg)
 			if err != nil {
-				return fmt.Errorf("failed to get user: %w", err)
+				return err
 			}
 
-			// Create repository instance
-			repo := repository.New(client, user.GetLogin(), cfg.Repository.Name)
-
 			// Create sync instance with issue management if enabled
 			var syncer *sync.Syncer
 			if cfg.Issues.Enabled {
@@ -68,7 +76,7 @@ func NewSyncCmd() *cobra.Command {
 				logger := log.New(os.Stdout, "[ISSUES] ", log.LstdFlags)
 
 				// Create issue manager
-				issueManager, err := issues.NewManager(client, user.GetLogin(), &cfg.Issues, logger)
+				issueManager, err := issues.NewManager(client, login, &cfg.Issues, logger)
 				if err != nil {
 					fmt.Printf("⚠️  Warning: Failed to initialize issue management: %v\n", err)
 					fmt.Println("💡 Continuing without automatic issue creation")
@@ -81,6 +89,8 @@ func NewSyncCmd() *cobra.Command {
 				syncer = sync.New(repo, fileManager)
 			}
 
+			configureSyncer(syncer, cfg)
+
 			// If watch mode is enabled, start auto-sync
 			if watchMode {
 				fmt.Println("🔄 Starting auto-sync with file watching...")
@@ -116,6 +126,20 @@ func NewSyncCmd() *cobra.Command {
 
 	// Add --watch flag
 	cmd.Flags().BoolVarP(&watchMode, "watch", "w", false, "Watch for file changes and sync automatically")
+	cmd.Flags().BoolVar(&rehash, "rehash", false, "Recalculate the hash of every file instead of trusting unchanged size and times")
 
 	return cmd
 }
+
+// configureSyncer applies the sync settings and hooks from configuration
+func configureSyncer(syncer *sync.Syncer, cfg *config.Config) {
+	// Preserve modification times across devices
+	syncer.SetPreserveTimes(cfg.Sync.PreserveTimes != "none", cfg.Sync.PreserveTimes == "mtime+ctime")
+
+	// Attach user-defined sync hooks
+	hookLogger := log.New(os.Stdout, "[HOOKS] ", log.LstdFlags)
+	syncer.SetHooks(hooks.NewRunner(&cfg.Hooks, cfg.Storage.BaseDir, hookLogger))
+
+	// Journal actions so an interrupted sync resumes where it stopped
+	syncer.SetJournal(sync.NewJournal(cfg.Storage.StatePath+sync.JournalSuffix), cfg.Storage.StatePath)
+}
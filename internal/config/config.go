@@ -25,6 +25,66 @@ type Config struct {
 		Name string `yaml:"name"`
 	} `yaml:"repository"`
 	Issues IssueConfig `yaml:"issues"`
+	Hooks  HookConfig  `yaml:"hooks"`
+	Sync   SyncConfig  `yaml:"sync"`
+
+	Encryption EncryptionConfig `yaml:"encryption"`
+	Webhook    WebhookConfig    `yaml:"webhook"`
+	AutoSync   AutoSyncConfig   `yaml:"autosync"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+}
+
+// MetricsConfig holds settings for the Prometheus metrics endpoint of the
+// auto-sync mode
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"` // Address serving /metrics
+}
+
+// AutoSyncConfig holds settings for the auto-sync mode. Switches left out of
+// the file keep their defaults.
+type AutoSyncConfig struct {
+	Enabled             *bool         `yaml:"enabled"`
+	WatchLocalChanges   *bool         `yaml:"watch_local_changes"`
+	CheckRemoteInterval time.Duration `yaml:"check_remote_interval"`
+	DebounceDelay       time.Duration `yaml:"debounce_delay"`
+	RetryAttempts       int           `yaml:"retry_attempts"`
+	OfflineQueue        *bool         `yaml:"offline_queue"`
+	MaxQueueSize        int           `yaml:"max_queue_size"`
+	NotificationLevel   string        `yaml:"notification_level"` // silent, minimal, verbose
+	IgnorePatterns      []string      `yaml:"ignore_patterns"`    // Added to the built-in patterns
+}
+
+// WebhookConfig holds settings for the listener receiving GitHub push
+// webhooks in auto-sync mode
+type WebhookConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Listen    string `yaml:"listen"`     // Address to listen on
+	Path      string `yaml:"path"`       // URL path receiving deliveries
+	Secret    string `yaml:"secret"`     // Secret set for the webhook on GitHub
+	SecretEnv string `yaml:"secret_env"` // Environment variable holding the secret if not set above
+}
+
+// ResolveSecret returns the webhook secret from the config or environment
+func (c *WebhookConfig) ResolveSecret() string {
+	if c.Secret != "" {
+		return c.Secret
+	}
+	return os.Getenv(c.SecretEnv)
+}
+
+// EncryptionConfig holds settings for client-side encryption of synced files
+type EncryptionConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	KeyFile       string `yaml:"key_file"`       // Path to a key file, takes precedence over a passphrase
+	PassphraseEnv string `yaml:"passphrase_env"` // Environment variable holding the passphrase
+	EncryptNames  bool   `yaml:"encrypt_names"`
+}
+
+// SyncConfig holds settings controlling how files are synchronized
+type SyncConfig struct {
+	Symlinks      string `yaml:"symlinks"`       // follow, preserve, skip
+	PreserveTimes string `yaml:"preserve_times"` // none, mtime, mtime+ctime
 }
 
 // IssueConfig holds configuration for GitHub issue management
@@ -42,6 +102,24 @@ type IssueConfig struct {
 	ResolutionCheckInterval time.Duration `yaml:"resolution_check_interval"`
 }
 
+// HookConfig holds paths to user executables run around synchronization
+type HookConfig struct {
+	PreSync      string        `yaml:"pre_sync"`
+	PostSync     string        `yaml:"post_sync"`
+	PostDownload string        `yaml:"post_download"`
+	OnConflict   string        `yaml:"on_conflict"`
+	Timeout      time.Duration `yaml:"timeout"`
+}
+
+// Path returns the path of the config file, ~/.catapult/config.yaml
+func Path() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".catapult", "config.yaml"), nil
+}
+
 // Load loads config from ~/.catapult/config.yaml
 func Load() (*Config, error) {
 	home, err := os.UserHomeDir()
@@ -76,9 +154,66 @@ func Load() (*Config, error) {
 	// Set issue management defaults
 	setIssueDefaults(&cfg.Issues)
 
+	// Set hook defaults
+	if cfg.Hooks.Timeout == 0 {
+		cfg.Hooks.Timeout = 30 * time.Second
+	}
+
+	// Set sync defaults
+	if cfg.Sync.Symlinks == "" {
+		cfg.Sync.Symlinks = "preserve"
+	}
+	switch cfg.Sync.Symlinks {
+	case "follow", "preserve", "skip":
+	default:
+		return nil, fmt.Errorf("invalid sync.symlinks value %q (expected follow, preserve or skip)", cfg.Sync.Symlinks)
+	}
+	if cfg.Sync.PreserveTimes == "" {
+		cfg.Sync.PreserveTimes = "mtime"
+	}
+	switch cfg.Sync.PreserveTimes {
+	case "none", "mtime", "mtime+ctime":
+	default:
+		return nil, fmt.Errorf("invalid sync.preserve_times value %q (expected none, mtime or mtime+ctime)", cfg.Sync.PreserveTimes)
+	}
+
+	// Set encryption defaults
+	if cfg.Encryption.PassphraseEnv == "" {
+		cfg.Encryption.PassphraseEnv = "CATAPULT_PASSPHRASE"
+	}
+
+	// Set webhook defaults
+	if cfg.Webhook.Listen == "" {
+		cfg.Webhook.Listen = "127.0.0.1:8765"
+	}
+	if cfg.Webhook.Path == "" {
+		cfg.Webhook.Path = "/webhook"
+	}
+	if !strings.HasPrefix(cfg.Webhook.Path, "/") {
+		cfg.Webhook.Path = "/" + cfg.Webhook.Path
+	}
+	if cfg.Webhook.SecretEnv == "" {
+		cfg.Webhook.SecretEnv = "CATAPULT_WEBHOOK_SECRET"
+	}
+
+	// Set metrics defaults
+	if cfg.Metrics.Listen == "" {
+		cfg.Metrics.Listen = "127.0.0.1:9465"
+	}
+
+	// Set auto-sync defaults
+	if err := setAutoSyncDefaults(&cfg.AutoSync); err != nil {
+		return nil, err
+	}
+
 	// Expand tilde paths if they exist
 	cfg.Storage.BaseDir = expandTildePath(cfg.Storage.BaseDir, home)
 	cfg.Storage.StatePath = expandTildePath(cfg.Storage.StatePath, home)
+	cfg.Hooks.PreSync = expandTildePath(cfg.Hooks.PreSync, home)
+	cfg.Hooks.PostSync = expandTildePath(cfg.Hooks.PostSync, home)
+	cfg.Hooks.PostDownload = expandTildePath(cfg.Hooks.PostDownload, home)
+	cfg.Hooks.OnConflict = expandTildePath(cfg.Hooks.OnConflict, home)
+	cfg.Encryption.KeyFile = expandTildePath(cfg.Encryption.KeyFile, home)
 
 	return cfg, nil
 }
@@ -143,7 +278,46 @@ issues:
     - auto-generated
   assignees: []
   max_open_issues: 10
-  resolution_check_interval: 5m`,
+  resolution_check_interval: 5m
+
+hooks:
+  pre_sync: ""
+  post_sync: ""
+  post_download: ""
+  on_conflict: ""
+  timeout: 30s
+
+sync:
+  symlinks: preserve
+  preserve_times: mtime
+
+encryption:
+  enabled: false
+  key_file: ""
+  passphrase_env: CATAPULT_PASSPHRASE
+  encrypt_names: false
+
+webhook:
+  enabled: false
+  listen: 127.0.0.1:8765
+  path: /webhook
+  secret: ""
+  secret_env: CATAPULT_WEBHOOK_SECRET
+
+autosync:
+  enabled: true
+  watch_local_changes: true
+  check_remote_interval: 5m
+  debounce_delay: 2s
+  retry_attempts: 3
+  offline_queue: true
+  max_queue_size: 100
+  notification_level: minimal
+  ignore_patterns: []
+
+metrics:
+  enabled: false
+  listen: 127.0.0.1:9465`,
 		filepath.Join(home, "Catapult"),
 		filepath.Join(home, ".catapult", "state.json"))
 
@@ -276,3 +450,47 @@ func setIssueDefaults(cfg *IssueConfig) {
 		cfg.IncludeSystemInfo = false // Privacy-conscious default
 	}
 }
+
+// setAutoSyncDefaults sets default values for the auto-sync mode and
+// validates the configured ones
+func setAutoSyncDefaults(cfg *AutoSyncConfig) error {
+	for _, flag := range []**bool{&cfg.Enabled, &cfg.WatchLocalChanges, &cfg.OfflineQueue} {
+		if *flag == nil {
+			enabled := true
+			*flag = &enabled
+		}
+	}
+
+	if cfg.CheckRemoteInterval == 0 {
+		cfg.CheckRemoteInterval = 5 * time.Minute
+	}
+	if cfg.DebounceDelay == 0 {
+		cfg.DebounceDelay = 2 * time.Second
+	}
+	if cfg.RetryAttempts == 0 {
+		cfg.RetryAttempts = 3
+	}
+	if cfg.MaxQueueSize == 0 {
+		cfg.MaxQueueSize = 100
+	}
+	if cfg.NotificationLevel == "" {
+		cfg.NotificationLevel = "minimal"
+	}
+
+	switch {
+	case cfg.CheckRemoteInterval < 10*time.Second:
+		return fmt.Errorf("invalid autosync.check_remote_interval %s (expected at least 10s)", cfg.CheckRemoteInterval)
+	case cfg.DebounceDelay < 0:
+		return fmt.Errorf("invalid autosync.debounce_delay %s (expected a positive duration)", cfg.DebounceDelay)
+	case cfg.RetryAttempts < 0:
+		return fmt.Errorf("invalid autosync.retry_attempts %d (expected a positive number)", cfg.RetryAttempts)
+	case cfg.MaxQueueSize < 0:
+		return fmt.Errorf("invalid autosync.max_queue_size %d (expected a positive number)", cfg.MaxQueueSize)
+	}
+	switch cfg.NotificationLevel {
+	case "silent", "minimal", "verbose":
+	default:
+		return fmt.Errorf("invalid autosync.notification_level value %q (expected silent, minimal or verbose)", cfg.NotificationLevel)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -35,6 +36,12 @@ func TestLoad(t *testing.T) {
 	if cfg.Storage.BaseDir != expectedBaseDir {
 		t.Errorf("Expected default base dir %s, got %s", expectedBaseDir, cfg.Storage.BaseDir)
 	}
+	if cfg.Webhook.Enabled || cfg.Webhook.Listen != "127.0.0.1:8765" || cfg.Webhook.Path != "/webhook" {
+		t.Errorf("Expected the webhook listener to be off and local by default, got %+v", cfg.Webhook)
+	}
+	if cfg.Metrics.Enabled || cfg.Metrics.Listen != "127.0.0.1:9465" {
+		t.Errorf("Expected the metrics endpoint to be off and local by default, got %+v", cfg.Metrics)
+	}
 
 	// Test loading with existing config file
 	testConfig := `github:
@@ -343,3 +350,56 @@ repository:
 		t.Errorf("Expected token 'test-token', got %s", cfg.GitHub.Token)
 	}
 }
+
+func TestLoadAutoSync(t *testing.T) {
+	tempDir := t.TempDir()
+	originalHome := os.Getenv("HOME")
+	os.Setenv("HOME", tempDir)
+	defer os.Setenv("HOME", originalHome)
+
+	configDir := filepath.Join(tempDir, ".catapult")
+	configPath := filepath.Join(configDir, "config.yaml")
+	os.MkdirAll(configDir, 0755)
+
+	// Unset values get defaults, set ones are kept
+	testConfig := `autosync:
+  offline_queue: false
+  debounce_delay: 500ms
+  ignore_patterns:
+    - "*.bak"`
+	if err := os.WriteFile(configPath, []byte(testConfig), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	autoSync := cfg.AutoSync
+	if !*autoSync.Enabled || !*autoSync.WatchLocalChanges || *autoSync.OfflineQueue {
+		t.Errorf("Expected switches to default to on unless set, got %+v", autoSync)
+	}
+	if autoSync.DebounceDelay != 500*time.Millisecond || autoSync.CheckRemoteInterval != 5*time.Minute {
+		t.Errorf("Expected configured debounce and default remote interval, got %s and %s", autoSync.DebounceDelay, autoSync.CheckRemoteInterval)
+	}
+	if autoSync.RetryAttempts != 3 || autoSync.MaxQueueSize != 100 || autoSync.NotificationLevel != "minimal" {
+		t.Errorf("Expected default retries, queue size and notifications, got %+v", autoSync)
+	}
+	if len(autoSync.IgnorePatterns) != 1 || autoSync.IgnorePatterns[0] != "*.bak" {
+		t.Errorf("Expected ignore patterns to be loaded, got %v", autoSync.IgnorePatterns)
+	}
+
+	// Invalid values are rejected
+	for _, invalid := range []string{
+		"autosync:\n  notification_level: loud",
+		"autosync:\n  check_remote_interval: 1s",
+		"autosync:\n  retry_attempts: -1",
+	} {
+		if err := os.WriteFile(configPath, []byte(invalid), 0600); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+		if _, err := Load(); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
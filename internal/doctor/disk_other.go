@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package doctor
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// freeDiskSpace returns the bytes available on the file system of path
+func freeDiskSpace(path string) (uint64, error) {
+	return 0, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,17 @@
+//go:build linux || darwin
+
+package doctor
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// freeDiskSpace returns the bytes available to the user on the file system of path
+func freeDiskSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, fmt.Errorf("failed to stat file system: %w", err)
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
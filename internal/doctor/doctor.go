@@ -0,0 +1,529 @@
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/itcaat/catapult/internal/autosync"
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/network"
+	"github.com/itcaat/catapult/internal/service"
+	"github.com/itcaat/catapult/internal/storage"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// Thresholds for the local checks
+const (
+	clockSkewWarn = 30 * time.Second
+	clockSkewFail = 5 * time.Minute
+	diskSpaceWarn = 1 << 30   // 1 GiB
+	diskSpaceFail = 100 << 20 // 100 MiB
+)
+
+// Result is the outcome of a single check, with remediation for anything
+// that didn't pass
+type Result struct {
+	Check   string `json:"check"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	Remedy  string `json:"remedy,omitempty"`
+}
+
+// Report collects the results of all checks
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Failed returns the number of failed checks
+func (r *Report) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if result.Status == StatusFail {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Print writes the report in human-readable form
+func (r *Report) Print(out io.Writer) {
+	for _, result := range r.Results {
+		fmt.Fprintf(out, "%s %-12s %s\n", statusEmoji(result.Status), result.Check, result.Message)
+		if result.Remedy != "" {
+			fmt.Fprintf(out, "   💡 %s\n", result.Remedy)
+		}
+	}
+
+	counts := map[Status]int{}
+	for _, result := range r.Results {
+		counts[result.Status]++
+	}
+	fmt.Fprintf(out, "\n%d passed, %d warnings, %d failed\n", counts[StatusPass], counts[StatusWarn], counts[StatusFail])
+}
+
+// PrintJSON writes the report as JSON
+func (r *Report) PrintJSON(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// statusEmoji returns the emoji displayed for a status
+func statusEmoji(status Status) string {
+	switch status {
+	case StatusPass:
+		return "✅"
+	case StatusWarn:
+		return "⚠️ "
+	default:
+		return "❌"
+	}
+}
+
+// Doctor runs end-to-end diagnostics of a catapult installation
+type Doctor struct {
+	cfg      *config.Config
+	client   *github.Client
+	detector *network.Detector
+	services service.ServiceManager
+	now      func() time.Time
+
+	login      string
+	serverTime time.Time // Reported by GitHub, for the clock skew check
+}
+
+// New creates a Doctor. services may be nil if the platform has no service
+// manager.
+func New(cfg *config.Config, client *github.Client, detector *network.Detector, services service.ServiceManager) *Doctor {
+	return &Doctor{
+		cfg:      cfg,
+		client:   client,
+		detector: detector,
+		services: services,
+		now:      time.Now,
+	}
+}
+
+// ConfigError reports a configuration that couldn't be loaded, for when no
+// other check can run
+func ConfigError(err error) *Report {
+	return &Report{Results: []Result{{
+		Check:   "config",
+		Status:  StatusFail,
+		Message: err.Error(),
+		Remedy:  "Fix ~/.catapult/config.yaml, or move it aside and run 'catapult init' to recreate it",
+	}}}
+}
+
+// Run performs every check. GitHub checks are skipped without a token.
+func (d *Doctor) Run(ctx context.Context) *Report {
+	report := &Report{}
+	report.Results = append(report.Results, d.checkConfig())
+
+	if d.cfg.GitHub.Token != "" {
+		token := d.checkToken(ctx)
+		report.Results = append(report.Results, token)
+		if token.Status != StatusFail {
+			report.Results = append(report.Results, d.checkRepository(ctx))
+		}
+	}
+
+	report.Results = append(report.Results,
+		d.checkNetwork(),
+		d.checkState(),
+		d.checkQueue(),
+		d.checkWatchLimit(),
+		d.checkService(),
+		d.checkClock(),
+		d.checkDiskSpace(),
+	)
+	return report
+}
+
+// checkConfig validates the loaded configuration
+func (d *Doctor) checkConfig() Result {
+	result := Result{Check: "config"}
+
+	if d.cfg.GitHub.Token == "" {
+		result.Status = StatusFail
+		result.Message = "no GitHub token configured"
+		result.Remedy = "Run 'catapult init' to authenticate"
+		return result
+	}
+
+	info, err := os.Stat(d.cfg.Storage.BaseDir)
+	switch {
+	case os.IsNotExist(err):
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("synced folder %s does not exist yet", d.cfg.Storage.BaseDir)
+		result.Remedy = "It is created by the first 'catapult sync'"
+	case err != nil:
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("can't access synced folder: %v", err)
+		result.Remedy = "Check the permissions of storage.basedir"
+	case !info.IsDir():
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("synced folder %s is not a directory", d.cfg.Storage.BaseDir)
+		result.Remedy = "Point storage.basedir at a directory, or use 'catapult relocate'"
+	default:
+		result.Status = StatusPass
+		result.Message = fmt.Sprintf("syncing %s with repository %s", d.cfg.Storage.BaseDir, d.cfg.Repository.Name)
+	}
+	return result
+}
+
+// checkToken verifies the token and its OAuth scopes
+func (d *Doctor) checkToken(ctx context.Context) Result {
+	result := Result{Check: "token"}
+
+	user, resp, err := d.client.Users.Get(ctx, "")
+	if resp != nil {
+		d.recordServerTime(resp)
+	}
+	if err != nil {
+		result.Status = StatusFail
+		if resp != nil && resp.StatusCode == 401 {
+			result.Message = "GitHub rejected the token"
+			result.Remedy = "The token was revoked or expired; run 'catapult init' to authenticate again"
+		} else {
+			result.Message = fmt.Sprintf("failed to verify token: %v", err)
+			result.Remedy = "Check the network checks below"
+		}
+		return result
+	}
+	d.login = user.GetLogin()
+
+	header := resp.Header.Get("X-OAuth-Scopes")
+	if header == "" {
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("authenticated as %s; scopes can't be checked for this kind of token", d.login)
+		result.Remedy = "Make sure the token can read and write repository contents"
+		return result
+	}
+
+	granted := make(map[string]bool)
+	for _, scope := range strings.Split(header, ",") {
+		granted[strings.TrimSpace(scope)] = true
+	}
+	var missing []string
+	for _, scope := range d.cfg.GitHub.Scopes {
+		if !granted[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) > 0 {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("authenticated as %s, but the token lacks scopes: %s", d.login, strings.Join(missing, ", "))
+		result.Remedy = "Run 'catapult init' to authenticate with the configured scopes"
+		return result
+	}
+
+	result.Status = StatusPass
+	result.Message = fmt.Sprintf("authenticated as %s (scopes: %s)", d.login, header)
+	return result
+}
+
+// checkRepository verifies access to the sync repository and its default branch
+func (d *Doctor) checkRepository(ctx context.Context) Result {
+	result := Result{Check: "repository"}
+	name := d.login + "/" + d.cfg.Repository.Name
+
+	repo, resp, err := d.client.Repositories.Get(ctx, d.login, d.cfg.Repository.Name)
+	if err != nil {
+		if resp != nil && resp.StatusCode == 404 {
+			result.Status = StatusWarn
+			result.Message = fmt.Sprintf("repository %s does not exist", name)
+			result.Remedy = "It is created by the first 'catapult sync'"
+			return result
+		}
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("failed to access repository %s: %v", name, err)
+		result.Remedy = "Check that the token can access the repository"
+		return result
+	}
+
+	if !repo.GetPermissions()["push"] {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("no write access to %s", name)
+		result.Remedy = "Grant the token write access, or set repository.name to a repository you own"
+		return result
+	}
+
+	result.Status = StatusPass
+	result.Message = fmt.Sprintf("%s, default branch %s", name, repo.GetDefaultBranch())
+	if !repo.GetPrivate() {
+		result.Status = StatusWarn
+		result.Message += ", public"
+		result.Remedy = "Anyone can read your synced files; make the repository private or enable encryption"
+	}
+	return result
+}
+
+// checkNetwork probes the connectivity endpoints
+func (d *Doctor) checkNetwork() Result {
+	result := Result{Check: "network"}
+
+	var unreachable []string
+	gitHubDown := false
+	for _, endpoint := range d.detector.Endpoints() {
+		if d.detector.CheckEndpoint(endpoint) {
+			continue
+		}
+		unreachable = append(unreachable, endpoint)
+		if strings.Contains(endpoint, "github.com") {
+			gitHubDown = true
+		}
+	}
+
+	switch {
+	case gitHubDown:
+		result.Status = StatusFail
+		result.Message = "unreachable: " + strings.Join(unreachable, ", ")
+		result.Remedy = "Check your connection, proxy and firewall; changes are queued until GitHub is reachable"
+	case len(unreachable) > 0:
+		result.Status = StatusWarn
+		result.Message = "GitHub is reachable, but not: " + strings.Join(unreachable, ", ")
+	default:
+		result.Status = StatusPass
+		result.Message = "all endpoints reachable"
+	}
+	return result
+}
+
+// checkState verifies the state file can be loaded
+func (d *Doctor) checkState() Result {
+	result := Result{Check: "state"}
+	statePath := d.cfg.Storage.StatePath
+
+	err := storage.NewFileManager(d.cfg.Storage.BaseDir).LoadState(statePath)
+	var corruptErr *storage.CorruptStateError
+	var versionErr *storage.StateVersionError
+	switch {
+	case err == nil:
+		result.Status = StatusPass
+		result.Message = fmt.Sprintf("%s is intact", statePath)
+	case errors.Is(err, os.ErrNotExist):
+		result.Status = StatusPass
+		result.Message = "no state yet"
+	case errors.As(err, &corruptErr):
+		result.Status = StatusFail
+		result.Message = corruptErr.Error()
+		if corruptErr.BackupPath != "" {
+			result.Remedy = fmt.Sprintf("Restore the previous state with 'mv %s %s'", corruptErr.BackupPath, statePath)
+		} else {
+			result.Remedy = "Rebuild it with 'catapult repair'"
+		}
+	case errors.As(err, &versionErr):
+		result.Status = StatusFail
+		result.Message = versionErr.Error()
+		result.Remedy = "Upgrade catapult"
+	default:
+		result.Status = StatusFail
+		result.Message = err.Error()
+		result.Remedy = "Check the permissions of storage.statepath"
+	}
+	return result
+}
+
+// checkQueue verifies the offline queue file can be loaded
+func (d *Doctor) checkQueue() Result {
+	result := Result{Check: "queue"}
+	queuePath := filepath.Join(filepath.Dir(d.cfg.Storage.StatePath), autosync.QueueFileName)
+
+	if _, err := os.Stat(queuePath); os.IsNotExist(err) {
+		result.Status = StatusPass
+		result.Message = "no queued operations"
+		return result
+	}
+
+	queue := autosync.NewQueue(queuePath, 0)
+	if err := queue.Load(); err != nil {
+		result.Status = StatusFail
+		result.Message = err.Error()
+		result.Remedy = fmt.Sprintf("Remove %s; the next sync picks up every change anyway", queuePath)
+		return result
+	}
+
+	result.Status = StatusPass
+	result.Message = fmt.Sprintf("%d queued operations", queue.Size())
+	if queue.ResyncNeeded() {
+		result.Message += ", full resync pending"
+	}
+	return result
+}
+
+// checkWatchLimit compares the directories to watch with the watch limit
+func (d *Doctor) checkWatchLimit() Result {
+	result := Result{Check: "watcher"}
+
+	limit, ok := watchLimit()
+	if !ok {
+		result.Status = StatusPass
+		result.Message = "no watch limit on this platform"
+		return result
+	}
+
+	dirs := countDirs(d.cfg.Storage.BaseDir, autosync.NewWatchConfig(autosync.NewConfig(&d.cfg.AutoSync)))
+	result.Status, result.Message = evaluateWatchLimit(dirs, limit)
+	if result.Status != StatusPass {
+		result.Remedy = fmt.Sprintf("Raise the limit: sudo sysctl fs.inotify.max_user_watches=%d (add it to /etc/sysctl.conf to persist)", max(4*dirs, 524288))
+	}
+	return result
+}
+
+// evaluateWatchLimit rates the number of directories against the watch limit,
+// leaving headroom for other applications
+func evaluateWatchLimit(dirs, limit int) (Status, string) {
+	message := fmt.Sprintf("%d directories to watch, limit %d", dirs, limit)
+	switch {
+	case dirs >= limit:
+		return StatusFail, message
+	case dirs*2 >= limit:
+		return StatusWarn, message
+	default:
+		return StatusPass, message
+	}
+}
+
+// countDirs counts the directories under root the watcher would watch,
+// itself included
+func countDirs(root string, watchConfig *autosync.WatchConfig) int {
+	count := 0
+	filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+		if relPath, err := filepath.Rel(root, path); err == nil && path != root && watchConfig.ShouldIgnore(relPath) {
+			return filepath.SkipDir
+		}
+		count++
+		return nil
+	})
+	return count
+}
+
+// checkService reports whether the auto-sync service is installed and running
+func (d *Doctor) checkService() Result {
+	result := Result{Check: "service"}
+
+	switch {
+	case d.services == nil:
+		result.Status = StatusWarn
+		result.Message = "services aren't supported on this platform"
+		result.Remedy = "Run 'catapult sync --watch' to sync automatically"
+	case !d.services.IsInstalled():
+		result.Status = StatusWarn
+		result.Message = "auto-sync service not installed"
+		result.Remedy = "Run 'catapult service install' to sync in the background"
+	case !d.services.IsRunning():
+		result.Status = StatusWarn
+		result.Message = "auto-sync service installed but not running"
+		result.Remedy = "Run 'catapult service start', and 'catapult service logs' if it stops again"
+	default:
+		result.Status = StatusPass
+		result.Message = "auto-sync service running"
+	}
+	return result
+}
+
+// checkClock compares the local clock with GitHub's
+func (d *Doctor) checkClock() Result {
+	result := Result{Check: "clock"}
+
+	if d.serverTime.IsZero() {
+		result.Status = StatusWarn
+		result.Message = "couldn't get the time from GitHub"
+		return result
+	}
+
+	skew := d.now().Sub(d.serverTime)
+	result.Status, result.Message = evaluateClockSkew(skew)
+	if result.Status != StatusPass {
+		result.Remedy = "Enable automatic time synchronization (NTP); file times and token checks depend on it"
+	}
+	return result
+}
+
+// evaluateClockSkew rates the difference between the local and GitHub clocks
+func evaluateClockSkew(skew time.Duration) (Status, string) {
+	if skew < 0 {
+		skew = -skew
+	}
+	message := fmt.Sprintf("local clock is off by %s", skew.Round(time.Second))
+
+	switch {
+	case skew >= clockSkewFail:
+		return StatusFail, message
+	case skew >= clockSkewWarn:
+		return StatusWarn, message
+	default:
+		return StatusPass, "local clock matches GitHub"
+	}
+}
+
+// recordServerTime keeps the time reported by a GitHub response
+func (d *Doctor) recordServerTime(resp *github.Response) {
+	if resp.Response == nil {
+		return
+	}
+	if date, err := time.Parse(time.RFC1123, resp.Header.Get("Date")); err == nil {
+		// The header has a resolution of one second
+		d.serverTime = date.Add(500 * time.Millisecond)
+	}
+}
+
+// checkDiskSpace reports the free space where the synced folder lives
+func (d *Doctor) checkDiskSpace() Result {
+	result := Result{Check: "disk"}
+
+	// The synced folder may not exist yet
+	dir := d.cfg.Storage.BaseDir
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("couldn't check free space: %v", err)
+		return result
+	}
+
+	result.Status, result.Message = evaluateDiskSpace(free)
+	if result.Status != StatusPass {
+		result.Remedy = "Free up space; downloads fail when the disk is full"
+	}
+	return result
+}
+
+// evaluateDiskSpace rates the free space in bytes
+func evaluateDiskSpace(free uint64) (Status, string) {
+	message := fmt.Sprintf("%.1f GiB free", float64(free)/(1<<30))
+	switch {
+	case free < diskSpaceFail:
+		return StatusFail, message
+	case free < diskSpaceWarn:
+		return StatusWarn, message
+	default:
+		return StatusPass, message
+	}
+}
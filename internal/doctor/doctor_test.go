@@ -0,0 +1,130 @@
+package doctor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDoctor creates a Doctor talking to a fake GitHub API
+func newTestDoctor(t *testing.T, handler http.Handler) *Doctor {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.GitHub.Token = "token"
+	cfg.GitHub.Scopes = []string{"repo"}
+	cfg.Repository.Name = "catapult-folder"
+	cfg.Storage.BaseDir = filepath.Join(dir, "files")
+	cfg.Storage.StatePath = filepath.Join(dir, "state.json")
+
+	return New(cfg, client, nil, nil)
+}
+
+func TestCheckToken(t *testing.T) {
+	serverTime := time.Now().Add(-time.Hour).UTC()
+	scopes := "repo, workflow"
+
+	d := newTestDoctor(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", serverTime.Format(http.TimeFormat))
+		w.Header().Set("X-OAuth-Scopes", scopes)
+		w.Write([]byte(`{"login":"octocat"}`))
+	}))
+	ctx := context.Background()
+
+	result := d.checkToken(ctx)
+	assert.Equal(t, StatusPass, result.Status)
+	assert.Equal(t, "octocat", d.login)
+
+	// The clock skew is measured against GitHub's Date header
+	clock := d.checkClock()
+	assert.Equal(t, StatusFail, clock.Status)
+	assert.Contains(t, clock.Message, "1h0m")
+
+	scopes = "gist"
+	result = d.checkToken(ctx)
+	assert.Equal(t, StatusFail, result.Status)
+	assert.Contains(t, result.Message, "lacks scopes: repo")
+	assert.NotEmpty(t, result.Remedy)
+}
+
+func TestCheckRepository(t *testing.T) {
+	private := true
+	d := newTestDoctor(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/octocat/catapult-folder":
+			if private {
+				w.Write([]byte(`{"default_branch":"main","private":true,"permissions":{"push":true}}`))
+			} else {
+				w.Write([]byte(`{"default_branch":"main","private":false,"permissions":{"push":true}}`))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	d.login = "octocat"
+	ctx := context.Background()
+
+	result := d.checkRepository(ctx)
+	assert.Equal(t, StatusPass, result.Status)
+	assert.Contains(t, result.Message, "default branch main")
+
+	private = false
+	result = d.checkRepository(ctx)
+	assert.Equal(t, StatusWarn, result.Status)
+
+	// A missing repository is created by the first sync
+	d.cfg.Repository.Name = "missing"
+	result = d.checkRepository(ctx)
+	assert.Equal(t, StatusWarn, result.Status)
+}
+
+func TestCheckState(t *testing.T) {
+	d := newTestDoctor(t, http.NotFoundHandler())
+
+	assert.Equal(t, StatusPass, d.checkState().Status)
+
+	require.NoError(t, os.WriteFile(d.cfg.Storage.StatePath, []byte(`{"version":2,"files":`), 0600))
+	result := d.checkState()
+	assert.Equal(t, StatusFail, result.Status)
+	assert.Contains(t, result.Remedy, "catapult repair")
+
+	queuePath := filepath.Join(filepath.Dir(d.cfg.Storage.StatePath), "queue.json")
+	require.NoError(t, os.WriteFile(queuePath, []byte(`{`), 0600))
+	assert.Equal(t, StatusFail, d.checkQueue().Status)
+}
+
+func TestEvaluate(t *testing.T) {
+	status, _ := evaluateWatchLimit(100, 8192)
+	assert.Equal(t, StatusPass, status)
+	status, _ = evaluateWatchLimit(5000, 8192)
+	assert.Equal(t, StatusWarn, status)
+	status, _ = evaluateWatchLimit(9000, 8192)
+	assert.Equal(t, StatusFail, status)
+
+	status, _ = evaluateClockSkew(-2 * time.Second)
+	assert.Equal(t, StatusPass, status)
+	status, _ = evaluateClockSkew(-time.Minute)
+	assert.Equal(t, StatusWarn, status)
+
+	status, _ = evaluateDiskSpace(10 << 30)
+	assert.Equal(t, StatusPass, status)
+	status, _ = evaluateDiskSpace(500 << 20)
+	assert.Equal(t, StatusWarn, status)
+	status, _ = evaluateDiskSpace(10 << 20)
+	assert.Equal(t, StatusFail, status)
+}
@@ -0,0 +1,20 @@
+package doctor
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// watchLimit returns the inotify watch limit for the user
+func watchLimit() (int, bool) {
+	data, err := os.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		return 0, false
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false
+	}
+	return limit, true
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package doctor
+
+// watchLimit returns the watch limit; only inotify has a per-user limit
+func watchLimit() (int, bool) {
+	return 0, false
+}
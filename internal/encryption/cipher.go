@@ -0,0 +1,110 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// magic prefixes every encrypted file so plaintext files can be told apart
+var magic = []byte("CATAPULT-ENC1\x00")
+
+// nameEncoding encodes encrypted path segments safely for file names
+var nameEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// DecryptError represents a repository file that could not be decrypted
+type DecryptError struct {
+	Path   string
+	Reason string
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("failed to decrypt '%s': %s", e.Path, e.Reason)
+}
+
+// IsEncrypted reports whether content carries the encrypted file header
+func IsEncrypted(content []byte) bool {
+	return bytes.HasPrefix(content, magic)
+}
+
+// nonceFor derives a deterministic nonce from the path and plaintext, so the
+// same content at the same path always encrypts to the same ciphertext and
+// unchanged files don't produce new commits
+func (k *Key) nonceFor(domain, relPath string, plaintext []byte) []byte {
+	mac := hmac.New(sha256.New, k.nonce)
+	mac.Write([]byte(domain))
+	mac.Write([]byte{0})
+	mac.Write([]byte(relPath))
+	mac.Write([]byte{0})
+	mac.Write(plaintext)
+	return mac.Sum(nil)[:k.content.NonceSize()]
+}
+
+// EncryptContent encrypts file content. The plaintext path is authenticated,
+// so an encrypted file can't be moved to another path unnoticed.
+func (k *Key) EncryptContent(relPath string, plaintext []byte) []byte {
+	relPath = filepath.ToSlash(relPath)
+	nonce := k.nonceFor("content", relPath, plaintext)
+
+	out := make([]byte, 0, len(magic)+len(nonce)+len(plaintext)+k.content.Overhead())
+	out = append(out, magic...)
+	out = append(out, nonce...)
+	return k.content.Seal(out, nonce, plaintext, []byte(relPath))
+}
+
+// DecryptContent decrypts and authenticates file content
+func (k *Key) DecryptContent(relPath string, ciphertext []byte) ([]byte, error) {
+	relPath = filepath.ToSlash(relPath)
+	if !IsEncrypted(ciphertext) {
+		return nil, &DecryptError{Path: relPath, Reason: "file is not encrypted"}
+	}
+
+	data := ciphertext[len(magic):]
+	nonceSize := k.content.NonceSize()
+	if len(data) < nonceSize+k.content.Overhead() {
+		return nil, &DecryptError{Path: relPath, Reason: "file is truncated"}
+	}
+
+	plaintext, err := k.content.Open(nil, data[:nonceSize], data[nonceSize:], []byte(relPath))
+	if err != nil {
+		return nil, &DecryptError{Path: relPath, Reason: "authentication failed (wrong key or tampered file)"}
+	}
+	return plaintext, nil
+}
+
+// EncryptName encrypts every segment of a path. Segments are encrypted
+// independently so files in the same directory stay in the same directory.
+func (k *Key) EncryptName(relPath string) string {
+	segments := strings.Split(filepath.ToSlash(relPath), "/")
+	for i, segment := range segments {
+		nonce := k.nonceFor("name", "", []byte(segment))
+		sealed := k.names.Seal(append([]byte{}, nonce...), nonce, []byte(segment), nil)
+		segments[i] = nameEncoding.EncodeToString(sealed)
+	}
+	return filepath.FromSlash(path.Join(segments...))
+}
+
+// DecryptName reverses EncryptName
+func (k *Key) DecryptName(relPath string) (string, error) {
+	segments := strings.Split(filepath.ToSlash(relPath), "/")
+	nonceSize := k.names.NonceSize()
+
+	for i, segment := range segments {
+		sealed, err := nameEncoding.DecodeString(segment)
+		if err != nil || len(sealed) < nonceSize+k.names.Overhead() {
+			return "", &DecryptError{Path: relPath, Reason: "file name is not encrypted"}
+		}
+
+		plain, err := k.names.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+		if err != nil {
+			return "", &DecryptError{Path: relPath, Reason: "file name authentication failed (wrong key or tampered name)"}
+		}
+		segments[i] = string(plain)
+	}
+	return filepath.FromSlash(path.Join(segments...)), nil
+}
@@ -0,0 +1,319 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/repository"
+	"github.com/itcaat/catapult/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRepository is an in-memory repository storing exactly what it's given
+type memoryRepository struct {
+	files map[string]*repository.RemoteFileInfo
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{files: make(map[string]*repository.RemoteFileInfo)}
+}
+
+func (m *memoryRepository) EnsureExists(ctx context.Context) error { return nil }
+
+func (m *memoryRepository) GetDefaultBranch(ctx context.Context) (string, error) { return "main", nil }
+
+func (m *memoryRepository) CreateFile(ctx context.Context, path, content string) error {
+	return m.PutFile(ctx, path, content, storage.GitModeRegular)
+}
+
+func (m *memoryRepository) GetFile(ctx context.Context, path string) (string, error) {
+	file, ok := m.files[path]
+	if !ok {
+		return "", fmt.Errorf("file %s not found", path)
+	}
+	return file.Content, nil
+}
+
+func (m *memoryRepository) UpdateFile(ctx context.Context, path, content string) error {
+	return m.PutFile(ctx, path, content, storage.GitModeRegular)
+}
+
+func (m *memoryRepository) PutFile(ctx context.Context, path, content, mode string) error {
+	m.files[path] = &repository.RemoteFileInfo{Path: path, Content: content, SHA: gitBlobSHA([]byte(content)), Size: len(content), Mode: mode}
+	return nil
+}
+
+func (m *memoryRepository) MoveFile(ctx context.Context, oldPath, newPath, content, mode string) error {
+	delete(m.files, oldPath)
+	return m.PutFile(ctx, newPath, content, mode)
+}
+
+func (m *memoryRepository) DeleteFile(ctx context.Context, path string) error {
+	delete(m.files, path)
+	return nil
+}
+
+func (m *memoryRepository) FileExists(ctx context.Context, path string) (bool, error) {
+	_, ok := m.files[path]
+	return ok, nil
+}
+
+func (m *memoryRepository) ListFiles(ctx context.Context) ([]string, error) {
+	var paths []string
+	for path := range m.files {
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func (m *memoryRepository) GetAllFilesWithContent(ctx context.Context) (map[string]*repository.RemoteFileInfo, error) {
+	files := make(map[string]*repository.RemoteFileInfo, len(m.files))
+	for path, file := range m.files {
+		copied := *file
+		files[path] = &copied
+	}
+	return files, nil
+}
+
+func (m *memoryRepository) GetFileHistory(ctx context.Context, path string, limit int) ([]repository.FileRevision, error) {
+	return nil, nil
+}
+
+func (m *memoryRepository) GetFileAt(ctx context.Context, path, ref string) (*repository.RemoteFileInfo, error) {
+	file, ok := m.files[path]
+	if !ok {
+		return nil, nil
+	}
+	copied := *file
+	return &copied, nil
+}
+
+func (m *memoryRepository) GetFilesAt(ctx context.Context, ref string, paths []string) (map[string]*repository.RemoteFileInfo, error) {
+	files := make(map[string]*repository.RemoteFileInfo, len(paths))
+	for _, path := range paths {
+		if file, ok := m.files[path]; ok {
+			copied := *file
+			files[path] = &copied
+		}
+	}
+	return files, nil
+}
+
+func (m *memoryRepository) GetAllFilesAt(ctx context.Context, ref string, have map[string]string) (map[string]*repository.RemoteFileInfo, error) {
+	return m.GetAllFilesWithContent(ctx)
+}
+
+func (m *memoryRepository) ResolveCommitAt(ctx context.Context, at time.Time) (string, error) {
+	return "head", nil
+}
+
+func (m *memoryRepository) GetHeadSHA(ctx context.Context) (string, error) {
+	return "head", nil
+}
+
+func (m *memoryRepository) CompareCommits(ctx context.Context, base, head string) ([]repository.FileChange, error) {
+	return nil, nil
+}
+
+func configFor(keyFile string) *config.Config {
+	cfg := &config.Config{}
+	cfg.Encryption.Enabled = true
+	cfg.Encryption.KeyFile = keyFile
+	return cfg
+}
+
+func testKey(t *testing.T, seed byte) *Key {
+	t.Helper()
+	master := make([]byte, KeySize)
+	for i := range master {
+		master[i] = seed
+	}
+	key, err := NewKey(master)
+	require.NoError(t, err)
+	return key
+}
+
+func TestKey_ContentEncryption(t *testing.T) {
+	key := testKey(t, 1)
+	plaintext := []byte("secret notes")
+
+	ciphertext := key.EncryptContent("notes/a.md", plaintext)
+	assert.True(t, IsEncrypted(ciphertext))
+	assert.NotContains(t, string(ciphertext), "secret")
+
+	// Deterministic, so unchanged files don't produce new commits
+	assert.Equal(t, ciphertext, key.EncryptContent("notes/a.md", plaintext))
+	assert.NotEqual(t, ciphertext, key.EncryptContent("notes/b.md", plaintext))
+
+	decrypted, err := key.DecryptContent("notes/a.md", ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	t.Run("Tampered", func(t *testing.T) {
+		tampered := append([]byte{}, ciphertext...)
+		tampered[len(tampered)-1] ^= 0xff
+		_, err := key.DecryptContent("notes/a.md", tampered)
+		var decryptErr *DecryptError
+		assert.True(t, errors.As(err, &decryptErr))
+	})
+
+	t.Run("MovedFile", func(t *testing.T) {
+		_, err := key.DecryptContent("notes/b.md", ciphertext)
+		assert.Error(t, err)
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		_, err := testKey(t, 2).DecryptContent("notes/a.md", ciphertext)
+		assert.Error(t, err)
+	})
+}
+
+func TestKey_NameEncryption(t *testing.T) {
+	key := testKey(t, 1)
+	path := filepath.Join("notes", "2024", "plan.md")
+
+	encrypted := key.EncryptName(path)
+	assert.NotContains(t, encrypted, "plan")
+	assert.Equal(t, 3, len(strings.Split(filepath.ToSlash(encrypted), "/")))
+	// Files in the same directory share the encrypted directory name
+	assert.True(t, strings.HasPrefix(key.EncryptName(filepath.Join("notes", "todo.md")), strings.Split(filepath.ToSlash(encrypted), "/")[0]+string(filepath.Separator)))
+
+	decrypted, err := key.DecryptName(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, path, decrypted)
+
+	_, err = key.DecryptName("plain.md")
+	assert.Error(t, err)
+}
+
+func TestMetadata_DeriveKey(t *testing.T) {
+	meta, key, err := NewMetadata(Secret{Passphrase: "correct horse"}, false)
+	require.NoError(t, err)
+	meta.Iterations = 1000 // Keep the test fast
+	key, err = meta.DeriveKey(Secret{Passphrase: "correct horse"})
+	require.NoError(t, err)
+	meta.KeyCheck = key.KeyCheck()
+
+	again, err := meta.DeriveKey(Secret{Passphrase: "correct horse"})
+	require.NoError(t, err)
+	assert.NoError(t, meta.Verify(again))
+
+	wrong, err := meta.DeriveKey(Secret{Passphrase: "wrong horse"})
+	require.NoError(t, err)
+	var keyErr *KeyError
+	assert.True(t, errors.As(meta.Verify(wrong), &keyErr))
+
+	keyFile := filepath.Join(t.TempDir(), "catapult.key")
+	require.NoError(t, GenerateKeyFile(keyFile))
+	fileMeta, fileKey, err := NewMetadata(Secret{KeyFile: keyFile}, false)
+	require.NoError(t, err)
+	assert.Equal(t, KDFKeyFile, fileMeta.KDF)
+	assert.NoError(t, fileMeta.Verify(fileKey))
+}
+
+func TestRepository_PlaintextView(t *testing.T) {
+	ctx := context.Background()
+	raw := newMemoryRepository()
+	repo := NewRepository(raw, testKey(t, 1), true)
+
+	path := filepath.Join("notes", "a.md")
+	require.NoError(t, repo.CreateFile(ctx, path, "secret notes"))
+	require.NoError(t, repo.PutFile(ctx, "run.sh", "#!/bin/sh\n", storage.GitModeExecutable))
+
+	// Only ciphertext and encrypted names reach the repository
+	for rawPath, file := range raw.files {
+		assert.NotContains(t, rawPath, "notes")
+		assert.True(t, IsEncrypted([]byte(file.Content)))
+	}
+
+	content, err := repo.GetFile(ctx, path)
+	require.NoError(t, err)
+	assert.Equal(t, "secret notes", content)
+
+	exists, err := repo.FileExists(ctx, path)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	files, err := repo.GetAllFilesWithContent(ctx)
+	require.NoError(t, err)
+	require.Contains(t, files, path)
+	assert.Equal(t, "secret notes", files[path].Content)
+	assert.Equal(t, gitBlobSHA([]byte("secret notes")), files[path].SHA)
+	assert.Equal(t, len("secret notes"), files[path].Size)
+	assert.Equal(t, storage.GitModeExecutable, files["run.sh"].Mode)
+
+	// Rewriting unchanged content stores identical bytes
+	before := len(raw.files)
+	rawCopy := make(map[string]string)
+	for rawPath, file := range raw.files {
+		rawCopy[rawPath] = file.Content
+	}
+	require.NoError(t, repo.UpdateFile(ctx, path, "secret notes"))
+	assert.Len(t, raw.files, before)
+	for rawPath, file := range raw.files {
+		assert.Equal(t, rawCopy[rawPath], file.Content)
+	}
+
+	require.NoError(t, repo.DeleteFile(ctx, path))
+	list, err := repo.ListFiles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"run.sh"}, list)
+}
+
+func TestRepository_RejectsPlaintextFiles(t *testing.T) {
+	ctx := context.Background()
+	raw := newMemoryRepository()
+	require.NoError(t, raw.CreateFile(ctx, "README.md", "plaintext"))
+
+	_, err := NewRepository(raw, testKey(t, 1), false).GetAllFilesWithContent(ctx)
+	var decryptErr *DecryptError
+	assert.True(t, errors.As(err, &decryptErr))
+}
+
+func TestInitAndRotate(t *testing.T) {
+	ctx := context.Background()
+	raw := newMemoryRepository()
+	require.NoError(t, raw.CreateFile(ctx, "README.md", "plaintext readme"))
+	require.NoError(t, raw.PutFile(ctx, "run.sh", "#!/bin/sh\n", storage.GitModeExecutable))
+
+	dir := t.TempDir()
+	oldKeyFile := filepath.Join(dir, "old.key")
+	newKeyFile := filepath.Join(dir, "new.key")
+	require.NoError(t, GenerateKeyFile(oldKeyFile))
+	require.NoError(t, GenerateKeyFile(newKeyFile))
+
+	meta, err := Init(ctx, raw, Secret{KeyFile: oldKeyFile}, true, io.Discard)
+	require.NoError(t, err)
+	assert.True(t, meta.EncryptNames)
+	assert.NotContains(t, raw.files, "README.md")
+
+	// Re-running init with the same key is a no-op
+	_, err = Init(ctx, raw, Secret{KeyFile: oldKeyFile}, true, io.Discard)
+	require.NoError(t, err)
+	_, err = Init(ctx, raw, Secret{KeyFile: newKeyFile}, true, io.Discard)
+	assert.Error(t, err)
+
+	_, err = Rotate(ctx, raw, Secret{KeyFile: oldKeyFile}, Secret{KeyFile: newKeyFile}, false, io.Discard)
+	require.NoError(t, err)
+	assert.NotContains(t, raw.files, PendingMetadataPath)
+
+	repo, err := Open(ctx, raw, &configFor(newKeyFile).Encryption)
+	require.NoError(t, err)
+	files, err := repo.GetAllFilesWithContent(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "plaintext readme", files["README.md"].Content)
+	assert.Equal(t, storage.GitModeExecutable, files["run.sh"].Mode)
+
+	_, err = Open(ctx, raw, &configFor(oldKeyFile).Encryption)
+	var keyErr *KeyError
+	assert.True(t, errors.As(err, &keyErr))
+}
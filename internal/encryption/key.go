@@ -0,0 +1,292 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/repository"
+)
+
+// MetadataPath is the repository path of the (unencrypted) encryption metadata.
+// It holds the KDF parameters and a key check value, never the key itself.
+const MetadataPath = ".catapult/encryption.json"
+
+// Key derivation methods
+const (
+	KDFPassphrase = "pbkdf2-sha256"
+	KDFKeyFile    = "keyfile"
+)
+
+// DefaultIterations is the PBKDF2 iteration count for new passphrase keys
+const DefaultIterations = 600000
+
+// KeySize is the size of the master key and key files in bytes
+const KeySize = 32
+
+// Metadata describes how the encryption key is derived and verified
+type Metadata struct {
+	Version      int    `json:"version"`
+	KDF          string `json:"kdf"`
+	Salt         string `json:"salt,omitempty"`
+	Iterations   int    `json:"iterations,omitempty"`
+	KeyCheck     string `json:"key_check"`
+	EncryptNames bool   `json:"encrypt_names"`
+}
+
+// KeyError represents a missing or wrong encryption key
+type KeyError struct {
+	Message string
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("encryption key error: %s", e.Message)
+}
+
+// Key holds the subkeys derived from the master key
+type Key struct {
+	content cipher.AEAD
+	nonce   []byte
+	names   cipher.AEAD
+	check   string
+}
+
+// NewKey derives content, nonce and name keys from a master key
+func NewKey(master []byte) (*Key, error) {
+	if len(master) != KeySize {
+		return nil, &KeyError{Message: fmt.Sprintf("key must be %d bytes, got %d", KeySize, len(master))}
+	}
+
+	content, err := newAEAD(deriveSubkey(master, "catapult content encryption"))
+	if err != nil {
+		return nil, err
+	}
+	names, err := newAEAD(deriveSubkey(master, "catapult name encryption"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		content: content,
+		nonce:   deriveSubkey(master, "catapult content nonce"),
+		names:   names,
+		check:   hex.EncodeToString(deriveSubkey(master, "catapult key check")),
+	}, nil
+}
+
+// KeyCheck returns a value that identifies the key without revealing it
+func (k *Key) KeyCheck() string {
+	return k.check
+}
+
+// deriveSubkey derives a purpose-specific key from the master key
+func deriveSubkey(master []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// newAEAD creates an AES-256-GCM cipher
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Secret is the user-supplied secret a key is derived from
+type Secret struct {
+	Passphrase string
+	KeyFile    string
+}
+
+// SecretFromConfig reads the passphrase (from the configured environment
+// variable) or key file location from configuration
+func SecretFromConfig(cfg *config.EncryptionConfig) Secret {
+	secret := Secret{KeyFile: cfg.KeyFile}
+	if cfg.PassphraseEnv != "" {
+		secret.Passphrase = os.Getenv(cfg.PassphraseEnv)
+	}
+	return secret
+}
+
+// NewMetadata creates metadata and the matching key for a new secret
+func NewMetadata(secret Secret, encryptNames bool) (*Metadata, *Key, error) {
+	meta := &Metadata{Version: 1, EncryptNames: encryptNames}
+
+	if secret.KeyFile != "" {
+		meta.KDF = KDFKeyFile
+	} else if secret.Passphrase != "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+		meta.KDF = KDFPassphrase
+		meta.Salt = base64.StdEncoding.EncodeToString(salt)
+		meta.Iterations = DefaultIterations
+	} else {
+		return nil, nil, &KeyError{Message: "no passphrase or key file provided"}
+	}
+
+	key, err := meta.DeriveKey(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta.KeyCheck = key.KeyCheck()
+
+	return meta, key, nil
+}
+
+// DeriveKey derives the key described by the metadata from a secret
+func (m *Metadata) DeriveKey(secret Secret) (*Key, error) {
+	switch m.KDF {
+	case KDFKeyFile:
+		if secret.KeyFile == "" {
+			return nil, &KeyError{Message: "repository is encrypted with a key file but no encryption.key_file is configured"}
+		}
+		master, err := ReadKeyFile(secret.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewKey(master)
+
+	case KDFPassphrase:
+		if secret.Passphrase == "" {
+			return nil, &KeyError{Message: "repository is encrypted with a passphrase but none was provided"}
+		}
+		salt, err := base64.StdEncoding.DecodeString(m.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid salt in encryption metadata: %w", err)
+		}
+		return NewKey(pbkdf2.Key([]byte(secret.Passphrase), salt, m.Iterations, KeySize, sha256.New))
+
+	default:
+		return nil, fmt.Errorf("unsupported key derivation %q", m.KDF)
+	}
+}
+
+// Verify checks that key matches the key the metadata was created with
+func (m *Metadata) Verify(key *Key) error {
+	if !hmac.Equal([]byte(m.KeyCheck), []byte(key.KeyCheck())) {
+		return &KeyError{Message: "wrong passphrase or key file"}
+	}
+	return nil
+}
+
+// GenerateKeyFile writes a new random key to path with owner-only permissions
+func GenerateKeyFile(path string) error {
+	master := make([]byte, KeySize)
+	if _, err := rand.Read(master); err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	data := base64.StdEncoding.EncodeToString(master) + "\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	return nil
+}
+
+// ReadKeyFile reads a base64 encoded key file
+func ReadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	master, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, &KeyError{Message: fmt.Sprintf("key file %s is not valid base64", path)}
+	}
+	return master, nil
+}
+
+// LoadMetadata reads the encryption metadata from the repository.
+// It returns nil if the repository isn't encrypted.
+func LoadMetadata(ctx context.Context, repo repository.Repository) (*Metadata, error) {
+	exists, err := repo.FileExists(ctx, MetadataPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check encryption metadata: %w", err)
+	}
+	if !exists {
+		return nil, nil
+	}
+	return loadMetadataFrom(ctx, repo, MetadataPath)
+}
+
+// loadMetadataFrom reads and parses metadata stored at path
+func loadMetadataFrom(ctx context.Context, repo repository.Repository, path string) (*Metadata, error) {
+	content, err := repo.GetFile(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption metadata: %w", err)
+	}
+
+	meta := &Metadata{}
+	if err := json.Unmarshal([]byte(content), meta); err != nil {
+		return nil, fmt.Errorf("failed to parse encryption metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// SaveMetadata writes the encryption metadata to the repository
+func SaveMetadata(ctx context.Context, repo repository.Repository, meta *Metadata) error {
+	return saveMetadataTo(ctx, repo, MetadataPath, meta)
+}
+
+// saveMetadataTo creates or updates metadata stored at path
+func saveMetadataTo(ctx context.Context, repo repository.Repository, path string, meta *Metadata) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode encryption metadata: %w", err)
+	}
+
+	exists, err := repo.FileExists(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to check encryption metadata: %w", err)
+	}
+
+	if exists {
+		err = repo.UpdateFile(ctx, path, string(data)+"\n")
+	} else {
+		err = repo.CreateFile(ctx, path, string(data)+"\n")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save encryption metadata: %w", err)
+	}
+	return nil
+}
+
+// Open loads the repository's encryption metadata, derives the key from the
+// configured secret and returns the repository wrapped with encryption
+func Open(ctx context.Context, repo repository.Repository, cfg *config.EncryptionConfig) (repository.Repository, error) {
+	meta, err := LoadMetadata(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, &KeyError{Message: "encryption is enabled but the repository isn't encrypted, run 'catapult encryption init'"}
+	}
+
+	key, err := meta.DeriveKey(SecretFromConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+	if err := meta.Verify(key); err != nil {
+		return nil, err
+	}
+
+	return NewRepository(repo, key, meta.EncryptNames), nil
+}
@@ -0,0 +1,209 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/itcaat/catapult/internal/repository"
+	"github.com/itcaat/catapult/internal/storage"
+)
+
+// PendingMetadataPath holds the metadata of the new key while a key rotation
+// is in progress, so an interrupted rotation can be resumed
+const PendingMetadataPath = ".catapult/encryption.next.json"
+
+var _ repository.Repository = (*Repository)(nil)
+
+// Init enables encryption on a repository and encrypts all plaintext files in
+// place. It can be re-run with the same secret to finish an interrupted run.
+func Init(ctx context.Context, raw repository.Repository, secret Secret, encryptNames bool, out io.Writer) (*Metadata, error) {
+	meta, err := LoadMetadata(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var key *Key
+	if meta != nil {
+		// Resume with the existing key
+		if key, err = meta.DeriveKey(secret); err != nil {
+			return nil, err
+		}
+		if err := meta.Verify(key); err != nil {
+			return nil, fmt.Errorf("repository is already encrypted with another key (use 'catapult encryption rotate-key'): %w", err)
+		}
+		encryptNames = meta.EncryptNames
+	} else {
+		if meta, key, err = NewMetadata(secret, encryptNames); err != nil {
+			return nil, err
+		}
+		// Save the metadata first so every device refuses plaintext from now on
+		if err := SaveMetadata(ctx, raw, meta); err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := raw.GetAllFilesWithContent(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote files: %w", err)
+	}
+
+	target := NewRepository(raw, key, encryptNames)
+	count := 0
+	for _, remotePath := range sortedPaths(files) {
+		if isMetadata(remotePath) {
+			continue
+		}
+		file := files[remotePath]
+
+		if IsEncrypted([]byte(file.Content)) {
+			if _, _, err := target.decrypt(remotePath, []byte(file.Content)); err != nil {
+				return nil, fmt.Errorf("file is encrypted with another key: %w", err)
+			}
+			continue
+		}
+
+		if err := rewrite(ctx, raw, target, remotePath, remotePath, file); err != nil {
+			return nil, err
+		}
+		count++
+		fmt.Fprintf(out, "Encrypted %s\n", remotePath)
+	}
+
+	fmt.Fprintf(out, "Encrypted %d files\n", count)
+	return meta, nil
+}
+
+// Rotate re-encrypts all files with a key derived from newSecret. The current
+// key is used to decrypt files that haven't been rotated yet.
+func Rotate(ctx context.Context, raw repository.Repository, oldSecret, newSecret Secret, encryptNames bool, out io.Writer) (*Metadata, error) {
+	oldMeta, err := LoadMetadata(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	if oldMeta == nil {
+		return nil, &KeyError{Message: "repository isn't encrypted, run 'catapult encryption init' first"}
+	}
+	oldKey, err := oldMeta.DeriveKey(oldSecret)
+	if err != nil {
+		return nil, err
+	}
+	if err := oldMeta.Verify(oldKey); err != nil {
+		return nil, err
+	}
+
+	newMeta, newKey, err := pendingMetadata(ctx, raw, newSecret, encryptNames)
+	if err != nil {
+		return nil, err
+	}
+
+	source := NewRepository(raw, oldKey, oldMeta.EncryptNames)
+	target := NewRepository(raw, newKey, newMeta.EncryptNames)
+
+	files, err := raw.GetAllFilesWithContent(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote files: %w", err)
+	}
+
+	count := 0
+	for _, remotePath := range sortedPaths(files) {
+		if isMetadata(remotePath) {
+			continue
+		}
+		file := files[remotePath]
+
+		// Files rotated by an interrupted run already use the new key
+		if _, _, err := target.decrypt(remotePath, []byte(file.Content)); err == nil {
+			continue
+		}
+
+		path, plaintext, err := source.decrypt(remotePath, []byte(file.Content))
+		if err != nil {
+			return nil, err
+		}
+
+		plain := *file
+		plain.Content = string(plaintext)
+		if err := rewrite(ctx, raw, target, remotePath, path, &plain); err != nil {
+			return nil, err
+		}
+		count++
+		fmt.Fprintf(out, "Re-encrypted %s\n", path)
+	}
+
+	if err := SaveMetadata(ctx, raw, newMeta); err != nil {
+		return nil, err
+	}
+	if err := raw.DeleteFile(ctx, PendingMetadataPath); err != nil {
+		return nil, fmt.Errorf("failed to remove pending encryption metadata: %w", err)
+	}
+
+	fmt.Fprintf(out, "Re-encrypted %d files\n", count)
+	return newMeta, nil
+}
+
+// pendingMetadata returns the metadata of an interrupted rotation to the same
+// secret, or creates and stores new metadata
+func pendingMetadata(ctx context.Context, raw repository.Repository, secret Secret, encryptNames bool) (*Metadata, *Key, error) {
+	exists, err := raw.FileExists(ctx, PendingMetadataPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check pending encryption metadata: %w", err)
+	}
+
+	if exists {
+		pending, err := loadMetadataFrom(ctx, raw, PendingMetadataPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := pending.DeriveKey(secret)
+		if err == nil && pending.Verify(key) == nil {
+			return pending, key, nil
+		}
+		var keyErr *KeyError
+		if err != nil && !errors.As(err, &keyErr) {
+			return nil, nil, err
+		}
+		return nil, nil, &KeyError{Message: "an interrupted rotation to a different key is pending, re-run it with the same new passphrase or key file"}
+	}
+
+	meta, key, err := NewMetadata(secret, encryptNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := saveMetadataTo(ctx, raw, PendingMetadataPath, meta); err != nil {
+		return nil, nil, err
+	}
+	return meta, key, nil
+}
+
+// rewrite stores the plaintext file through target and removes the old copy
+// if it was stored under a different path
+func rewrite(ctx context.Context, raw repository.Repository, target *Repository, oldRemotePath, path string, file *repository.RemoteFileInfo) error {
+	mode := file.Mode
+	if mode == "" {
+		mode = storage.GitModeRegular
+	}
+
+	if err := target.PutFile(ctx, path, file.Content, mode); err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", path, err)
+	}
+
+	if target.remotePath(path) != oldRemotePath {
+		if err := raw.DeleteFile(ctx, oldRemotePath); err != nil {
+			return fmt.Errorf("failed to remove old copy of %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// sortedPaths returns the paths of files in a stable order
+func sortedPaths(files map[string]*repository.RemoteFileInfo) []string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,297 @@
+package encryption
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/itcaat/catapult/internal/repository"
+)
+
+// Repository wraps a repository and transparently encrypts everything written
+// to it and decrypts everything read from it. Callers only ever see plaintext
+// paths, contents and blob SHAs, so the sync and status logic work unchanged.
+type Repository struct {
+	inner        repository.Repository
+	key          *Key
+	encryptNames bool
+}
+
+// NewRepository creates a new encrypting repository
+func NewRepository(inner repository.Repository, key *Key, encryptNames bool) *Repository {
+	return &Repository{
+		inner:        inner,
+		key:          key,
+		encryptNames: encryptNames,
+	}
+}
+
+// isMetadata reports whether path is the unencrypted encryption metadata
+func isMetadata(path string) bool {
+	return filepath.ToSlash(path) == MetadataPath || filepath.ToSlash(path) == PendingMetadataPath
+}
+
+// remotePath returns the path a plaintext path is stored under
+func (r *Repository) remotePath(path string) string {
+	if !r.encryptNames || isMetadata(path) {
+		return path
+	}
+	return r.key.EncryptName(path)
+}
+
+// decrypt returns the plaintext path and content of a stored file
+func (r *Repository) decrypt(remotePath string, content []byte) (string, []byte, error) {
+	path := remotePath
+	if r.encryptNames {
+		var err error
+		if path, err = r.key.DecryptName(remotePath); err != nil {
+			return "", nil, err
+		}
+	}
+
+	plaintext, err := r.key.DecryptContent(path, content)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, plaintext, nil
+}
+
+// encrypt returns the stored form of plaintext content
+func (r *Repository) encrypt(path, content string) string {
+	if isMetadata(path) {
+		return content
+	}
+	return string(r.key.EncryptContent(path, []byte(content)))
+}
+
+// EnsureExists checks if the repository exists and creates it if it doesn't
+func (r *Repository) EnsureExists(ctx context.Context) error {
+	return r.inner.EnsureExists(ctx)
+}
+
+// GetDefaultBranch returns the default branch of the repository
+func (r *Repository) GetDefaultBranch(ctx context.Context) (string, error) {
+	return r.inner.GetDefaultBranch(ctx)
+}
+
+// CreateFile encrypts and creates a new file in the repository
+func (r *Repository) CreateFile(ctx context.Context, path, content string) error {
+	return r.inner.CreateFile(ctx, r.remotePath(path), r.encrypt(path, content))
+}
+
+// GetFile gets and decrypts the content of a file from the repository
+func (r *Repository) GetFile(ctx context.Context, path string) (string, error) {
+	content, err := r.inner.GetFile(ctx, r.remotePath(path))
+	if err != nil || isMetadata(path) {
+		return content, err
+	}
+
+	plaintext, err := r.key.DecryptContent(path, []byte(content))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// UpdateFile encrypts and updates an existing file in the repository
+func (r *Repository) UpdateFile(ctx context.Context, path, content string) error {
+	return r.inner.UpdateFile(ctx, r.remotePath(path), r.encrypt(path, content))
+}
+
+// PutFile encrypts and writes a file with an explicit git file mode
+func (r *Repository) PutFile(ctx context.Context, path, content, mode string) error {
+	return r.inner.PutFile(ctx, r.remotePath(path), r.encrypt(path, content), mode)
+}
+
+// MoveFile re-encrypts a file for its new path and moves it in one commit
+func (r *Repository) MoveFile(ctx context.Context, oldPath, newPath, content, mode string) error {
+	return r.inner.MoveFile(ctx, r.remotePath(oldPath), r.remotePath(newPath), r.encrypt(newPath, content), mode)
+}
+
+// DeleteFile deletes a file from the repository
+func (r *Repository) DeleteFile(ctx context.Context, path string) error {
+	return r.inner.DeleteFile(ctx, r.remotePath(path))
+}
+
+// FileExists checks if a file exists in the repository
+func (r *Repository) FileExists(ctx context.Context, path string) (bool, error) {
+	return r.inner.FileExists(ctx, r.remotePath(path))
+}
+
+// ListFiles lists the plaintext paths of all files in the repository
+func (r *Repository) ListFiles(ctx context.Context) ([]string, error) {
+	remotePaths, err := r.inner.ListFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(remotePaths))
+	for _, remotePath := range remotePaths {
+		if isMetadata(remotePath) {
+			continue
+		}
+
+		path := remotePath
+		if r.encryptNames {
+			if path, err = r.key.DecryptName(remotePath); err != nil {
+				return nil, err
+			}
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// GetAllFilesWithContent gets and decrypts all files. Size and SHA describe
+// the plaintext, so they can be compared against local files directly.
+func (r *Repository) GetAllFilesWithContent(ctx context.Context) (map[string]*repository.RemoteFileInfo, error) {
+	remoteFiles, err := r.inner.GetAllFilesWithContent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.decryptFiles(remoteFiles)
+}
+
+// GetFileHistory lists the commits that touched a file, with plaintext sizes
+func (r *Repository) GetFileHistory(ctx context.Context, path string, limit int) ([]repository.FileRevision, error) {
+	revisions, err := r.inner.GetFileHistory(ctx, r.remotePath(path), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	overhead := len(magic) + r.key.content.NonceSize() + r.key.content.Overhead()
+	for i := range revisions {
+		if revisions[i].Size >= overhead {
+			revisions[i].Size -= overhead
+		}
+	}
+	return revisions, nil
+}
+
+// GetFileAt gets and decrypts a file as it was at a commit
+func (r *Repository) GetFileAt(ctx context.Context, path, ref string) (*repository.RemoteFileInfo, error) {
+	remoteFile, err := r.inner.GetFileAt(ctx, r.remotePath(path), ref)
+	if err != nil || remoteFile == nil {
+		return nil, err
+	}
+
+	plaintext, err := r.key.DecryptContent(path, []byte(remoteFile.Content))
+	if err != nil {
+		return nil, err
+	}
+	return plaintextFile(path, plaintext, remoteFile.Mode), nil
+}
+
+// GetFilesAt gets and decrypts the files at the given paths as they were at
+// a commit
+func (r *Repository) GetFilesAt(ctx context.Context, ref string, paths []string) (map[string]*repository.RemoteFileInfo, error) {
+	remotePaths := make([]string, 0, len(paths))
+	for _, path := range paths {
+		remotePaths = append(remotePaths, r.remotePath(path))
+	}
+
+	remoteFiles, err := r.inner.GetFilesAt(ctx, ref, remotePaths)
+	if err != nil {
+		return nil, err
+	}
+	return r.decryptFiles(remoteFiles)
+}
+
+// GetAllFilesAt gets and decrypts all files as they were at a commit. The
+// blobs in the repository hold ciphertext, which can't be compared with the
+// local SHAs in have, so every file is downloaded.
+func (r *Repository) GetAllFilesAt(ctx context.Context, ref string, have map[string]string) (map[string]*repository.RemoteFileInfo, error) {
+	remoteFiles, err := r.inner.GetAllFilesAt(ctx, ref, nil)
+	if err != nil {
+		return nil, err
+	}
+	return r.decryptFiles(remoteFiles)
+}
+
+// ResolveCommitAt returns the last commit made at or before a point in time
+func (r *Repository) ResolveCommitAt(ctx context.Context, at time.Time) (string, error) {
+	return r.inner.ResolveCommitAt(ctx, at)
+}
+
+// GetHeadSHA returns the SHA of the latest commit on the branch
+func (r *Repository) GetHeadSHA(ctx context.Context) (string, error) {
+	return r.inner.GetHeadSHA(ctx)
+}
+
+// TakeCommits returns the commits made through the wrapped repository since
+// they were last taken
+func (r *Repository) TakeCommits() []repository.Commit {
+	commits, _ := repository.TakeCommits(r.inner)
+	return commits
+}
+
+// RateLimit returns the API rate limit of the wrapped repository
+func (r *Repository) RateLimit() (repository.RateLimit, bool) {
+	return repository.RateLimitOf(r.inner)
+}
+
+// CompareCommits lists the plaintext paths of the files changed from base to
+// head, leaving out the encryption metadata
+func (r *Repository) CompareCommits(ctx context.Context, base, head string) ([]repository.FileChange, error) {
+	changes, err := r.inner.CompareCommits(ctx, base, head)
+	if err != nil {
+		return nil, err
+	}
+
+	plain := make([]repository.FileChange, 0, len(changes))
+	for _, change := range changes {
+		if isMetadata(change.Path) {
+			continue
+		}
+		if r.encryptNames {
+			if change.Path, err = r.key.DecryptName(change.Path); err != nil {
+				return nil, err
+			}
+			if change.PreviousPath != "" && !isMetadata(change.PreviousPath) {
+				if change.PreviousPath, err = r.key.DecryptName(change.PreviousPath); err != nil {
+					return nil, err
+				}
+			}
+		}
+		plain = append(plain, change)
+	}
+	return plain, nil
+}
+
+// decryptFiles decrypts the paths and contents of stored files
+func (r *Repository) decryptFiles(remoteFiles map[string]*repository.RemoteFileInfo) (map[string]*repository.RemoteFileInfo, error) {
+	files := make(map[string]*repository.RemoteFileInfo, len(remoteFiles))
+	for remotePath, remoteFile := range remoteFiles {
+		if isMetadata(remotePath) {
+			continue
+		}
+
+		path, plaintext, err := r.decrypt(remotePath, []byte(remoteFile.Content))
+		if err != nil {
+			return nil, fmt.Errorf("%w; run 'catapult encryption init' to encrypt files added without catapult", err)
+		}
+		files[path] = plaintextFile(path, plaintext, remoteFile.Mode)
+	}
+	return files, nil
+}
+
+// plaintextFile describes a decrypted file
+func plaintextFile(path string, plaintext []byte, mode string) *repository.RemoteFileInfo {
+	return &repository.RemoteFileInfo{
+		Path:    path,
+		Content: string(plaintext),
+		SHA:     gitBlobSHA(plaintext),
+		Size:    len(plaintext),
+		Mode:    mode,
+	}
+}
+
+// gitBlobSHA calculates the git blob SHA-1 of content
+func gitBlobSHA(content []byte) string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "blob %d\x00", len(content))
+	hash.Write(content)
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
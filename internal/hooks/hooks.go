@@ -0,0 +1,165 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/itcaat/catapult/internal/config"
+)
+
+// Event identifies the point in the sync cycle at which a hook runs
+type Event string
+
+const (
+	// EventPreSync runs before a sync starts; a failure aborts the sync
+	EventPreSync Event = "pre-sync"
+	// EventPostSync runs after a sync has finished
+	EventPostSync Event = "post-sync"
+	// EventPostDownload runs after files were downloaded from the repository
+	EventPostDownload Event = "post-download"
+	// EventOnConflict runs for every file with both local and remote changes
+	EventOnConflict Event = "on-conflict"
+)
+
+// File describes a file affected by a sync, as passed to hooks
+type File struct {
+	Path      string `json:"path"`
+	Action    string `json:"action,omitempty"` // upload, download, delete, conflict, unchanged
+	LocalSHA  string `json:"local_sha,omitempty"`
+	RemoteSHA string `json:"remote_sha,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Payload is the JSON document written to a hook's stdin
+type Payload struct {
+	Event     Event     `json:"event"`
+	BaseDir   string    `json:"base_dir"`
+	Timestamp time.Time `json:"timestamp"`
+	Files     []File    `json:"files"`
+}
+
+// HookError represents a hook that failed, timed out or could not be started
+type HookError struct {
+	Event   Event
+	Command string
+	Output  string
+	Err     error
+}
+
+func (e *HookError) Error() string {
+	msg := fmt.Sprintf("%s hook '%s' failed: %v", e.Event, e.Command, e.Err)
+	if e.Output != "" {
+		msg += fmt.Sprintf(" (output: %s)", e.Output)
+	}
+	return msg
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// Runner executes configured hook executables
+type Runner struct {
+	commands map[Event]string
+	timeout  time.Duration
+	baseDir  string
+	logger   *log.Logger
+}
+
+// NewRunner creates a new hook runner from configuration
+func NewRunner(cfg *config.HookConfig, baseDir string, logger *log.Logger) *Runner {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	return &Runner{
+		commands: map[Event]string{
+			EventPreSync:      cfg.PreSync,
+			EventPostSync:     cfg.PostSync,
+			EventPostDownload: cfg.PostDownload,
+			EventOnConflict:   cfg.OnConflict,
+		},
+		timeout: timeout,
+		baseDir: baseDir,
+		logger:  logger,
+	}
+}
+
+// Enabled reports whether a hook is configured for the event
+func (r *Runner) Enabled(event Event) bool {
+	return r.commands[event] != ""
+}
+
+// Run executes the hook for the event, passing the payload on stdin.
+// It returns nil if no hook is configured for the event.
+func (r *Runner) Run(ctx context.Context, event Event, files []File) error {
+	command := r.commands[event]
+	if command == "" {
+		return nil
+	}
+
+	if files == nil {
+		files = []File{}
+	}
+
+	payload, err := json.Marshal(&Payload{
+		Event:     event,
+		BaseDir:   r.baseDir,
+		Timestamp: time.Now(),
+		Files:     files,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode hook payload: %w", err)
+	}
+
+	hookCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(hookCtx, command)
+	cmd.Dir = r.baseDir
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		"CATAPULT_HOOK_EVENT="+string(event),
+		"CATAPULT_BASE_DIR="+r.baseDir,
+	)
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Don't wait for grandchildren holding the output pipe after a timeout
+	cmd.WaitDelay = time.Second
+
+	if r.logger != nil {
+		r.logger.Printf("Running %s hook: %s (%d files)", event, command, len(files))
+	}
+
+	runErr := cmd.Run()
+	out := strings.TrimSpace(output.String())
+
+	if errors.Is(hookCtx.Err(), context.DeadlineExceeded) {
+		return &HookError{
+			Event:   event,
+			Command: command,
+			Output:  out,
+			Err:     fmt.Errorf("timed out after %s", r.timeout),
+		}
+	}
+	if runErr != nil {
+		return &HookError{Event: event, Command: command, Output: out, Err: runErr}
+	}
+
+	if r.logger != nil && out != "" {
+		r.logger.Printf("%s hook output: %s", event, out)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeScript creates an executable shell script for use as a hook
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script hooks are not supported on Windows")
+	}
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755))
+	return path
+}
+
+func TestRunner_PassesPayloadOnStdin(t *testing.T) {
+	tempDir := t.TempDir()
+	payloadPath := filepath.Join(tempDir, "payload.json")
+	script := writeScript(t, tempDir, "post-sync.sh", "cat > "+payloadPath)
+
+	runner := NewRunner(&config.HookConfig{PostSync: script}, tempDir, nil)
+
+	files := []File{{Path: "notes/a.md", Action: "upload", LocalSHA: "abc"}}
+	err := runner.Run(context.Background(), EventPostSync, files)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(payloadPath)
+	require.NoError(t, err)
+
+	var payload Payload
+	require.NoError(t, json.Unmarshal(data, &payload))
+	assert.Equal(t, EventPostSync, payload.Event)
+	assert.Equal(t, tempDir, payload.BaseDir)
+	assert.Equal(t, files, payload.Files)
+}
+
+func TestRunner_NoHookConfigured(t *testing.T) {
+	runner := NewRunner(&config.HookConfig{}, t.TempDir(), nil)
+
+	assert.False(t, runner.Enabled(EventPreSync))
+	assert.NoError(t, runner.Run(context.Background(), EventPreSync, nil))
+}
+
+func TestRunner_FailingHook(t *testing.T) {
+	tempDir := t.TempDir()
+	script := writeScript(t, tempDir, "pre-sync.sh", "echo 'index failed' >&2; exit 3")
+
+	runner := NewRunner(&config.HookConfig{PreSync: script}, tempDir, nil)
+
+	err := runner.Run(context.Background(), EventPreSync, nil)
+	require.Error(t, err)
+
+	var hookErr *HookError
+	require.True(t, errors.As(err, &hookErr))
+	assert.Equal(t, EventPreSync, hookErr.Event)
+	assert.Contains(t, hookErr.Output, "index failed")
+}
+
+func TestRunner_Timeout(t *testing.T) {
+	tempDir := t.TempDir()
+	script := writeScript(t, tempDir, "slow.sh", "sleep 5")
+
+	runner := NewRunner(&config.HookConfig{OnConflict: script, Timeout: 100 * time.Millisecond}, tempDir, nil)
+
+	start := time.Now()
+	err := runner.Run(context.Background(), EventOnConflict, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
@@ -0,0 +1,201 @@
+package lock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileName is the name of the lock file in the state directory
+const FileName = "catapult.lock"
+
+// tornLockAge is how old an unreadable lock file must be before it is taken
+// over. Younger ones may still be being written by their owner.
+const tornLockAge = 10 * time.Second
+
+// Owner describes the process holding the lock
+type Owner struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Command string    `json:"command"`
+	Daemon  bool      `json:"daemon"`
+	Started time.Time `json:"started"`
+}
+
+// HeldError reports a lock held by another process
+type HeldError struct {
+	Owner Owner
+}
+
+func (e *HeldError) Error() string {
+	host, _ := os.Hostname()
+	if e.Owner.Host != "" && e.Owner.Host != host {
+		return fmt.Sprintf("another catapult process (pid %d on %s) is syncing", e.Owner.PID, e.Owner.Host)
+	}
+	return fmt.Sprintf("another catapult process (pid %d) is syncing", e.Owner.PID)
+}
+
+// Lock is a held lock on the catapult state directory
+type Lock struct {
+	path  string
+	owner Owner
+}
+
+// NewOwner describes the current process running command
+func NewOwner(command string, daemon bool) Owner {
+	host, _ := os.Hostname()
+	return Owner{
+		PID:     os.Getpid(),
+		Host:    host,
+		Command: command,
+		Daemon:  daemon,
+		Started: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// Acquire takes the lock on dir for owner. It fails with a HeldError if a
+// live process holds it; locks left behind by dead processes are taken over.
+func Acquire(dir string, owner Owner) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	path := filepath.Join(dir, FileName)
+
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode lock: %w", err)
+	}
+
+	for {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, writeErr := file.Write(data)
+			if syncErr := file.Sync(); writeErr == nil {
+				writeErr = syncErr
+			}
+			file.Close()
+			if writeErr != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock file: %w", writeErr)
+			}
+			return &Lock{path: path, owner: owner}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		holder, stale, err := inspect(path)
+		if os.IsNotExist(err) {
+			// Released in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !stale {
+			return nil, &HeldError{Owner: *holder}
+		}
+
+		if err := takeOver(path, holder); err != nil {
+			return nil, fmt.Errorf("failed to remove stale lock file: %w", err)
+		}
+	}
+}
+
+// takeOver removes the stale lock file of holder. Other processes may find
+// the same stale lock and one of them may already have replaced it, so the
+// file is first renamed to a name of its own: only what this process moved
+// away is removed, and only if it still is the stale lock, otherwise it is
+// put back.
+func takeOver(path string, holder *Owner) error {
+	movedPath := fmt.Sprintf("%s.%d-%d.stale", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(path, movedPath); err != nil {
+		if os.IsNotExist(err) {
+			// Taken over by another process
+			return nil
+		}
+		return err
+	}
+
+	moved, stale, err := inspect(movedPath)
+	if err == nil && stale && sameOwner(moved, holder) {
+		return os.Remove(movedPath)
+	}
+
+	// A lock taken in the meantime: restore it unless yet another process
+	// holds the lock by now
+	if err := os.Link(movedPath, path); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return os.Remove(movedPath)
+}
+
+// sameOwner reports whether two lock files were written by the same process
+func sameOwner(a, b *Owner) bool {
+	return a.PID == b.PID && a.Host == b.Host && a.Started.Equal(b.Started)
+}
+
+// Holder returns the owner of the lock on dir, or nil if it isn't held
+func Holder(dir string) (*Owner, error) {
+	holder, stale, err := inspect(filepath.Join(dir, FileName))
+	if os.IsNotExist(err) || stale {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return holder, nil
+}
+
+// Owner returns who holds the lock
+func (l *Lock) Owner() Owner {
+	return l.owner
+}
+
+// Release gives up the lock. A lock that was taken over in the meantime is
+// left alone.
+func (l *Lock) Release() error {
+	holder, _, err := inspect(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !sameOwner(holder, &l.owner) {
+		return nil
+	}
+
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove lock file: %w", err)
+	}
+	return nil
+}
+
+// inspect reads a lock file and decides whether it was left behind by a
+// process that no longer runs. Liveness can only be checked on this host,
+// so locks of other hosts are never stale.
+func inspect(path string) (*Owner, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var owner Owner
+	if err := json.Unmarshal(data, &owner); err != nil || owner.PID <= 0 {
+		// The owner died while writing it, or is still writing it
+		return &Owner{}, time.Since(info.ModTime()) > tornLockAge, nil
+	}
+
+	host, _ := os.Hostname()
+	if owner.Host != host {
+		return &owner, false, nil
+	}
+	return &owner, !processAlive(owner.PID), nil
+}
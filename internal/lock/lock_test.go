@@ -0,0 +1,125 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeLockFile plants a lock file as another process would have left it
+func writeLockFile(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, FileName)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestAcquire(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := Acquire(dir, NewOwner("sync", true))
+	require.NoError(t, err)
+
+	// A second process is turned away with the holder's pid
+	_, err = Acquire(dir, Owner{PID: os.Getpid() + 1, Command: "sync"})
+	var held *HeldError
+	require.True(t, errors.As(err, &held))
+	assert.Equal(t, os.Getpid(), held.Owner.PID)
+	assert.True(t, held.Owner.Daemon)
+	assert.Contains(t, err.Error(), "another catapult process (pid")
+
+	holder, err := Holder(dir)
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	assert.Equal(t, "sync", holder.Command)
+
+	require.NoError(t, first.Release())
+	holder, err = Holder(dir)
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+
+	second, err := Acquire(dir, NewOwner("restore", false))
+	require.NoError(t, err)
+	assert.NoError(t, second.Release())
+}
+
+func TestAcquire_StaleLock(t *testing.T) {
+	host, _ := os.Hostname()
+
+	t.Run("DeadProcess", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLockFile(t, dir, `{"pid":2147483646,"host":"`+host+`","command":"sync"}`)
+
+		stateLock, err := Acquire(dir, NewOwner("sync", false))
+		require.NoError(t, err)
+		assert.NoError(t, stateLock.Release())
+	})
+
+	t.Run("TornLockFile", func(t *testing.T) {
+		dir := t.TempDir()
+		path := writeLockFile(t, dir, `{"pid":12`)
+
+		// Still being written by its owner
+		_, err := Acquire(dir, NewOwner("sync", false))
+		var held *HeldError
+		assert.True(t, errors.As(err, &held))
+
+		old := time.Now().Add(-2 * tornLockAge)
+		require.NoError(t, os.Chtimes(path, old, old))
+		stateLock, err := Acquire(dir, NewOwner("sync", false))
+		require.NoError(t, err)
+		assert.NoError(t, stateLock.Release())
+	})
+
+	t.Run("OtherHost", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLockFile(t, dir, `{"pid":2147483646,"host":"`+host+`-elsewhere","command":"sync"}`)
+
+		// Liveness can't be checked remotely, so the lock is respected
+		_, err := Acquire(dir, NewOwner("sync", false))
+		var held *HeldError
+		require.True(t, errors.As(err, &held))
+		assert.Contains(t, err.Error(), "on "+host+"-elsewhere")
+	})
+}
+
+func TestRelease_TakenOver(t *testing.T) {
+	dir := t.TempDir()
+
+	stateLock, err := Acquire(dir, NewOwner("sync", false))
+	require.NoError(t, err)
+
+	// Another process declared the lock stale and took it over
+	host, _ := os.Hostname()
+	path := writeLockFile(t, dir, `{"pid":1,"host":"`+host+`","command":"sync"}`)
+
+	require.NoError(t, stateLock.Release())
+	_, err = os.Stat(path)
+	assert.NoError(t, err, "a lock taken over by another process must not be removed")
+}
+
+func TestTakeOver_KeepsFreshLock(t *testing.T) {
+	dir := t.TempDir()
+	host, _ := os.Hostname()
+	stale := Owner{PID: 2147483646, Host: host, Command: "sync"}
+
+	// Another process took the stale lock over before this one got to it
+	fresh, err := Acquire(dir, NewOwner("restore", false))
+	require.NoError(t, err)
+
+	require.NoError(t, takeOver(filepath.Join(dir, FileName), &stale))
+
+	holder, err := Holder(dir)
+	require.NoError(t, err)
+	require.NotNil(t, holder, "a fresh lock must not be removed as stale")
+	assert.Equal(t, "restore", holder.Command)
+	assert.NoError(t, fresh.Release())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "no moved lock files may be left behind")
+}
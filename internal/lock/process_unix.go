@@ -0,0 +1,11 @@
+//go:build !windows
+
+package lock
+
+import "syscall"
+
+// processAlive reports whether a process with pid runs on this host
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
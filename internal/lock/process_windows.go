@@ -0,0 +1,16 @@
+//go:build windows
+
+package lock
+
+import "os"
+
+// processAlive reports whether a process with pid runs on this host.
+// On Windows, FindProcess fails for processes that don't exist.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
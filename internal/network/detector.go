@@ -37,6 +37,16 @@ func (d *Detector) IsConnected() bool {
 	return false
 }
 
+// Endpoints returns the endpoints probed for connectivity
+func (d *Detector) Endpoints() []string {
+	return append([]string(nil), d.endpoints...)
+}
+
+// CheckEndpoint tests connectivity to a specific endpoint
+func (d *Detector) CheckEndpoint(endpoint string) bool {
+	return d.checkEndpoint(endpoint)
+}
+
 // checkEndpoint tests connectivity to a specific endpoint
 func (d *Detector) checkEndpoint(endpoint string) bool {
 	client := &http.Client{
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Commit is a commit made through a repository, along with the commit it
+// was made on top of
+type Commit struct {
+	SHA    string
+	Parent string
+}
+
+// commitLog records the commits made through a repository until they are
+// taken
+type commitLog struct {
+	mu      sync.Mutex
+	commits []Commit
+}
+
+// record adds a commit returned by the API
+func (l *commitLog) record(commit *github.Commit) {
+	if commit == nil || commit.GetSHA() == "" {
+		return
+	}
+
+	made := Commit{SHA: commit.GetSHA()}
+	if len(commit.Parents) > 0 {
+		made.Parent = commit.Parents[0].GetSHA()
+	}
+
+	l.mu.Lock()
+	l.commits = append(l.commits, made)
+	l.mu.Unlock()
+}
+
+// take returns the recorded commits, oldest first, and forgets them
+func (l *commitLog) take() []Commit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	commits := l.commits
+	l.commits = nil
+	return commits
+}
+
+// TakeCommits returns the commits made through the repository since they
+// were last taken, oldest first
+func (r *GitHubRepository) TakeCommits() []Commit {
+	return r.commits.take()
+}
+
+// TakeCommits returns the commits made through repo since they were last
+// taken, if it keeps track of them
+func TakeCommits(repo Repository) ([]Commit, bool) {
+	tracked, ok := repo.(interface{ TakeCommits() []Commit })
+	if !ok {
+		return nil, false
+	}
+	return tracked.TakeCommits(), true
+}
@@ -0,0 +1,349 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/itcaat/catapult/internal/storage"
+)
+
+// DeviceTrailer is the commit message trailer naming the device that made a commit
+const DeviceTrailer = "Catapult-Device"
+
+// errTreeTruncated is returned for trees with more files than GitHub lists
+// at once
+var errTreeTruncated = errors.New("too large to read at once")
+
+// maxComparedFiles is the most files GitHub lists when comparing commits
+const maxComparedFiles = 300
+
+// FileChange describes a file changed between two commits
+type FileChange struct {
+	Path         string
+	PreviousPath string // Path before a rename
+	Status       string // added, modified, removed or renamed
+}
+
+// FileRevision describes a commit that touched a file
+type FileRevision struct {
+	CommitSHA string
+	Date      time.Time
+	Device    string
+	Message   string
+	Size      int
+	Deleted   bool // The commit removed the file
+}
+
+// commitMessage builds a commit message recording the device that made it
+func (r *GitHubRepository) commitMessage(action, path string) string {
+	return fmt.Sprintf("%s %s\n\n%s: %s", action, path, DeviceTrailer, r.device)
+}
+
+// parseDevice extracts the device trailer from a commit message
+func parseDevice(message string) string {
+	for _, line := range strings.Split(message, "\n") {
+		if value, ok := strings.CutPrefix(line, DeviceTrailer+":"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// fileHistoryQuery lists the commits that touched a file along with its size
+// at each of them, in one request rather than one per commit
+const fileHistoryQuery = `query($owner: String!, $name: String!, $branch: String!, $path: String!, $limit: Int!) {
+  repository(owner: $owner, name: $name) {
+    ref(qualifiedName: $branch) {
+      target {
+        ... on Commit {
+          history(first: $limit, path: $path) {
+            nodes {
+              oid
+              committedDate
+              message
+              author { name }
+              file(path: $path) { object { ... on Blob { byteSize } } }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// maxHistoryCommits is the most commits GitHub lists in one history query
+const maxHistoryCommits = 100
+
+// fileHistoryResponse is the result of fileHistoryQuery
+type fileHistoryResponse struct {
+	Data struct {
+		Repository struct {
+			Ref *struct {
+				Target struct {
+					History struct {
+						Nodes []struct {
+							OID           string    `json:"oid"`
+							CommittedDate time.Time `json:"committedDate"`
+							Message       string    `json:"message"`
+							Author        struct {
+								Name string `json:"name"`
+							} `json:"author"`
+							File *struct {
+								Object struct {
+									ByteSize int `json:"byteSize"`
+								} `json:"object"`
+							} `json:"file"`
+						} `json:"nodes"`
+					} `json:"history"`
+				} `json:"target"`
+			} `json:"ref"`
+		} `json:"repository"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// GetFileHistory lists the most recent commits that touched a file, newest
+// first. Sizes come from the commit trees, so no content is downloaded.
+func (r *GitHubRepository) GetFileHistory(ctx context.Context, path string, limit int) ([]FileRevision, error) {
+	if limit <= 0 || limit > maxHistoryCommits {
+		limit = maxHistoryCommits
+	}
+
+	req, err := r.client.NewRequest(http.MethodPost, "graphql", map[string]interface{}{
+		"query": fileHistoryQuery,
+		"variables": map[string]interface{}{
+			"owner":  r.owner,
+			"name":   r.name,
+			"branch": "refs/heads/main",
+			"path":   filepath.ToSlash(path),
+			"limit":  limit,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create history query: %w", err)
+	}
+
+	var response fileHistoryResponse
+	if _, err := r.client.Do(ctx, req, &response); err != nil {
+		return nil, fmt.Errorf("failed to list commits: %w", err)
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("failed to list commits: %s", response.Errors[0].Message)
+	}
+
+	ref := response.Data.Repository.Ref
+	if ref == nil {
+		// The branch has no commits yet
+		return nil, nil
+	}
+
+	nodes := ref.Target.History.Nodes
+	revisions := make([]FileRevision, 0, len(nodes))
+	for _, node := range nodes {
+		revision := FileRevision{
+			CommitSHA: node.OID,
+			Date:      node.CommittedDate,
+			Device:    parseDevice(node.Message),
+			Message:   strings.SplitN(node.Message, "\n", 2)[0],
+			Deleted:   node.File == nil,
+		}
+		if revision.Device == "" {
+			// Commits made outside catapult
+			revision.Device = node.Author.Name
+		}
+		if node.File != nil {
+			revision.Size = node.File.Object.ByteSize
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+// GetFileAt gets a file as it was at a commit. It returns nil if the file
+// didn't exist at that commit.
+func (r *GitHubRepository) GetFileAt(ctx context.Context, path, ref string) (*RemoteFileInfo, error) {
+	file, _, resp, err := r.client.Repositories.GetContents(ctx, r.owner, r.name, path, &github.RepositoryContentGetOptions{
+		Ref: ref,
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file at %s: %w", ref, err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("'%s' is a directory", path)
+	}
+
+	// Read the blob, which also covers large files and symlink targets
+	content, _, err := r.client.Git.GetBlobRaw(ctx, r.owner, r.name, file.GetSHA())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file content at %s: %w", ref, err)
+	}
+
+	modes, err := r.getFileModes(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file modes: %w", err)
+	}
+	mode, ok := modes[path]
+	if !ok {
+		mode = storage.GitModeRegular
+	}
+
+	return &RemoteFileInfo{
+		Path:    path,
+		Content: string(content),
+		SHA:     file.GetSHA(),
+		Size:    len(content),
+		Mode:    mode,
+	}, nil
+}
+
+// GetFilesAt gets the files at the given paths as they were at a commit.
+// The tree is read once and only the blobs of those files are downloaded;
+// paths that didn't exist at the commit are left out.
+func (r *GitHubRepository) GetFilesAt(ctx context.Context, ref string, paths []string) (map[string]*RemoteFileInfo, error) {
+	wanted := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		wanted[filepath.ToSlash(path)] = true
+	}
+	files, err := r.filesAt(ctx, ref, func(entry *github.TreeEntry) bool {
+		return wanted[entry.GetPath()]
+	}, nil)
+	if !errors.Is(err, errTreeTruncated) {
+		return files, err
+	}
+
+	// Too many files to list at once: get them one by one instead
+	files = make(map[string]*RemoteFileInfo, len(paths))
+	for _, path := range paths {
+		file, err := r.GetFileAt(ctx, path, ref)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil {
+			files[path] = file
+		}
+	}
+	return files, nil
+}
+
+// GetAllFilesAt gets all files as they were at a commit. have maps paths to
+// the git blob SHAs of local content: files whose SHA matches are returned
+// without content, and only the blobs that differ are downloaded.
+func (r *GitHubRepository) GetAllFilesAt(ctx context.Context, ref string, have map[string]string) (map[string]*RemoteFileInfo, error) {
+	return r.filesAt(ctx, ref, func(entry *github.TreeEntry) bool { return true }, have)
+}
+
+// filesAt gets the files of the tree at a commit that want accepts, with
+// their content unless their SHA matches the one in have
+func (r *GitHubRepository) filesAt(ctx context.Context, ref string, want func(entry *github.TreeEntry) bool, have map[string]string) (map[string]*RemoteFileInfo, error) {
+	tree, _, err := r.client.Git.GetTree(ctx, r.owner, r.name, ref, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree at %s: %w", ref, err)
+	}
+	if tree.GetTruncated() {
+		return nil, fmt.Errorf("repository tree at %s: %w", ref, errTreeTruncated)
+	}
+
+	files := make(map[string]*RemoteFileInfo)
+	for _, entry := range tree.Entries {
+		if entry.GetType() != "blob" || !want(entry) {
+			continue
+		}
+
+		path := filepath.FromSlash(entry.GetPath())
+		file := &RemoteFileInfo{
+			Path: path,
+			SHA:  entry.GetSHA(),
+			Size: entry.GetSize(),
+			Mode: entry.GetMode(),
+		}
+		files[path] = file
+
+		if sha, ok := have[path]; ok && sha == entry.GetSHA() {
+			// Same content as the local file
+			continue
+		}
+
+		content, _, err := r.client.Git.GetBlobRaw(ctx, r.owner, r.name, entry.GetSHA())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get content of %s at %s: %w", entry.GetPath(), ref, err)
+		}
+		file.Content = string(content)
+		file.Size = len(content)
+	}
+
+	return files, nil
+}
+
+// GetHeadSHA returns the SHA of the latest commit on the branch
+func (r *GitHubRepository) GetHeadSHA(ctx context.Context) (string, error) {
+	sha, _, err := r.client.Repositories.GetCommitSHA1(ctx, r.owner, r.name, "main", "")
+	if err != nil {
+		return "", fmt.Errorf("failed to get head commit: %w", err)
+	}
+	return sha, nil
+}
+
+// CompareCommits lists the files changed from base to head. It fails if
+// head doesn't descend from base, such as after a force push, or if there
+// are more changes than GitHub lists.
+func (r *GitHubRepository) CompareCommits(ctx context.Context, base, head string) ([]FileChange, error) {
+	comparison, _, err := r.client.Repositories.CompareCommits(ctx, r.owner, r.name, base, head, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare commits: %w", err)
+	}
+	if status := comparison.GetStatus(); status != "ahead" && status != "identical" {
+		return nil, fmt.Errorf("%s is %s of %s", ShortSHA(head), status, ShortSHA(base))
+	}
+	if len(comparison.Files) >= maxComparedFiles {
+		return nil, fmt.Errorf("too many changes between %s and %s", ShortSHA(base), ShortSHA(head))
+	}
+
+	changes := make([]FileChange, 0, len(comparison.Files))
+	for _, file := range comparison.Files {
+		change := FileChange{
+			Path:   filepath.FromSlash(file.GetFilename()),
+			Status: file.GetStatus(),
+		}
+		if previous := file.GetPreviousFilename(); previous != "" {
+			change.PreviousPath = filepath.FromSlash(previous)
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// ShortSHA abbreviates a commit SHA for display
+func ShortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// ResolveCommitAt returns the last commit made at or before a point in time
+func (r *GitHubRepository) ResolveCommitAt(ctx context.Context, at time.Time) (string, error) {
+	commits, _, err := r.client.Repositories.ListCommits(ctx, r.owner, r.name, &github.CommitsListOptions{
+		SHA:         "main",
+		Until:       at,
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list commits: %w", err)
+	}
+	if len(commits) == 0 {
+		return "", fmt.Errorf("no commits at or before %s", at.Format(time.RFC3339))
+	}
+	return commits[0].GetSHA(), nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// RateLimit is the state of the GitHub API rate limit as last reported
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// rateTracker records the core API rate limit GitHub reports with every
+// response
+type rateTracker struct {
+	next  http.RoundTripper
+	mu    sync.Mutex
+	rate  RateLimit
+	known bool
+}
+
+// RoundTrip sends a request and records the rate limit of the response
+func (t *rateTracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	// Other resources, like search, have limits of their own
+	if resource := resp.Header.Get("X-RateLimit-Resource"); resource != "" && resource != "core" {
+		return resp, nil
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return resp, nil
+	}
+	limit, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	reset, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+
+	t.mu.Lock()
+	t.rate = RateLimit{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+	t.known = true
+	t.mu.Unlock()
+	return resp, nil
+}
+
+// rateLimit returns the last reported rate limit, if any was
+func (t *rateTracker) rateLimit() (RateLimit, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rate, t.known
+}
+
+// NewClient creates a GitHub client authenticated with token that keeps
+// track of the API rate limit, reported by repositories created with it
+func NewClient(token string) *github.Client {
+	httpClient := github.NewClient(nil).WithAuthToken(token).Client()
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	httpClient.Transport = &rateTracker{next: transport}
+	return github.NewClient(httpClient)
+}
+
+// RateLimit returns the API rate limit last reported by GitHub, if the
+// client was created with NewClient and made a request yet
+func (r *GitHubRepository) RateLimit() (RateLimit, bool) {
+	tracker, ok := r.client.Client().Transport.(*rateTracker)
+	if !ok {
+		return RateLimit{}, false
+	}
+	return tracker.rateLimit()
+}
+
+// RateLimitOf returns the API rate limit of repo, if it keeps track of it
+func RateLimitOf(repo Repository) (RateLimit, bool) {
+	limited, ok := repo.(interface{ RateLimit() (RateLimit, bool) })
+	if !ok {
+		return RateLimit{}, false
+	}
+	return limited.RateLimit()
+}
@@ -2,11 +2,14 @@ package repository
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/google/go-github/v57/github"
+	"github.com/itcaat/catapult/internal/storage"
 )
 
 // Custom error types for better user experience
@@ -75,6 +78,7 @@ type RemoteFileInfo struct {
 	Content string
 	SHA     string
 	Size    int
+	Mode    string // Git file mode: 100644, 100755 or 120000
 }
 
 // Repository defines the interface for repository operations
@@ -84,25 +88,42 @@ type Repository interface {
 	CreateFile(ctx context.Context, path, content string) error
 	GetFile(ctx context.Context, path string) (string, error)
 	UpdateFile(ctx context.Context, path, content string) error
+	PutFile(ctx context.Context, path, content, mode string) error
+	MoveFile(ctx context.Context, oldPath, newPath, content, mode string) error
 	DeleteFile(ctx context.Context, path string) error
 	FileExists(ctx context.Context, path string) (bool, error)
 	ListFiles(ctx context.Context) ([]string, error)
 	GetAllFilesWithContent(ctx context.Context) (map[string]*RemoteFileInfo, error)
+	GetFileHistory(ctx context.Context, path string, limit int) ([]FileRevision, error)
+	GetFileAt(ctx context.Context, path, ref string) (*RemoteFileInfo, error)
+	GetFilesAt(ctx context.Context, ref string, paths []string) (map[string]*RemoteFileInfo, error)
+	GetAllFilesAt(ctx context.Context, ref string, have map[string]string) (map[string]*RemoteFileInfo, error)
+	ResolveCommitAt(ctx context.Context, at time.Time) (string, error)
+	GetHeadSHA(ctx context.Context) (string, error)
+	CompareCommits(ctx context.Context, base, head string) ([]FileChange, error)
 }
 
 // GitHubRepository implements the Repository interface using GitHub API
 type GitHubRepository struct {
-	client *github.Client
-	owner  string
-	name   string
+	client  *github.Client
+	owner   string
+	name    string
+	device  string // Recorded in commit messages to tell devices apart
+	commits commitLog
 }
 
 // New creates a new GitHubRepository instance
 func New(client *github.Client, owner, name string) Repository {
+	device, err := os.Hostname()
+	if err != nil {
+		device = "unknown"
+	}
+
 	return &GitHubRepository{
 		client: client,
 		owner:  owner,
 		name:   name,
+		device: device,
 	}
 }
 
@@ -166,56 +187,64 @@ func (r *GitHubRepository) CreateFile(ctx context.Context, path, content string)
 		}
 	}
 
-	_, _, err := r.client.Repositories.CreateFile(ctx, r.owner, r.name, path, &github.RepositoryContentFileOptions{
-		Message: github.String(fmt.Sprintf("Add %s", path)),
+	response, _, err := r.client.Repositories.CreateFile(ctx, r.owner, r.name, path, &github.RepositoryContentFileOptions{
+		Message: github.String(r.commitMessage("Add", path)),
 		Content: []byte(content),
 		Branch:  github.String("main"),
 	})
 	if err != nil {
-		// Check for GitHub API specific errors
-		if ghErr, ok := err.(*github.ErrorResponse); ok {
-			switch ghErr.Response.StatusCode {
-			case 413: // Payload Too Large
+		return classifyWriteError(err, path, fileSize, "failed to create file")
+	}
+	r.commits.record(&response.Commit)
+	return nil
+}
+
+// classifyWriteError converts GitHub API errors from file writes into user-friendly error types
+func classifyWriteError(err error, path string, fileSize int, context string) error {
+	const githubFileSizeLimit = 100 * 1024 * 1024 // 100MB in bytes
+
+	// Check for GitHub API specific errors
+	if ghErr, ok := err.(*github.ErrorResponse); ok {
+		switch ghErr.Response.StatusCode {
+		case 413: // Payload Too Large
+			return &FileSizeError{
+				FilePath: path,
+				FileSize: fileSize,
+				Limit:    githubFileSizeLimit,
+			}
+		case 422: // Unprocessable Entity (could be file too large or other validation error)
+			if fileSize > githubFileSizeLimit {
 				return &FileSizeError{
 					FilePath: path,
 					FileSize: fileSize,
 					Limit:    githubFileSizeLimit,
 				}
-			case 422: // Unprocessable Entity (could be file too large or other validation error)
-				if fileSize > githubFileSizeLimit {
-					return &FileSizeError{
-						FilePath: path,
-						FileSize: fileSize,
-						Limit:    githubFileSizeLimit,
-					}
-				}
-				return &GitHubValidationError{
-					FilePath: path,
-					Message:  "File validation failed",
-					Details:  ghErr.Message,
-				}
-			case 403: // Forbidden
-				return &GitHubPermissionError{
-					FilePath: path,
-					Message:  "Permission denied",
-					Details:  ghErr.Message,
-				}
-			case 404: // Not Found
-				return &GitHubRepositoryError{
-					Message: "Repository not found or inaccessible",
-					Details: ghErr.Message,
-				}
-			default:
-				return &GitHubAPIError{
-					StatusCode: ghErr.Response.StatusCode,
-					Message:    ghErr.Message,
-					FilePath:   path,
-				}
+			}
+			return &GitHubValidationError{
+				FilePath: path,
+				Message:  "File validation failed",
+				Details:  ghErr.Message,
+			}
+		case 403: // Forbidden
+			return &GitHubPermissionError{
+				FilePath: path,
+				Message:  "Permission denied",
+				Details:  ghErr.Message,
+			}
+		case 404: // Not Found
+			return &GitHubRepositoryError{
+				Message: "Repository not found or inaccessible",
+				Details: ghErr.Message,
+			}
+		default:
+			return &GitHubAPIError{
+				StatusCode: ghErr.Response.StatusCode,
+				Message:    ghErr.Message,
+				FilePath:   path,
 			}
 		}
-		return fmt.Errorf("failed to create file: %w", err)
 	}
-	return nil
+	return fmt.Errorf("%s: %w", context, err)
 }
 
 // GetFile gets a file from the repository
@@ -242,8 +271,8 @@ func (r *GitHubRepository) UpdateFile(ctx context.Context, path, content string)
 		return fmt.Errorf("failed to get file: %w", err)
 	}
 
-	_, _, err = r.client.Repositories.UpdateFile(ctx, r.owner, r.name, path, &github.RepositoryContentFileOptions{
-		Message: github.String(fmt.Sprintf("Update %s", path)),
+	response, _, err := r.client.Repositories.UpdateFile(ctx, r.owner, r.name, path, &github.RepositoryContentFileOptions{
+		Message: github.String(r.commitMessage("Update", path)),
 		Content: []byte(content),
 		SHA:     github.String(file.GetSHA()),
 		Branch:  github.String("main"),
@@ -251,6 +280,109 @@ func (r *GitHubRepository) UpdateFile(ctx context.Context, path, content string)
 	if err != nil {
 		return fmt.Errorf("failed to update file: %w", err)
 	}
+	r.commits.record(&response.Commit)
+	return nil
+}
+
+// PutFile creates or updates a file with an explicit git file mode.
+// The Contents API always commits files as 100644, so this goes through
+// the Git Data API to preserve executable bits and symlinks.
+func (r *GitHubRepository) PutFile(ctx context.Context, path, content, mode string) error {
+	fileSize := len(content)
+	const githubFileSizeLimit = 100 * 1024 * 1024 // 100MB in bytes
+
+	if fileSize > githubFileSizeLimit {
+		return &FileSizeError{
+			FilePath: path,
+			FileSize: fileSize,
+			Limit:    githubFileSizeLimit,
+		}
+	}
+
+	if mode == "" {
+		mode = storage.GitModeRegular
+	}
+
+	return r.commitFile(ctx, r.commitMessage("Update", path), path, content, mode)
+}
+
+// MoveFile moves a file to a new path in a single commit, writing content
+// under the new path with an explicit git file mode
+func (r *GitHubRepository) MoveFile(ctx context.Context, oldPath, newPath, content, mode string) error {
+	fileSize := len(content)
+	const githubFileSizeLimit = 100 * 1024 * 1024 // 100MB in bytes
+
+	if fileSize > githubFileSizeLimit {
+		return &FileSizeError{
+			FilePath: newPath,
+			FileSize: fileSize,
+			Limit:    githubFileSizeLimit,
+		}
+	}
+
+	if mode == "" {
+		mode = storage.GitModeRegular
+	}
+
+	// An entry without a SHA removes the old path from the tree
+	removal := &github.TreeEntry{
+		Path: github.String(oldPath),
+		Mode: github.String(mode),
+		Type: github.String("blob"),
+	}
+	return r.commitFile(ctx, r.commitMessage("Move", oldPath+" to "+newPath), newPath, content, mode, removal)
+}
+
+// commitFile commits content under path through the Git Data API, along
+// with any other tree entries given
+func (r *GitHubRepository) commitFile(ctx context.Context, message, path, content, mode string, entries ...*github.TreeEntry) error {
+	fileSize := len(content)
+
+	// Get current head of the branch
+	ref, _, err := r.client.Git.GetRef(ctx, r.owner, r.name, "heads/main")
+	if err != nil {
+		return fmt.Errorf("failed to get branch reference: %w", err)
+	}
+
+	parent, _, err := r.client.Git.GetCommit(ctx, r.owner, r.name, ref.GetObject().GetSHA())
+	if err != nil {
+		return fmt.Errorf("failed to get head commit: %w", err)
+	}
+
+	blob, _, err := r.client.Git.CreateBlob(ctx, r.owner, r.name, &github.Blob{
+		Content:  github.String(base64.StdEncoding.EncodeToString([]byte(content))),
+		Encoding: github.String("base64"),
+	})
+	if err != nil {
+		return classifyWriteError(err, path, fileSize, "failed to create blob")
+	}
+
+	entries = append([]*github.TreeEntry{{
+		Path: github.String(path),
+		Mode: github.String(mode),
+		Type: github.String("blob"),
+		SHA:  blob.SHA,
+	}}, entries...)
+	tree, _, err := r.client.Git.CreateTree(ctx, r.owner, r.name, parent.GetTree().GetSHA(), entries)
+	if err != nil {
+		return classifyWriteError(err, path, fileSize, "failed to create tree")
+	}
+
+	commit, _, err := r.client.Git.CreateCommit(ctx, r.owner, r.name, &github.Commit{
+		Message: github.String(message),
+		Tree:    tree,
+		Parents: []*github.Commit{{SHA: parent.SHA}},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create commit: %w", err)
+	}
+
+	ref.Object.SHA = commit.SHA
+	if _, _, err := r.client.Git.UpdateRef(ctx, r.owner, r.name, ref, false); err != nil {
+		return fmt.Errorf("failed to update branch reference: %w", err)
+	}
+	r.commits.record(commit)
+
 	return nil
 }
 
@@ -263,14 +395,15 @@ func (r *GitHubRepository) DeleteFile(ctx context.Context, path string) error {
 		return fmt.Errorf("failed to get file: %w", err)
 	}
 
-	_, _, err = r.client.Repositories.DeleteFile(ctx, r.owner, r.name, path, &github.RepositoryContentFileOptions{
-		Message: github.String(fmt.Sprintf("Delete %s", path)),
+	response, _, err := r.client.Repositories.DeleteFile(ctx, r.owner, r.name, path, &github.RepositoryContentFileOptions{
+		Message: github.String(r.commitMessage("Delete", path)),
 		SHA:     github.String(file.GetSHA()),
 		Branch:  github.String("main"),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
+	r.commits.record(&response.Commit)
 	return nil
 }
 
@@ -345,9 +478,36 @@ func (r *GitHubRepository) GetAllFilesWithContent(ctx context.Context) (map[stri
 		return nil, fmt.Errorf("failed to get all files with content: %w", err)
 	}
 
+	// The Contents API doesn't report file modes, read them from the tree
+	modes, err := r.getFileModes(ctx, "main")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file modes: %w", err)
+	}
+	for path, file := range files {
+		if mode, ok := modes[path]; ok {
+			file.Mode = mode
+		}
+	}
+
 	return files, nil
 }
 
+// getFileModes returns the git file mode of every blob in the tree at ref
+func (r *GitHubRepository) getFileModes(ctx context.Context, ref string) (map[string]string, error) {
+	tree, _, err := r.client.Git.GetTree(ctx, r.owner, r.name, ref, true)
+	if err != nil {
+		return nil, err
+	}
+
+	modes := make(map[string]string)
+	for _, entry := range tree.Entries {
+		if entry.GetType() == "blob" {
+			modes[filepath.FromSlash(entry.GetPath())] = entry.GetMode()
+		}
+	}
+	return modes, nil
+}
+
 // getAllFilesRecursive recursively lists files in a directory and retrieves their content
 func (r *GitHubRepository) getAllFilesRecursive(ctx context.Context, path string, files map[string]*RemoteFileInfo) error {
 	_, directoryContent, _, err := r.client.Repositories.GetContents(ctx, r.owner, r.name, path, &github.RepositoryContentGetOptions{
@@ -358,7 +518,26 @@ func (r *GitHubRepository) getAllFilesRecursive(ctx context.Context, path string
 	}
 
 	for _, content := range directoryContent {
-		if content.GetType() == "file" {
+		if content.GetType() == "symlink" {
+			filePath := content.GetName()
+			if path != "" {
+				filePath = filepath.Join(path, content.GetName())
+			}
+
+			// The blob of a symlink holds its target
+			target, _, err := r.client.Git.GetBlobRaw(ctx, r.owner, r.name, content.GetSHA())
+			if err != nil {
+				return fmt.Errorf("failed to get symlink target for %s: %w", filePath, err)
+			}
+
+			files[filePath] = &RemoteFileInfo{
+				Path:    filePath,
+				Content: string(target),
+				SHA:     content.GetSHA(),
+				Size:    content.GetSize(),
+				Mode:    storage.GitModeSymlink,
+			}
+		} else if content.GetType() == "file" {
 			filePath := content.GetName()
 			if path != "" {
 				filePath = filepath.Join(path, content.GetName())
@@ -387,6 +566,7 @@ func (r *GitHubRepository) getAllFilesRecursive(ctx context.Context, path string
 				Content: fileContent,
 				SHA:     content.GetSHA(),
 				Size:    content.GetSize(),
+				Mode:    storage.GitModeRegular,
 			}
 		} else if content.GetType() == "dir" {
 			// Recursively get files from subdirectory
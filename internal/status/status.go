@@ -6,16 +6,16 @@ import (
 	"io"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/itcaat/catapult/internal/autosync"
 	"github.com/itcaat/catapult/internal/repository"
 	"github.com/itcaat/catapult/internal/storage"
 )
 
-// PrintStatus prints the status of all tracked files (local and remote)
+// PrintStatus prints the status of all tracked files (local and remote).
+// The fetched remote state is recorded in fileManager for offline use.
 func PrintStatus(fileManager *storage.FileManager, repo repository.Repository, baseDir string, out io.Writer) error {
-	// Get all tracked files
-	localFiles := fileManager.GetTrackedFiles()
-
 	// Get remote files
 	ctx := context.Background()
 	remoteFiles, err := repo.GetAllFilesWithContent(ctx)
@@ -23,6 +23,38 @@ func PrintStatus(fileManager *storage.FileManager, repo repository.Repository, b
 		return fmt.Errorf("failed to get remote files: %w", err)
 	}
 
+	shas := make(map[string]string, len(remoteFiles))
+	for relPath, remoteFile := range remoteFiles {
+		shas[relPath] = remoteFile.SHA
+	}
+	fileManager.SetRemoteManifest(storage.NewRemoteManifest("", shas))
+
+	return printStatus(fileManager, remoteFiles, baseDir, "Files Status (Local + Remote):", out)
+}
+
+// PrintCachedStatus prints the status of all tracked files against the last
+// known remote state, without network access
+func PrintCachedStatus(fileManager *storage.FileManager, manifest *storage.RemoteManifest, baseDir string, out io.Writer) error {
+	remoteFiles := make(map[string]*repository.RemoteFileInfo, len(manifest.Files))
+	for key, sha := range manifest.Files {
+		relPath := filepath.FromSlash(key)
+		remoteFiles[relPath] = &repository.RemoteFileInfo{Path: relPath, SHA: sha}
+	}
+
+	header := fmt.Sprintf("Files Status (Local + Remote as of %s", manifest.FetchedAt.Local().Format("2006-01-02 15:04:05"))
+	if manifest.CommitSHA != "" {
+		header += fmt.Sprintf(", commit %.7s", manifest.CommitSHA)
+	}
+	header += "):"
+
+	return printStatus(fileManager, remoteFiles, baseDir, header, out)
+}
+
+// printStatus prints the status of all tracked files against remoteFiles
+func printStatus(fileManager *storage.FileManager, remoteFiles map[string]*repository.RemoteFileInfo, baseDir, header string, out io.Writer) error {
+	// Get all tracked files
+	localFiles := fileManager.GetTrackedFiles()
+
 	// Create a unified map of all files (local + remote)
 	allFiles := make(map[string]*storage.FileInfo)
 
@@ -52,7 +84,7 @@ func PrintStatus(fileManager *storage.FileManager, repo repository.Repository, b
 		return nil
 	}
 
-	fmt.Fprintln(out, "Files Status (Local + Remote):")
+	fmt.Fprintln(out, header)
 	fmt.Fprintln(out, strings.Repeat("-", 80))
 
 	for relPath, file := range allFiles {
@@ -67,6 +99,22 @@ func PrintStatus(fileManager *storage.FileManager, repo repository.Repository, b
 	return nil
 }
 
+// PrintDeadLetters lists the auto-sync operations that were given up on
+func PrintDeadLetters(deadLetters []*autosync.QueueOperation, out io.Writer) {
+	if len(deadLetters) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "\n☠️  %d operations failed permanently and won't be retried automatically:\n", len(deadLetters))
+	for _, op := range deadLetters {
+		path := op.FilePath
+		if op.IsFullSync() {
+			path = "(all files)"
+		}
+		fmt.Fprintf(out, "  %-30s %-8s failed %s: %s\n", path, op.Operation, op.FailedAt.Local().Format(time.DateTime), op.LastError)
+	}
+}
+
 // determineFileStatus determines the sync status of a file
 func determineFileStatus(file *storage.FileInfo, remoteFile *repository.RemoteFileInfo) string {
 	// Check for sync errors FIRST (highest priority)
@@ -88,6 +136,11 @@ func determineFileStatus(file *storage.FileInfo, remoteFile *repository.RemoteFi
 		return "Local-only"
 	}
 
+	// Flagged by repair as differing from the repository
+	if file.NeedsAttention {
+		return "Needs attention"
+	}
+
 	// Check if file exists locally (by checking if we have a local hash)
 	localExists := file.Hash != ""
 
@@ -127,6 +180,8 @@ func getStatusEmoji(status string) string {
 		return "⚠️" // Yellow - Needs sync
 	case status == "Conflict":
 		return "❌" // Red - Failed/Conflict
+	case status == "Needs attention":
+		return "🔍" // Waiting for the user
 	case status == "Deleted locally":
 		return "🗑️" // Gray - Deleted
 	case status == "Local-only":
@@ -6,7 +6,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/itcaat/catapult/internal/autosync"
 	"github.com/itcaat/catapult/internal/repository"
 	"github.com/itcaat/catapult/internal/storage"
 	"github.com/stretchr/testify/assert"
@@ -43,6 +45,16 @@ func (m *MockRepository) UpdateFile(ctx context.Context, path, content string) e
 	return args.Error(0)
 }
 
+func (m *MockRepository) PutFile(ctx context.Context, path, content, mode string) error {
+	args := m.Called(ctx, path, content, mode)
+	return args.Error(0)
+}
+
+func (m *MockRepository) MoveFile(ctx context.Context, oldPath, newPath, content, mode string) error {
+	args := m.Called(ctx, oldPath, newPath, content, mode)
+	return args.Error(0)
+}
+
 func (m *MockRepository) DeleteFile(ctx context.Context, path string) error {
 	args := m.Called(ctx, path)
 	return args.Error(0)
@@ -63,6 +75,46 @@ func (m *MockRepository) GetAllFilesWithContent(ctx context.Context) (map[string
 	return args.Get(0).(map[string]*repository.RemoteFileInfo), args.Error(1)
 }
 
+func (m *MockRepository) GetFileHistory(ctx context.Context, path string, limit int) ([]repository.FileRevision, error) {
+	args := m.Called(ctx, path, limit)
+	revisions, _ := args.Get(0).([]repository.FileRevision)
+	return revisions, args.Error(1)
+}
+
+func (m *MockRepository) GetFileAt(ctx context.Context, path, ref string) (*repository.RemoteFileInfo, error) {
+	args := m.Called(ctx, path, ref)
+	file, _ := args.Get(0).(*repository.RemoteFileInfo)
+	return file, args.Error(1)
+}
+
+func (m *MockRepository) GetFilesAt(ctx context.Context, ref string, paths []string) (map[string]*repository.RemoteFileInfo, error) {
+	args := m.Called(ctx, ref, paths)
+	files, _ := args.Get(0).(map[string]*repository.RemoteFileInfo)
+	return files, args.Error(1)
+}
+
+func (m *MockRepository) GetAllFilesAt(ctx context.Context, ref string, have map[string]string) (map[string]*repository.RemoteFileInfo, error) {
+	args := m.Called(ctx, ref, have)
+	files, _ := args.Get(0).(map[string]*repository.RemoteFileInfo)
+	return files, args.Error(1)
+}
+
+func (m *MockRepository) ResolveCommitAt(ctx context.Context, at time.Time) (string, error) {
+	args := m.Called(ctx, at)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) GetHeadSHA(ctx context.Context) (string, error) {
+	args := m.Called(ctx)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) CompareCommits(ctx context.Context, base, head string) ([]repository.FileChange, error) {
+	args := m.Called(ctx, base, head)
+	changes, _ := args.Get(0).([]repository.FileChange)
+	return changes, args.Error(1)
+}
+
 func TestPrintStatus(t *testing.T) {
 	// Create temporary directory for test
 	tempDir, err := os.MkdirTemp("", "catapult-status-test-*")
@@ -388,3 +440,47 @@ func TestDetermineFileStatusWithSyncError(t *testing.T) {
 		assert.Equal(t, "Sync Error (Network)", status)
 	})
 }
+
+func TestPrintCachedStatus(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "synced.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("content"), 0644))
+
+	fileManager := storage.NewFileManager(tempDir)
+	assert.NoError(t, fileManager.ScanDirectory())
+	info, err := fileManager.GetFileInfo(path)
+	assert.NoError(t, err)
+	fileManager.SetSyncInfo(path, info.Hash, "sha-synced", storage.GitModeRegular)
+
+	manifest := storage.NewRemoteManifest("0123456789abcdef", map[string]string{
+		"synced.txt":      "sha-synced",
+		"dir/remote1.txt": "sha-remote",
+	})
+	manifest.FetchedAt = time.Date(2024, 5, 1, 14, 30, 0, 0, time.Local)
+
+	// No repository is needed
+	var buf bytes.Buffer
+	assert.NoError(t, PrintCachedStatus(fileManager, manifest, tempDir, &buf))
+
+	output := buf.String()
+	assert.Contains(t, output, "as of 2024-05-01 14:30:00, commit 0123456")
+	assert.Contains(t, output, "Synced")
+	assert.Contains(t, output, filepath.Join("dir", "remote1.txt"))
+	assert.Contains(t, output, "Remote-only")
+}
+
+func TestPrintDeadLetters(t *testing.T) {
+	var out bytes.Buffer
+	PrintDeadLetters(nil, &out)
+	assert.Empty(t, out.String())
+
+	PrintDeadLetters([]*autosync.QueueOperation{{
+		FilePath:  "video.mov",
+		Operation: autosync.OperationCreate,
+		LastError: "File 'video.mov' (120.0 MB) exceeds GitHub's 100 MB limit",
+		FailedAt:  time.Now(),
+	}}, &out)
+	assert.Contains(t, out.String(), "1 operations failed permanently")
+	assert.Contains(t, out.String(), "video.mov")
+	assert.Contains(t, out.String(), "exceeds GitHub's 100 MB limit")
+}
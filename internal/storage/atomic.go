@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TempFilePrefix starts the names of temp files used for atomic writes.
+// Scans ignore them, and leftovers from interrupted writes are removed.
+const TempFilePrefix = ".catapult-tmp-"
+
+// staleTempFileAge is how old a leftover temp file must be before a scan removes it
+const staleTempFileAge = time.Hour
+
+// ChangedOnDiskError reports a file that changed after it was scanned, so
+// writing to it would overwrite an edit that hasn't been synced yet
+type ChangedOnDiskError struct {
+	Path string
+}
+
+func (e *ChangedOnDiskError) Error() string {
+	return fmt.Sprintf("'%s' changed on disk while syncing", e.Path)
+}
+
+// IntegrityError reports written content that doesn't match the expected git blob SHA
+type IntegrityError struct {
+	Path     string
+	Expected string
+	Actual   string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("content written to '%s' doesn't match the expected blob %s (got %s)", e.Path, e.Expected, e.Actual)
+}
+
+// isTempFile reports whether name is a temp file of an atomic write
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, TempFilePrefix)
+}
+
+// removeStaleTempFile removes a temp file left behind by an interrupted write
+func removeStaleTempFile(path string, info os.FileInfo) {
+	if time.Since(info.ModTime()) > staleTempFileAge {
+		os.Remove(path)
+	}
+}
+
+// WriteFileAtomic writes content to path through a temp file in the same
+// directory, which is fsynced, verified against expectedSHA and renamed into
+// place, so path never holds partially written content. An empty expectedSHA
+// verifies against the SHA of content.
+//
+// If scanned is not nil, the write is abandoned with a ChangedOnDiskError when
+// the file on disk no longer matches what was scanned. A scanned file without
+// hash, or marked as deleted, is expected not to exist.
+func (fm *FileManager) WriteFileAtomic(path string, content []byte, gitMode, expectedSHA string, scanned *FileInfo) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if expectedSHA == "" {
+		expectedSHA = fm.calculateGitSHAFromContent(content)
+	}
+
+	tmpPath, err := fm.writeTempFile(path, content, gitMode)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath) // No-op once renamed
+
+	// Verify what actually reached the disk
+	written, err := readWritten(tmpPath, gitMode)
+	if err != nil {
+		return fmt.Errorf("failed to verify written file: %w", err)
+	}
+	if actual := fm.calculateGitSHAFromContent(written); actual != expectedSHA {
+		return &IntegrityError{Path: path, Expected: expectedSHA, Actual: actual}
+	}
+
+	if scanned != nil {
+		changed, err := fm.changedSinceScan(path, scanned)
+		if err != nil {
+			return err
+		}
+		if changed {
+			return &ChangedOnDiskError{Path: path}
+		}
+	}
+
+	// Renaming over a directory or onto a link's target is never intended
+	if info, err := os.Lstat(path); err == nil && info.IsDir() {
+		return fmt.Errorf("cannot replace directory '%s' with a file", path)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+	SyncDir(dir)
+
+	return nil
+}
+
+// WriteDataAtomic writes data to path through a temp file that is fsynced and
+// renamed into place, so path never holds partially written data
+func WriteDataAtomic(path string, data []byte) error {
+	return writeFileAtomic(path, data, false)
+}
+
+// writeFileAtomic writes data to a temp file and renames it into place,
+// optionally keeping the previous file as backup
+func writeFileAtomic(path string, data []byte, backup bool) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to flush temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	// Keep the previous generation, unless it is identical
+	if previous, err := os.ReadFile(path); backup && err == nil && !bytes.Equal(previous, data) {
+		if err := os.Rename(path, path+BackupSuffix); err != nil {
+			return fmt.Errorf("failed to back up file: %w", err)
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+	SyncDir(dir)
+
+	return nil
+}
+
+// writeTempFile writes content (or a symlink to it) to a new temp file next to path
+func (fm *FileManager) writeTempFile(path string, content []byte, gitMode string) (string, error) {
+	dir := filepath.Dir(path)
+
+	if gitMode == GitModeSymlink {
+		// Symlinks can't be created through os.CreateTemp, pick a free name
+		for i := 0; ; i++ {
+			tmpPath := filepath.Join(dir, fmt.Sprintf("%s%s-%d-%d", TempFilePrefix, filepath.Base(path), os.Getpid(), i))
+			err := os.Symlink(string(content), tmpPath)
+			if err == nil {
+				return tmpPath, nil
+			}
+			if !os.IsExist(err) {
+				return "", fmt.Errorf("failed to create symlink: %w", err)
+			}
+		}
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Lstat(path); err == nil && info.Mode().IsRegular() {
+		perm = info.Mode().Perm()
+	}
+	perm = permForGitMode(perm, gitMode)
+
+	tmp, err := os.CreateTemp(dir, TempFilePrefix+filepath.Base(path)+"-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to flush temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	return tmp.Name(), nil
+}
+
+// readWritten reads back a written temp file as synced content
+func readWritten(path, gitMode string) ([]byte, error) {
+	if gitMode == GitModeSymlink {
+		target, err := os.Readlink(path)
+		return []byte(target), err
+	}
+	return os.ReadFile(path)
+}
+
+// changedSinceScan reports whether the file at path differs from its scanned state
+func (fm *FileManager) changedSinceScan(path string, scanned *FileInfo) (bool, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		// Gone since the scan; only a problem if it existed then
+		return scanned.Hash != "" && !scanned.Deleted, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	if scanned.Hash == "" || scanned.Deleted {
+		// Created since the scan
+		return true, nil
+	}
+
+	if info.ModTime().Equal(scanned.LastModified) && info.Size() == scanned.Size {
+		return false, nil
+	}
+
+	hash, err := fm.calculateFileHash(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to calculate file hash: %w", err)
+	}
+	return hash != scanned.Hash, nil
+}
+
+// SyncDir flushes a directory so a rename or removal in it survives a crash.
+// Not all platforms support this, so errors are ignored.
+func SyncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "notes.txt")
+	require.NoError(t, os.WriteFile(path, []byte("original"), 0644))
+
+	fm := NewFileManager(tempDir)
+	require.NoError(t, fm.ScanDirectory())
+	scanned, err := fm.GetFileInfo(path)
+	require.NoError(t, err)
+
+	t.Run("IntegrityMismatch", func(t *testing.T) {
+		err := fm.WriteFileAtomic(path, []byte("truncated"), GitModeRegular, fm.CalculateGitSHAFromContent([]byte("full content")), scanned)
+		var integrityErr *IntegrityError
+		assert.True(t, errors.As(err, &integrityErr))
+
+		// The original is untouched and no temp file is left behind
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "original", string(content))
+		entries, err := os.ReadDir(tempDir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		expected := fm.CalculateGitSHAFromContent([]byte("downloaded"))
+		require.NoError(t, fm.WriteFileAtomic(path, []byte("downloaded"), GitModeRegular, expected, scanned))
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "downloaded", string(content))
+	})
+
+	t.Run("ChangedSinceScan", func(t *testing.T) {
+		require.NoError(t, fm.ScanDirectory())
+		scanned, err := fm.GetFileInfo(path)
+		require.NoError(t, err)
+
+		// An editor saves the file after the scan
+		require.NoError(t, os.WriteFile(path, []byte("edited while syncing"), 0644))
+
+		err = fm.WriteFileAtomic(path, []byte("remote"), GitModeRegular, "", scanned)
+		var changedErr *ChangedOnDiskError
+		assert.True(t, errors.As(err, &changedErr))
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "edited while syncing", string(content))
+	})
+
+	t.Run("CreatedSinceScan", func(t *testing.T) {
+		newPath := filepath.Join(tempDir, "new.txt")
+		require.NoError(t, os.WriteFile(newPath, []byte("created while syncing"), 0644))
+
+		err := fm.WriteFileAtomic(newPath, []byte("remote"), GitModeRegular, "", &FileInfo{Path: newPath})
+		var changedErr *ChangedOnDiskError
+		assert.True(t, errors.As(err, &changedErr))
+	})
+}
+
+func TestScanDirectory_IgnoresTempFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "notes.txt"), []byte("notes"), 0644))
+
+	current := filepath.Join(tempDir, TempFilePrefix+"notes.txt-1")
+	stale := filepath.Join(tempDir, TempFilePrefix+"notes.txt-2")
+	require.NoError(t, os.WriteFile(current, []byte("partial"), 0644))
+	require.NoError(t, os.WriteFile(stale, []byte("partial"), 0644))
+	old := time.Now().Add(-2 * staleTempFileAge)
+	require.NoError(t, os.Chtimes(stale, old, old))
+
+	fm := NewFileManager(tempDir)
+	require.NoError(t, fm.ScanDirectory())
+	assert.Len(t, fm.GetTrackedFiles(), 1)
+
+	// Leftovers of interrupted writes are cleaned up, writes in progress are not
+	_, err := os.Stat(stale)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(current)
+	assert.NoError(t, err)
+}
@@ -4,23 +4,35 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
 // FileInfo represents metadata about a file
 type FileInfo struct {
-	Path                string    `json:"path"`
-	Hash                string    `json:"hash"`
-	LastModified        time.Time `json:"last_modified"`
-	Size                int64     `json:"size"`
-	LastSyncedHash      string    `json:"last_synced_hash"`
-	LastSyncedRemoteSHA string    `json:"last_synced_remote_sha"`
-	Deleted             bool      `json:"deleted,omitempty"` // Track if file was deleted locally
+	Path                string      `json:"path"`
+	Hash                string      `json:"hash"`
+	LastModified        time.Time   `json:"last_modified"`
+	Size                int64       `json:"size"`
+	LastSyncedHash      string      `json:"last_synced_hash"`
+	LastSyncedRemoteSHA string      `json:"last_synced_remote_sha"`
+	Deleted             bool        `json:"deleted,omitempty"` // Track if file was deleted locally
+	Mode                os.FileMode `json:"mode,omitempty"`
+	LinkTarget          string      `json:"link_target,omitempty"` // Set for preserved symlinks
+	LastSyncedMode      string      `json:"last_synced_mode,omitempty"`
+
+	// NeedsAttention is set by repair for files that differ from the
+	// repository; sync leaves them alone until they are edited or deleted
+	NeedsAttention bool `json:"needs_attention,omitempty"`
+
+	// Stat cache: Hash is only recalculated when these change
+	Inode      uint64    `json:"inode,omitempty"`
+	ChangeTime time.Time `json:"ctime,omitempty"`
 
 	// Error tracking fields
 	LastSyncErrorMsg string    `json:"last_sync_error,omitempty"`
@@ -28,6 +40,52 @@ type FileInfo struct {
 	SyncRetryCount   int       `json:"sync_retry_count,omitempty"`
 }
 
+// racyWindow is how recently a file may have been modified before its stat
+// can no longer be trusted to reveal further changes, as timestamps have a
+// limited resolution on some file systems
+const racyWindow = 2 * time.Second
+
+// MetadataDir is the catapult-managed directory inside the base directory.
+// It holds conflict backups locally and sync metadata in the repository,
+// and is never synced as regular files.
+const MetadataDir = ".catapult"
+
+// Git file modes used when committing files
+const (
+	GitModeRegular    = "100644"
+	GitModeExecutable = "100755"
+	GitModeSymlink    = "120000"
+)
+
+// GitMode returns the git file mode matching the tracked file mode
+func (f *FileInfo) GitMode() string {
+	return GitModeFromFileMode(f.Mode)
+}
+
+// GitModeFromFileMode maps a local file mode to a git file mode
+func GitModeFromFileMode(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return GitModeSymlink
+	case mode.Perm()&0111 != 0:
+		return GitModeExecutable
+	default:
+		return GitModeRegular
+	}
+}
+
+// SymlinkPolicy controls how symbolic links in the base directory are handled
+type SymlinkPolicy string
+
+const (
+	// SymlinkPreserve stores symlinks as links (git mode 120000)
+	SymlinkPreserve SymlinkPolicy = "preserve"
+	// SymlinkFollow syncs the content of the link target instead of the link
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkSkip ignores symlinks entirely
+	SymlinkSkip SymlinkPolicy = "skip"
+)
+
 // SyncStatus represents the synchronization status of a file
 type SyncStatus int
 
@@ -42,17 +100,35 @@ const (
 	SyncStatusConflict
 )
 
-// FileManager handles local file operations and tracking
+// FileManager handles local file operations and tracking. Files are keyed
+// by their path relative to the base directory, with forward slashes, so the
+// state stays valid when the base directory moves.
+//
+// A FileManager is safe for concurrent use. Tracked files are handed out as
+// copies, so callers never share a FileInfo with the manager.
 type FileManager struct {
-	baseDir string
-	files   map[string]*FileInfo
+	baseDir       string
+	absBaseDir    string
+	symlinkPolicy SymlinkPolicy // Set before the manager is shared
+
+	mu     sync.RWMutex
+	files  map[string]*FileInfo
+	rehash bool
+	remote *RemoteManifest
 }
 
 // NewFileManager creates a new FileManager instance
 func NewFileManager(baseDir string) *FileManager {
+	absBaseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		absBaseDir = baseDir
+	}
+
 	return &FileManager{
-		baseDir: baseDir,
-		files:   make(map[string]*FileInfo),
+		baseDir:       baseDir,
+		absBaseDir:    absBaseDir,
+		files:         make(map[string]*FileInfo),
+		symlinkPolicy: SymlinkPreserve,
 	}
 }
 
@@ -61,8 +137,52 @@ func (fm *FileManager) BaseDir() string {
 	return fm.baseDir
 }
 
-// ScanDirectory scans the base directory for files and updates the tracking list
+// key returns the state key of a path: relative to the base directory, with
+// forward slashes
+func (fm *FileManager) key(path string) string {
+	if absPath, err := filepath.Abs(path); err == nil {
+		path = absPath
+	}
+	if relPath, err := filepath.Rel(fm.absBaseDir, path); err == nil {
+		return filepath.ToSlash(relPath)
+	}
+	return filepath.ToSlash(path)
+}
+
+// localPath returns the local path of a state key
+func (fm *FileManager) localPath(key string) string {
+	return filepath.Join(fm.baseDir, filepath.FromSlash(key))
+}
+
+// SetSymlinkPolicy sets how symlinks are handled during scanning and syncing.
+// It must be called before the FileManager is used concurrently.
+func (fm *FileManager) SetSymlinkPolicy(policy SymlinkPolicy) {
+	if policy == "" {
+		policy = SymlinkPreserve
+	}
+	fm.symlinkPolicy = policy
+}
+
+// SymlinkPolicy returns the configured symlink policy
+func (fm *FileManager) SymlinkPolicy() SymlinkPolicy {
+	return fm.symlinkPolicy
+}
+
+// RehashAll makes the next scan recalculate the hash of every file, even if
+// its stat is unchanged
+func (fm *FileManager) RehashAll() {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fm.rehash = true
+}
+
+// ScanDirectory scans the base directory for files and updates the tracking
+// list. Files are only hashed if their stat changed since the last scan.
 func (fm *FileManager) ScanDirectory() error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
 	// Save existing files data to preserve sync info
 	existingFiles := make(map[string]*FileInfo)
 	for path, info := range fm.files {
@@ -74,50 +194,203 @@ func (fm *FileManager) ScanDirectory() error {
 		info.Deleted = true
 	}
 
-	// Walk through the directory
-	err := filepath.Walk(fm.baseDir, func(path string, info os.FileInfo, err error) error {
+	// Walk through the directory, tracking visited directories so that
+	// followed symlinks can't loop forever
+	if err := fm.scanDir(fm.baseDir, existingFiles, make(map[string]bool)); err != nil {
+		return err
+	}
+
+	fm.rehash = false
+	return nil
+}
+
+// RescanFile updates the tracking of a single path, such as one reported by
+// the file watcher, without scanning the whole directory
+func (fm *FileManager) RescanFile(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	relPath, err := filepath.Rel(fm.absBaseDir, path)
+	if err != nil || !validStateKey(filepath.ToSlash(relPath)) {
+		return fmt.Errorf("'%s' is not in the sync directory", path)
+	}
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	path = fm.localPath(filepath.ToSlash(relPath))
+	if isTempFile(filepath.Base(path)) || strings.SplitN(filepath.ToSlash(relPath), "/", 2)[0] == MetadataDir {
+		return nil
+	}
+
+	info, err := fm.statPath(path)
+	if os.IsNotExist(err) {
+		// A removed directory takes every file below it along
+		key := fm.key(path)
+		for fileKey, fileInfo := range fm.files {
+			if fileKey == key || strings.HasPrefix(fileKey, key+"/") {
+				fileInfo.Deleted = true
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 && fm.symlinkPolicy == SymlinkSkip {
+		return nil
+	}
+
+	if info.IsDir() {
+		existingFiles := make(map[string]*FileInfo)
+		for filePath, fileInfo := range fm.files {
+			existingFiles[filePath] = fileInfo
+		}
+		return fm.scanDir(path, existingFiles, make(map[string]bool))
+	}
+
+	return fm.trackFile(path, info, fm.files)
+}
+
+// scanDir recursively scans a directory applying the symlink policy
+func (fm *FileManager) scanDir(dir string, existingFiles map[string]*FileInfo, visited map[string]bool) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve directory %s: %w", dir, err)
+	}
+	if visited[realDir] {
+		return nil
+	}
+	visited[realDir] = true
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+
+		info, err := os.Lstat(path)
 		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed or renamed while scanning
+				continue
+			}
 			return err
 		}
 
-		// Skip directories and hidden files
+		// Temp files of atomic writes are never synced
+		if isTempFile(entry.Name()) {
+			removeStaleTempFile(path, info)
+			continue
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			switch fm.symlinkPolicy {
+			case SymlinkSkip:
+				continue
+			case SymlinkFollow:
+				targetInfo, err := os.Stat(path)
+				if err != nil {
+					// Broken link, nothing to follow
+					continue
+				}
+				info = targetInfo
+			}
+		}
+
+		// Descend into directories
 		if info.IsDir() {
-			return nil
+			if dir == fm.baseDir && entry.Name() == MetadataDir {
+				continue
+			}
+			if err := fm.scanDir(path, existingFiles, visited); err != nil {
+				return err
+			}
+			continue
 		}
 
-		// Calculate file hash
+		if err := fm.trackFile(path, info, existingFiles); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// trackFile records the current metadata of a scanned file
+func (fm *FileManager) trackFile(path string, info os.FileInfo, existingFiles map[string]*FileInfo) error {
+	linkTarget := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if linkTarget, err = os.Readlink(path); err != nil {
+			return fmt.Errorf("failed to read symlink: %w", err)
+		}
+	}
+
+	// Check if file was already tracked
+	key := fm.key(path)
+	fileInfo, exists := existingFiles[key]
+	if !exists {
+		fileInfo = &FileInfo{Path: path}
+	}
+
+	// Only hash files whose stat changed
+	inode, changeTime := fileInode(info), fileChangeTime(info)
+	if fm.rehash || !fileInfo.statMatches(info, inode, changeTime, linkTarget) {
 		hash, err := fm.calculateFileHash(path)
 		if err != nil {
 			return fmt.Errorf("failed to calculate file hash: %w", err)
 		}
-
-		// Check if file was already tracked
-		if existingInfo, exists := existingFiles[path]; exists {
-			// Update existing file info
-			existingInfo.Hash = hash
-			existingInfo.LastModified = info.ModTime()
-			existingInfo.Size = info.Size()
-			existingInfo.Deleted = false // File exists, not deleted
-			fm.files[path] = existingInfo
-		} else {
-			// Create new file info
-			fileInfo := &FileInfo{
-				Path:         path,
-				Hash:         hash,
-				LastModified: info.ModTime(),
-				Size:         info.Size(),
-				Deleted:      false,
-			}
-			fm.files[path] = fileInfo
+		if hash != fileInfo.Hash {
+			fileInfo.NeedsAttention = false
 		}
+		fileInfo.Hash = hash
+	}
 
-		return nil
-	})
+	fileInfo.Path = path
+	fileInfo.LastModified = info.ModTime()
+	fileInfo.Size = info.Size()
+	fileInfo.Mode = info.Mode()
+	fileInfo.Inode = inode
+	fileInfo.ChangeTime = changeTime
+	fileInfo.LinkTarget = linkTarget
+	fileInfo.Deleted = false // File exists, not deleted
+	fm.files[key] = fileInfo
+
+	return nil
+}
 
-	return err
+// statMatches reports whether a file's stat is unchanged since it was
+// hashed, so the recorded hash is still valid. Files modified very recently
+// are never trusted, as a further change may not show in their timestamps.
+func (f *FileInfo) statMatches(info os.FileInfo, inode uint64, changeTime time.Time, linkTarget string) bool {
+	return f.Hash != "" &&
+		f.Size == info.Size() &&
+		f.LastModified.Equal(info.ModTime()) &&
+		f.Mode == info.Mode() &&
+		f.Inode == inode &&
+		f.ChangeTime.Equal(changeTime) &&
+		f.LinkTarget == linkTarget &&
+		time.Since(info.ModTime()) > racyWindow
 }
 
-// GetTrackedFiles returns a list of tracked files
+// Files returns copies of the tracked files as of the last scan
+func (fm *FileManager) Files() []*FileInfo {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	files := make([]*FileInfo, 0, len(fm.files))
+	for _, file := range fm.files {
+		copied := *file
+		files = append(files, &copied)
+	}
+	return files
+}
+
+// GetTrackedFiles scans the directory and returns copies of the tracked files
 func (fm *FileManager) GetTrackedFiles() []*FileInfo {
 	// Scan directory before returning files
 	if err := fm.ScanDirectory(); err != nil {
@@ -125,15 +398,25 @@ func (fm *FileManager) GetTrackedFiles() []*FileInfo {
 		fmt.Printf("Warning: failed to scan directory: %v\n", err)
 	}
 
-	files := make([]*FileInfo, 0, len(fm.files))
-	for _, file := range fm.files {
-		files = append(files, file)
-	}
-	return files
+	return fm.Files()
 }
 
-// GetFileInfo returns information about a tracked file
+// GetFileInfo returns a copy of the information about a tracked file
 func (fm *FileManager) GetFileInfo(path string) (*FileInfo, error) {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	fileInfo, err := fm.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *fileInfo
+	return &copied, nil
+}
+
+// lookup returns the tracked file at path; the caller must hold the lock
+func (fm *FileManager) lookup(path string) (*FileInfo, error) {
 	// Get absolute path
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -141,7 +424,7 @@ func (fm *FileManager) GetFileInfo(path string) (*FileInfo, error) {
 	}
 
 	// Get file info
-	fileInfo, exists := fm.files[absPath]
+	fileInfo, exists := fm.files[fm.key(absPath)]
 	if !exists {
 		return nil, fmt.Errorf("file not tracked: %s", path)
 	}
@@ -158,13 +441,14 @@ func (fm *FileManager) HasChanges(path string) (bool, error) {
 	}
 
 	// Get current file info
-	info, err := os.Stat(fileInfo.Path)
+	info, err := fm.statPath(fileInfo.Path)
 	if err != nil {
 		return false, fmt.Errorf("failed to get file info: %w", err)
 	}
 
-	// Check if file has been modified
-	if info.ModTime().After(fileInfo.LastModified) {
+	// Check if file has been modified. Any mtime difference counts, not just
+	// a newer one, but restored mtimes match the recorded ones after download.
+	if !info.ModTime().Equal(fileInfo.LastModified) || info.Size() != fileInfo.Size {
 		// Calculate new hash
 		hash, err := fm.calculateFileHash(fileInfo.Path)
 		if err != nil {
@@ -180,14 +464,17 @@ func (fm *FileManager) HasChanges(path string) (bool, error) {
 
 // UpdateFileInfo updates the file information
 func (fm *FileManager) UpdateFileInfo(path string) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
 	// Get file info
-	fileInfo, err := fm.GetFileInfo(path)
+	fileInfo, err := fm.lookup(path)
 	if err != nil {
 		return err
 	}
 
 	// Get current file info
-	info, err := os.Stat(fileInfo.Path)
+	info, err := fm.statPath(fileInfo.Path)
 	if err != nil {
 		return fmt.Errorf("failed to get file info: %w", err)
 	}
@@ -202,41 +489,109 @@ func (fm *FileManager) UpdateFileInfo(path string) error {
 	fileInfo.Hash = hash
 	fileInfo.LastModified = info.ModTime()
 	fileInfo.Size = info.Size()
+	fileInfo.Mode = info.Mode()
+	fileInfo.Inode = fileInode(info)
+	fileInfo.ChangeTime = fileChangeTime(info)
 
 	return nil
 }
 
-// SaveState saves the current state to a file
-func (fm *FileManager) SaveState(path string) error {
-	// Create state file
-	file, err := os.Create(path)
+// isPreservedSymlink reports whether path is a symlink stored as a link
+func (fm *FileManager) isPreservedSymlink(path string) bool {
+	if fm.symlinkPolicy == SymlinkFollow {
+		return false
+	}
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// statPath returns file info for path, following symlinks only when configured to
+func (fm *FileManager) statPath(path string) (os.FileInfo, error) {
+	if fm.symlinkPolicy == SymlinkFollow {
+		return os.Stat(path)
+	}
+	return os.Lstat(path)
+}
+
+// LocalGitMode returns the git file mode of a file as it currently is on disk
+func (fm *FileManager) LocalGitMode(path string) (string, error) {
+	info, err := fm.statPath(path)
 	if err != nil {
-		return fmt.Errorf("failed to create state file: %w", err)
+		return "", fmt.Errorf("failed to get file info: %w", err)
 	}
-	defer file.Close()
+	return GitModeFromFileMode(info.Mode()), nil
+}
 
-	// Encode state
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(fm.files); err != nil {
-		return fmt.Errorf("failed to encode state: %w", err)
+// ReadFileContent returns the content to sync for a file.
+// For preserved symlinks this is the link target.
+func (fm *FileManager) ReadFileContent(path string) ([]byte, error) {
+	if fm.isPreservedSymlink(path) {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read symlink: %w", err)
+		}
+		return []byte(target), nil
 	}
+	return os.ReadFile(path)
+}
 
-	return nil
+// WriteFileContent atomically writes downloaded content to path, restoring the git file mode.
+// Symlinks (mode 120000) are recreated as links pointing to content.
+func (fm *FileManager) WriteFileContent(path string, content []byte, gitMode string) error {
+	return fm.WriteFileAtomic(path, content, gitMode, "", nil)
 }
 
-// LoadState loads the state from a file
-func (fm *FileManager) LoadState(path string) error {
-	// Open state file
-	file, err := os.Open(path)
+// ApplyGitMode changes the mode of an existing regular file to match a git file mode
+func (fm *FileManager) ApplyGitMode(path, gitMode string) error {
+	if gitMode != GitModeRegular && gitMode != GitModeExecutable {
+		return fmt.Errorf("cannot apply git mode %s to %s", gitMode, path)
+	}
+
+	info, err := os.Stat(path)
 	if err != nil {
-		return fmt.Errorf("failed to open state file: %w", err)
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	return os.Chmod(path, permForGitMode(info.Mode().Perm(), gitMode))
+}
+
+// permForGitMode sets or clears the executable bits of perm to match a git file mode.
+// Execute permission is granted to everyone who can read the file.
+func permForGitMode(perm os.FileMode, gitMode string) os.FileMode {
+	if gitMode == GitModeExecutable {
+		return perm | (perm&0444)>>2
+	}
+	return perm &^ 0111
+}
+
+// FileTimes returns the modification and change times of a file on disk
+func (fm *FileManager) FileTimes(path string) (mtime, ctime time.Time, err error) {
+	info, err := fm.statPath(path)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to get file info: %w", err)
+	}
+	return info.ModTime(), fileChangeTime(info), nil
+}
+
+// RestoreModTime sets the modification time of a file and records it as the
+// tracked modification time, so that it isn't mistaken for a local edit
+func (fm *FileManager) RestoreModTime(path string, mtime time.Time) error {
+	// os.Chtimes follows links; the times of a preserved link can't be set
+	if fm.isPreservedSymlink(path) {
+		return nil
 	}
-	defer file.Close()
 
-	// Decode state
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&fm.files); err != nil {
-		return fmt.Errorf("failed to decode state: %w", err)
+	if err := os.Chtimes(path, time.Now(), mtime); err != nil {
+		return fmt.Errorf("failed to restore modification time: %w", err)
+	}
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if fileInfo, err := fm.lookup(path); err == nil {
+		if info, err := fm.statPath(path); err == nil {
+			fileInfo.LastModified = info.ModTime()
+		}
 	}
 
 	return nil
@@ -263,6 +618,12 @@ func (fm *FileManager) CalculateGitSHAFromContent(content []byte) string {
 	return fm.calculateGitSHAFromContent(content)
 }
 
+// CalculateHashFromContent calculates the SHA-256 hash used to track content
+func (fm *FileManager) CalculateHashFromContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
 // calculateGitSHAFromContent calculates Git blob SHA-1 hash from content
 func (fm *FileManager) calculateGitSHAFromContent(content []byte) string {
 	// Git calculates SHA-1 of "blob <size>\0<content>"
@@ -277,6 +638,16 @@ func (fm *FileManager) calculateGitSHAFromContent(content []byte) string {
 
 // calculateFileHash calculates the SHA-256 hash of a file
 func (fm *FileManager) calculateFileHash(path string) (string, error) {
+	// Preserved symlinks are hashed by their target path
+	if fm.isPreservedSymlink(path) {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read symlink: %w", err)
+		}
+		sum := sha256.Sum256([]byte(target))
+		return hex.EncodeToString(sum[:]), nil
+	}
+
 	// Open file
 	file, err := os.Open(path)
 	if err != nil {
@@ -298,8 +669,11 @@ func (fm *FileManager) calculateFileHash(path string) (string, error) {
 
 // GetSyncStatus determines the synchronization status of a file
 func (fm *FileManager) GetSyncStatus(path string) (SyncStatus, error) {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
 	// Get file info
-	fileInfo, err := fm.GetFileInfo(path)
+	fileInfo, err := fm.lookup(path)
 	if err != nil {
 		return SyncStatusSynced, err
 	}
@@ -313,8 +687,13 @@ func (fm *FileManager) GetSyncStatus(path string) (SyncStatus, error) {
 	// Check if file has local changes
 	hasLocalChanges := currentHash != fileInfo.LastSyncedHash
 
-	// Check if file has remote changes
-	hasRemoteChanges := fileInfo.LastSyncedRemoteSHA != "" && fileInfo.LastSyncedRemoteSHA != "sha123"
+	// Check if file has remote changes, as far as the last known remote
+	// state tells
+	hasRemoteChanges := false
+	if fm.remote != nil && fileInfo.LastSyncedRemoteSHA != "" {
+		remoteSHA, exists := fm.remote.SHA(fm.key(path))
+		hasRemoteChanges = !exists || remoteSHA != fileInfo.LastSyncedRemoteSHA
+	}
 
 	// Determine sync status
 	if hasLocalChanges && hasRemoteChanges {
@@ -330,8 +709,11 @@ func (fm *FileManager) GetSyncStatus(path string) (SyncStatus, error) {
 
 // UpdateSyncInfo updates the synchronization information for a file
 func (fm *FileManager) UpdateSyncInfo(path, remoteSHA string) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
 	// Get file info
-	fileInfo, err := fm.GetFileInfo(path)
+	fileInfo, err := fm.lookup(path)
 	if err != nil {
 		return err
 	}
@@ -345,10 +727,52 @@ func (fm *FileManager) UpdateSyncInfo(path, remoteSHA string) error {
 	// Update sync info
 	fileInfo.LastSyncedHash = currentHash
 	fileInfo.LastSyncedRemoteSHA = remoteSHA
+	fileInfo.NeedsAttention = false
+	if info, err := fm.statPath(fileInfo.Path); err == nil {
+		fileInfo.LastSyncedMode = GitModeFromFileMode(info.Mode())
+	}
 
 	return nil
 }
 
+// SetSyncInfo records explicit synchronization information for a file,
+// tracking it if it isn't tracked yet
+func (fm *FileManager) SetSyncInfo(path, hash, remoteSHA, gitMode string) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	key := fm.key(path)
+	fileInfo, exists := fm.files[key]
+	if !exists {
+		fileInfo = &FileInfo{Path: fm.localPath(key), Hash: hash}
+		fm.files[key] = fileInfo
+	}
+
+	fileInfo.LastSyncedHash = hash
+	fileInfo.LastSyncedRemoteSHA = remoteSHA
+	fileInfo.LastSyncedMode = gitMode
+	fileInfo.NeedsAttention = false
+}
+
+// MarkNeedsAttention flags a file whose sync history is unknown and whose
+// content differs from the repository. Its sync info is cleared, so
+// editing it uploads it and deleting it downloads the remote version.
+func (fm *FileManager) MarkNeedsAttention(path string) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fileInfo, exists := fm.files[fm.key(path)]
+	if !exists {
+		return fmt.Errorf("file not tracked: %s", path)
+	}
+
+	fileInfo.LastSyncedHash = ""
+	fileInfo.LastSyncedRemoteSHA = ""
+	fileInfo.LastSyncedMode = ""
+	fileInfo.NeedsAttention = true
+	return nil
+}
+
 // SaveConflictVersions saves both local and remote versions of a file
 func (fm *FileManager) SaveConflictVersions(path, remoteContent string) error {
 	// Get file info
@@ -358,7 +782,7 @@ func (fm *FileManager) SaveConflictVersions(path, remoteContent string) error {
 	}
 
 	// Create backup directory if it doesn't exist
-	backupDir := filepath.Join(fm.baseDir, ".catapult", "conflicts")
+	backupDir := filepath.Join(fm.baseDir, MetadataDir, "conflicts")
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
 		return fmt.Errorf("failed to create backup directory: %w", err)
 	}
@@ -384,7 +808,7 @@ func (fm *FileManager) SaveConflictVersions(path, remoteContent string) error {
 	}
 
 	// Save remote content to backup
-	if err := os.WriteFile(remoteBackup, []byte(remoteContent), 0644); err != nil {
+	if err := fm.WriteFileAtomic(remoteBackup, []byte(remoteContent), GitModeRegular, "", nil); err != nil {
 		return fmt.Errorf("failed to save remote file: %w", err)
 	}
 
@@ -417,12 +841,18 @@ func copyFile(src, dst string) error {
 
 // RemoveFile removes a file from tracking
 func (fm *FileManager) RemoveFile(path string) {
-	delete(fm.files, path)
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	delete(fm.files, fm.key(path))
 }
 
 // RecordSyncError records a sync error for a file
 func (fm *FileManager) RecordSyncError(path string, err error) error {
-	fileInfo, exists := fm.files[path]
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fileInfo, exists := fm.files[fm.key(path)]
 	if !exists {
 		return fmt.Errorf("file not tracked: %s", path)
 	}
@@ -436,7 +866,10 @@ func (fm *FileManager) RecordSyncError(path string, err error) error {
 
 // ClearSyncError clears the sync error for a file (called on successful sync)
 func (fm *FileManager) ClearSyncError(path string) error {
-	fileInfo, exists := fm.files[path]
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fileInfo, exists := fm.files[fm.key(path)]
 	if !exists {
 		return fmt.Errorf("file not tracked: %s", path)
 	}
@@ -450,7 +883,10 @@ func (fm *FileManager) ClearSyncError(path string) error {
 
 // HasSyncError checks if a file has a sync error
 func (fm *FileManager) HasSyncError(path string) bool {
-	fileInfo, exists := fm.files[path]
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	fileInfo, exists := fm.files[fm.key(path)]
 	if !exists {
 		return false
 	}
@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func skipOnWindows(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes and symlinks are not supported on Windows")
+	}
+}
+
+func TestScanDirectory_ExecutableMode(t *testing.T) {
+	skipOnWindows(t)
+
+	tempDir := t.TempDir()
+	script := filepath.Join(tempDir, "run.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "notes.txt"), []byte("notes"), 0644))
+
+	fm := NewFileManager(tempDir)
+	require.NoError(t, fm.ScanDirectory())
+
+	info, err := fm.GetFileInfo(script)
+	require.NoError(t, err)
+	assert.Equal(t, GitModeExecutable, info.GitMode())
+
+	info, err = fm.GetFileInfo(filepath.Join(tempDir, "notes.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, GitModeRegular, info.GitMode())
+}
+
+func TestScanDirectory_SymlinkPolicies(t *testing.T) {
+	skipOnWindows(t)
+
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "target.txt"), []byte("target content"), 0644))
+	require.NoError(t, os.Symlink("target.txt", filepath.Join(tempDir, "link.txt")))
+	// A link back to the base directory must not cause an endless scan
+	require.NoError(t, os.Symlink(".", filepath.Join(tempDir, "loop")))
+
+	t.Run("Preserve", func(t *testing.T) {
+		fm := NewFileManager(tempDir)
+		require.NoError(t, fm.ScanDirectory())
+
+		info, err := fm.GetFileInfo(filepath.Join(tempDir, "link.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, GitModeSymlink, info.GitMode())
+		assert.Equal(t, "target.txt", info.LinkTarget)
+
+		content, err := fm.ReadFileContent(filepath.Join(tempDir, "link.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "target.txt", string(content))
+	})
+
+	t.Run("Skip", func(t *testing.T) {
+		fm := NewFileManager(tempDir)
+		fm.SetSymlinkPolicy(SymlinkSkip)
+		require.NoError(t, fm.ScanDirectory())
+
+		_, err := fm.GetFileInfo(filepath.Join(tempDir, "link.txt"))
+		assert.Error(t, err)
+		assert.Len(t, fm.GetTrackedFiles(), 1)
+	})
+
+	t.Run("Follow", func(t *testing.T) {
+		fm := NewFileManager(tempDir)
+		fm.SetSymlinkPolicy(SymlinkFollow)
+		require.NoError(t, fm.ScanDirectory())
+
+		info, err := fm.GetFileInfo(filepath.Join(tempDir, "link.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, GitModeRegular, info.GitMode())
+
+		content, err := fm.ReadFileContent(filepath.Join(tempDir, "link.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "target content", string(content))
+	})
+}
+
+func TestWriteFileContent_RestoresModes(t *testing.T) {
+	skipOnWindows(t)
+
+	tempDir := t.TempDir()
+	fm := NewFileManager(tempDir)
+
+	script := filepath.Join(tempDir, "bin", "run.sh")
+	require.NoError(t, fm.WriteFileContent(script, []byte("#!/bin/sh\n"), GitModeExecutable))
+	info, err := os.Stat(script)
+	require.NoError(t, err)
+	assert.Equal(t, GitModeExecutable, GitModeFromFileMode(info.Mode()))
+
+	link := filepath.Join(tempDir, "bin", "current")
+	require.NoError(t, fm.WriteFileContent(link, []byte("run.sh"), GitModeSymlink))
+	target, err := os.Readlink(link)
+	require.NoError(t, err)
+	assert.Equal(t, "run.sh", target)
+
+	// Replacing a link with a regular file must not write through the link
+	require.NoError(t, fm.WriteFileContent(link, []byte("plain"), GitModeRegular))
+	linkInfo, err := os.Lstat(link)
+	require.NoError(t, err)
+	assert.Zero(t, linkInfo.Mode()&os.ModeSymlink)
+
+	content, err := os.ReadFile(script)
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\n", string(content))
+}
+
+func TestHasChanges_RestoredModTime(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "notes.txt")
+	require.NoError(t, os.WriteFile(path, []byte("original"), 0644))
+
+	fm := NewFileManager(tempDir)
+	require.NoError(t, fm.ScanDirectory())
+
+	// Restoring an older mtime is not an edit
+	older := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	require.NoError(t, fm.RestoreModTime(path, older))
+	changed, err := fm.HasChanges(path)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// An edit that ends up with an older mtime is still detected
+	require.NoError(t, os.WriteFile(path, []byte("modified"), 0644))
+	require.NoError(t, os.Chtimes(path, older, older.Add(-time.Hour)))
+	changed, err = fm.HasChanges(path)
+	require.NoError(t, err)
+	assert.True(t, changed)
+}
+
+func TestScanDirectory_StatCache(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "large.bin")
+	require.NoError(t, os.WriteFile(path, []byte("content"), 0644))
+
+	// Files modified within the racy window are always hashed
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(path, old, old))
+
+	fm := NewFileManager(tempDir)
+	require.NoError(t, fm.ScanDirectory())
+	// GetFileInfo returns a copy, so look at the tracked entry itself
+	info, err := fm.lookup(path)
+	require.NoError(t, err)
+	hash := info.Hash
+
+	// Mark the recorded hash to see whether it is recalculated
+	info.Hash = "cached"
+
+	t.Run("Unchanged", func(t *testing.T) {
+		require.NoError(t, fm.ScanDirectory())
+		assert.Equal(t, "cached", info.Hash)
+	})
+
+	t.Run("Rehash", func(t *testing.T) {
+		fm.RehashAll()
+		require.NoError(t, fm.ScanDirectory())
+		assert.Equal(t, hash, info.Hash)
+
+		// Only the next scan is forced
+		info.Hash = "cached"
+		require.NoError(t, fm.ScanDirectory())
+		assert.Equal(t, "cached", info.Hash)
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("changed content"), 0644))
+		require.NoError(t, fm.ScanDirectory())
+		assert.Equal(t, fm.CalculateHashFromContent([]byte("changed content")), info.Hash)
+	})
+}
+
+func TestRescanFile(t *testing.T) {
+	tempDir := t.TempDir()
+	kept := filepath.Join(tempDir, "kept.txt")
+	removed := filepath.Join(tempDir, "removed.txt")
+	require.NoError(t, os.WriteFile(kept, []byte("kept"), 0644))
+	require.NoError(t, os.WriteFile(removed, []byte("removed"), 0644))
+
+	fm := NewFileManager(tempDir)
+	require.NoError(t, fm.ScanDirectory())
+
+	// A new file is tracked without touching the others
+	added := filepath.Join(tempDir, "notes", "added.txt")
+	require.NoError(t, os.MkdirAll(filepath.Dir(added), 0755))
+	require.NoError(t, os.WriteFile(added, []byte("added"), 0644))
+	require.NoError(t, os.Remove(removed))
+	require.NoError(t, fm.RescanFile(added))
+
+	info, err := fm.GetFileInfo(added)
+	require.NoError(t, err)
+	assert.Equal(t, fm.CalculateHashFromContent([]byte("added")), info.Hash)
+	info, err = fm.GetFileInfo(removed)
+	require.NoError(t, err)
+	assert.False(t, info.Deleted)
+
+	// A removed file is marked as deleted
+	require.NoError(t, fm.RescanFile(removed))
+	info, err = fm.GetFileInfo(removed)
+	require.NoError(t, err)
+	assert.True(t, info.Deleted)
+
+	// A removed directory marks every file below it as deleted
+	require.NoError(t, os.RemoveAll(filepath.Dir(added)))
+	require.NoError(t, fm.RescanFile(filepath.Dir(added)))
+	info, err = fm.GetFileInfo(added)
+	require.NoError(t, err)
+	assert.True(t, info.Deleted)
+
+	// Catapult's own files are never tracked
+	conflict := filepath.Join(tempDir, MetadataDir, "conflicts", "kept.txt")
+	require.NoError(t, os.MkdirAll(filepath.Dir(conflict), 0755))
+	require.NoError(t, os.WriteFile(conflict, []byte("conflict"), 0644))
+	require.NoError(t, fm.RescanFile(conflict))
+	assert.Len(t, fm.Files(), 3)
+
+	assert.Error(t, fm.RescanFile(filepath.Join(t.TempDir(), "outside.txt")))
+}
+
+func TestFileManager_ConcurrentUse(t *testing.T) {
+	tempDir := t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	path := filepath.Join(tempDir, "file.txt")
+	require.NoError(t, os.WriteFile(path, []byte("content"), 0644))
+
+	fm := NewFileManager(tempDir)
+	require.NoError(t, fm.ScanDirectory())
+	fm.SetRemoteManifest(NewRemoteManifest("head", nil))
+
+	// Run with -race to catch unguarded access
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, fm.ScanDirectory())
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, fm.UpdateSyncInfo(path, "sha"))
+			fm.RemoteManifest().Set("file.txt", "sha")
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := fm.GetSyncStatus(path)
+			assert.NoError(t, err)
+			assert.Len(t, fm.Files(), 1)
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, fm.SaveState(statePath))
+			assert.NoError(t, fm.LoadState(statePath))
+		}()
+	}
+	wg.Wait()
+}
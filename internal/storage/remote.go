@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RemoteManifestFile is the name of the cached remote tree, kept next to
+// the state file
+const RemoteManifestFile = "remote.json"
+
+// RemoteManifest is the last known state of the repository, so the status
+// of files can be shown without network access. Its methods are safe for
+// concurrent use.
+type RemoteManifest struct {
+	CommitSHA string            `json:"commit_sha,omitempty"`
+	FetchedAt time.Time         `json:"fetched_at"`
+	Files     map[string]string `json:"files"` // Slash-separated relative path to blob SHA
+
+	mu sync.Mutex
+}
+
+// NewRemoteManifest creates a manifest fetched now from blob SHAs keyed by
+// relative path
+func NewRemoteManifest(commitSHA string, shas map[string]string) *RemoteManifest {
+	files := make(map[string]string, len(shas))
+	for relPath, sha := range shas {
+		files[filepath.ToSlash(relPath)] = sha
+	}
+	return &RemoteManifest{CommitSHA: commitSHA, FetchedAt: time.Now(), Files: files}
+}
+
+// RemoteManifestPath returns the path of the manifest kept next to a state file
+func RemoteManifestPath(statePath string) string {
+	return filepath.Join(filepath.Dir(statePath), RemoteManifestFile)
+}
+
+// LoadRemoteManifest reads the manifest at path
+func LoadRemoteManifest(path string) (*RemoteManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote manifest: %w", err)
+	}
+
+	var manifest RemoteManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse remote manifest: %w", err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]string)
+	}
+	return &manifest, nil
+}
+
+// Save atomically writes the manifest to path
+func (m *RemoteManifest) Save(path string) error {
+	m.mu.Lock()
+	data, err := json.Marshal(m)
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode remote manifest: %w", err)
+	}
+	if err := writeFileAtomic(path, data, false); err != nil {
+		return fmt.Errorf("failed to save remote manifest: %w", err)
+	}
+	return nil
+}
+
+// Head returns the commit the manifest describes
+func (m *RemoteManifest) Head() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.CommitSHA
+}
+
+// SetHead records the commit the manifest describes
+func (m *RemoteManifest) SetHead(commitSHA string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.CommitSHA = commitSHA
+}
+
+// SHA returns the blob SHA of a file by relative path, if it exists remotely
+func (m *RemoteManifest) SHA(relPath string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sha, ok := m.Files[filepath.ToSlash(relPath)]
+	return sha, ok
+}
+
+// Set records the blob SHA of a file changed by this device
+func (m *RemoteManifest) Set(relPath, sha string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Files[filepath.ToSlash(relPath)] = sha
+}
+
+// Remove records a file deleted by this device
+func (m *RemoteManifest) Remove(relPath string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.Files, filepath.ToSlash(relPath))
+}
+
+// SetRemoteManifest records the last known state of the repository
+func (fm *FileManager) SetRemoteManifest(manifest *RemoteManifest) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fm.remote = manifest
+}
+
+// RemoteManifest returns the last known state of the repository, or nil if
+// it was never fetched
+func (fm *FileManager) RemoteManifest() *RemoteManifest {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	return fm.remote
+}
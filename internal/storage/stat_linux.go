@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileChangeTime returns the inode change time (ctime) of a file
+func fileChangeTime(info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Ctim.Unix())
+	}
+	return time.Time{}
+}
+
+// fileInode returns the inode number of a file
+func fileInode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
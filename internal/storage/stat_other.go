@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+
+package storage
+
+import (
+	"os"
+	"time"
+)
+
+// fileChangeTime returns the zero time on platforms without a portable ctime
+func fileChangeTime(info os.FileInfo) time.Time {
+	return time.Time{}
+}
+
+// fileInode returns zero on platforms without inode numbers
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
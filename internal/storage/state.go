@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// BackupSuffix is appended to the state file path to name the previous
+// generation kept by SaveState
+const BackupSuffix = ".bak"
+
+// StateVersion is the current schema version of the state file
+const StateVersion = 2
+
+// stateMigrations upgrade the raw state file from one schema version to the
+// next: stateMigrations[n] turns version n into version n+1. There is one
+// migration per version below StateVersion. baseDir is the sync directory
+// the state belongs to.
+var stateMigrations = []func(data []byte, baseDir string) ([]byte, error){
+	migrateStateV0,
+	migrateStateV1,
+}
+
+// stateFile is the on-disk layout of the state. Since version 2, files are
+// keyed by their slash-separated path relative to the base directory, and
+// FileInfo.Path holds the same relative path.
+type stateFile struct {
+	Version int                  `json:"version"`
+	Files   map[string]*FileInfo `json:"files"`
+}
+
+// CorruptStateError reports a state file that can't be read
+type CorruptStateError struct {
+	Path string
+	Err  error
+
+	// BackupPath is set when the previous generation is intact
+	BackupPath string
+}
+
+func (e *CorruptStateError) Error() string {
+	return fmt.Sprintf("state file '%s' is corrupt: %v", e.Path, e.Err)
+}
+
+func (e *CorruptStateError) Unwrap() error {
+	return e.Err
+}
+
+// SaveState atomically replaces the state file. The state is written to a
+// temp file and fsynced before it is renamed into place, and the previous
+// state is kept next to it as a backup generation.
+func (fm *FileManager) SaveState(path string) error {
+	fm.mu.RLock()
+	files := make(map[string]*FileInfo, len(fm.files))
+	for key, info := range fm.files {
+		stored := *info
+		stored.Path = key
+		files[key] = &stored
+	}
+	remote := fm.remote
+	fm.mu.RUnlock()
+
+	data, err := json.Marshal(stateFile{Version: StateVersion, Files: files})
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if err := writeStateFile(path, data); err != nil {
+		return err
+	}
+
+	// Keep the last known remote state for offline status
+	if remote != nil {
+		return remote.Save(RemoteManifestPath(path))
+	}
+	return nil
+}
+
+// LoadState loads the state from a file, upgrading older schema versions.
+// If the state file is missing because a save was interrupted, the backup
+// generation is loaded instead.
+func (fm *FileManager) LoadState(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if backup, backupErr := os.ReadFile(path + BackupSuffix); backupErr == nil {
+			data, err = backup, nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open state file: %w", err)
+	}
+
+	state, _, err := decodeState(data, fm.absBaseDir)
+	if err != nil {
+		var versionErr *StateVersionError
+		if errors.As(err, &versionErr) {
+			versionErr.Path = path
+			return versionErr
+		}
+
+		corruptErr := &CorruptStateError{Path: path, Err: err}
+		if backup, backupErr := os.ReadFile(path + BackupSuffix); backupErr == nil {
+			if _, _, err := decodeState(backup, fm.absBaseDir); err == nil {
+				corruptErr.BackupPath = path + BackupSuffix
+			}
+		}
+		return corruptErr
+	}
+
+	files := make(map[string]*FileInfo, len(state.Files))
+	for key, info := range state.Files {
+		if !validStateKey(key) {
+			continue
+		}
+		info.Path = fm.localPath(key)
+		files[key] = info
+	}
+
+	// The remote manifest is only a cache; without it status needs the network
+	remote, _ := LoadRemoteManifest(RemoteManifestPath(path))
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fm.files = files
+	fm.remote = remote
+	return nil
+}
+
+// StateVersionError reports a state file written by a newer catapult
+type StateVersionError struct {
+	Path    string
+	Version int
+}
+
+func (e *StateVersionError) Error() string {
+	return fmt.Sprintf("state file '%s' uses schema version %d, but this catapult supports up to %d; please upgrade catapult", e.Path, e.Version, StateVersion)
+}
+
+// MigrateState upgrades the state file of the sync directory baseDir to the
+// current schema version. The original file is kept next to it, suffixed
+// with its version.
+func MigrateState(path, baseDir string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		// No state to migrate
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	version, err := stateVersion(data)
+	if err != nil {
+		return &CorruptStateError{Path: path, Err: err}
+	}
+	if version == StateVersion {
+		return nil
+	}
+
+	absBaseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	migrated, _, err := decodeState(data, absBaseDir)
+	if err != nil {
+		var versionErr *StateVersionError
+		if errors.As(err, &versionErr) {
+			versionErr.Path = path
+			return versionErr
+		}
+		return &CorruptStateError{Path: path, Err: err}
+	}
+
+	migrated.Version = StateVersion
+
+	backupPath := fmt.Sprintf("%s.v%d%s", path, version, BackupSuffix)
+	if err := os.WriteFile(backupPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to back up state before migration: %w", err)
+	}
+
+	encoded, err := json.Marshal(migrated)
+	if err != nil {
+		return fmt.Errorf("failed to encode migrated state: %w", err)
+	}
+	if err := writeStateFile(path, encoded); err != nil {
+		return fmt.Errorf("failed to save migrated state: %w", err)
+	}
+
+	fmt.Printf("Migrated state from version %d to %d (previous state kept in %s)\n", version, StateVersion, backupPath)
+	return nil
+}
+
+// decodeState parses a state file of any supported version, returning the
+// state upgraded to the current version and the version it was stored in
+func decodeState(data []byte, baseDir string) (*stateFile, int, error) {
+	version, err := stateVersion(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version > StateVersion {
+		return nil, version, &StateVersionError{Version: version}
+	}
+
+	upgraded := data
+	for v := version; v < StateVersion; v++ {
+		upgraded, err = stateMigrations[v](upgraded, baseDir)
+		if err != nil {
+			return nil, version, fmt.Errorf("failed to migrate state from version %d: %w", v, err)
+		}
+	}
+
+	var state stateFile
+	if err := json.Unmarshal(upgraded, &state); err != nil {
+		return nil, version, err
+	}
+	return &state, version, nil
+}
+
+// stateVersion detects the schema version of a state file. Version 0 is the
+// original unversioned map of files.
+func stateVersion(data []byte) (int, error) {
+	var header map[string]json.RawMessage
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, err
+	}
+
+	raw, ok := header["version"]
+	if !ok {
+		return 0, nil
+	}
+	var version int
+	if err := json.Unmarshal(raw, &version); err != nil {
+		return 0, fmt.Errorf("invalid version: %w", err)
+	}
+	return version, nil
+}
+
+// migrateStateV0 wraps the unversioned map of files in a versioned document
+func migrateStateV0(data []byte, baseDir string) ([]byte, error) {
+	var files map[string]*FileInfo
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, err
+	}
+	return json.Marshal(stateFile{Version: 1, Files: files})
+}
+
+// migrateStateV1 rekeys files from absolute paths to paths relative to the
+// base directory. Files outside of it can't be matched and are dropped, so
+// they are picked up as new files by the next scan.
+func migrateStateV1(data []byte, baseDir string) ([]byte, error) {
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*FileInfo, len(state.Files))
+	for path, info := range state.Files {
+		relPath, err := filepath.Rel(baseDir, path)
+		if err != nil || !validStateKey(filepath.ToSlash(relPath)) {
+			continue
+		}
+		key := filepath.ToSlash(relPath)
+		info.Path = key
+		files[key] = info
+	}
+	return json.Marshal(stateFile{Version: 2, Files: files})
+}
+
+// validStateKey reports whether key is a relative path inside the base directory
+func validStateKey(key string) bool {
+	return key != "" && key != "." && !path.IsAbs(key) && !filepath.IsAbs(key) &&
+		key != ".." && !strings.HasPrefix(key, "../")
+}
+
+// writeStateFile atomically writes data to path, keeping the previous file as backup
+func writeStateFile(path string, data []byte) error {
+	return writeFileAtomic(path, data, true)
+}
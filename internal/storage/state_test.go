@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveState(t *testing.T) {
+	tempDir := t.TempDir()
+	statePath := filepath.Join(tempDir, "state.json")
+
+	fm := NewFileManager(tempDir)
+	fm.SetSyncInfo(filepath.Join(tempDir, "a.txt"), "hash-a", "sha-a", GitModeRegular)
+	require.NoError(t, fm.SaveState(statePath))
+
+	fm.SetSyncInfo(filepath.Join(tempDir, "b.txt"), "hash-b", "sha-b", GitModeRegular)
+	require.NoError(t, fm.SaveState(statePath))
+
+	// The state is versioned
+	data, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	var state stateFile
+	require.NoError(t, json.Unmarshal(data, &state))
+	assert.Equal(t, StateVersion, state.Version)
+	assert.Len(t, state.Files, 2)
+
+	// The previous generation is kept
+	loaded := NewFileManager(tempDir)
+	require.NoError(t, loaded.LoadState(statePath+BackupSuffix))
+	assert.Len(t, loaded.files, 1)
+
+	// No temp files are left behind
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	t.Run("InterruptedSave", func(t *testing.T) {
+		// A crash between moving the old state aside and moving the new one
+		// into place leaves only the backup
+		require.NoError(t, os.Rename(statePath, statePath+BackupSuffix))
+
+		loaded := NewFileManager(tempDir)
+		require.NoError(t, loaded.LoadState(statePath))
+		assert.Len(t, loaded.files, 2)
+	})
+}
+
+func TestLoadState_Corrupt(t *testing.T) {
+	tempDir := t.TempDir()
+	statePath := filepath.Join(tempDir, "state.json")
+
+	require.NoError(t, os.WriteFile(statePath, []byte(`{"version":1,"files":{"/a`), 0600))
+	err := NewFileManager(tempDir).LoadState(statePath)
+	var corruptErr *CorruptStateError
+	require.True(t, errors.As(err, &corruptErr))
+	assert.Empty(t, corruptErr.BackupPath)
+
+	// An intact backup generation is offered for recovery
+	require.NoError(t, NewFileManager(tempDir).SaveState(statePath+BackupSuffix))
+	err = NewFileManager(tempDir).LoadState(statePath)
+	require.True(t, errors.As(err, &corruptErr))
+	assert.Equal(t, statePath+BackupSuffix, corruptErr.BackupPath)
+}
+
+func TestLoadState_NewerVersion(t *testing.T) {
+	tempDir := t.TempDir()
+	statePath := filepath.Join(tempDir, "state.json")
+	require.NoError(t, os.WriteFile(statePath, []byte(`{"version":99,"files":{}}`), 0600))
+
+	err := NewFileManager(tempDir).LoadState(statePath)
+	var versionErr *StateVersionError
+	require.True(t, errors.As(err, &versionErr))
+	assert.Equal(t, 99, versionErr.Version)
+}
+
+func TestMigrateState(t *testing.T) {
+	assert.Len(t, stateMigrations, StateVersion, "every older version needs a migration")
+
+	tempDir := t.TempDir()
+	statePath := filepath.Join(tempDir, "state.json")
+	path := filepath.Join(tempDir, "a.txt")
+
+	// The original format is an unversioned map of files
+	legacyData, err := json.Marshal(map[string]*FileInfo{
+		path: {Path: path, Hash: "h", LastSyncedHash: "h", LastSyncedRemoteSHA: "sha"},
+	})
+	require.NoError(t, err)
+	legacy := string(legacyData)
+	require.NoError(t, os.WriteFile(statePath, []byte(legacy), 0600))
+
+	// Old state loads as is
+	fm := NewFileManager(tempDir)
+	require.NoError(t, fm.LoadState(statePath))
+	info, err := fm.GetFileInfo(path)
+	require.NoError(t, err)
+	assert.Equal(t, "sha", info.LastSyncedRemoteSHA)
+
+	// and is upgraded on disk, keeping the original
+	require.NoError(t, MigrateState(statePath, tempDir))
+	version, err := readStateVersion(statePath)
+	require.NoError(t, err)
+	assert.Equal(t, StateVersion, version)
+
+	// Files are keyed relative to the base directory
+	data, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	var state stateFile
+	require.NoError(t, json.Unmarshal(data, &state))
+	require.Contains(t, state.Files, "a.txt")
+	assert.Equal(t, "sha", state.Files["a.txt"].LastSyncedRemoteSHA)
+
+	original, err := os.ReadFile(statePath + ".v0" + BackupSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, legacy, string(original))
+
+	// Migrating again is a no-op
+	migrated, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	require.NoError(t, MigrateState(statePath, tempDir))
+	again, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	assert.Equal(t, migrated, again)
+}
+
+func TestLoadState_RelocatedBaseDir(t *testing.T) {
+	stateDir := t.TempDir()
+	statePath := filepath.Join(stateDir, "state.json")
+	oldDir := filepath.Join(t.TempDir(), "files")
+	newDir := filepath.Join(t.TempDir(), "moved")
+
+	fm := NewFileManager(oldDir)
+	fm.SetSyncInfo(filepath.Join(oldDir, "docs", "a.txt"), "hash-a", "sha-a", GitModeRegular)
+	require.NoError(t, fm.SaveState(statePath))
+
+	// Keys don't depend on where the base directory is
+	data, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	var state stateFile
+	require.NoError(t, json.Unmarshal(data, &state))
+	require.Contains(t, state.Files, "docs/a.txt")
+	assert.Equal(t, "docs/a.txt", state.Files["docs/a.txt"].Path)
+
+	// so the state follows the base directory to its new location
+	relocated := NewFileManager(newDir)
+	require.NoError(t, relocated.LoadState(statePath))
+	info, err := relocated.GetFileInfo(filepath.Join(newDir, "docs", "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(newDir, "docs", "a.txt"), info.Path)
+	assert.Equal(t, "sha-a", info.LastSyncedRemoteSHA)
+}
+
+// readStateVersion returns the schema version of the state file at path
+func readStateVersion(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return stateVersion(data)
+}
+
+func TestSaveState_RemoteManifest(t *testing.T) {
+	tempDir := t.TempDir()
+	statePath := filepath.Join(tempDir, "state.json")
+
+	fm := NewFileManager(tempDir)
+	fm.SetRemoteManifest(NewRemoteManifest("head", map[string]string{filepath.Join("docs", "a.txt"): "sha-a"}))
+	require.NoError(t, fm.SaveState(statePath))
+
+	loaded := NewFileManager(tempDir)
+	require.NoError(t, loaded.LoadState(statePath))
+	manifest := loaded.RemoteManifest()
+	require.NotNil(t, manifest)
+	assert.Equal(t, "head", manifest.CommitSHA)
+	assert.Equal(t, map[string]string{"docs/a.txt": "sha-a"}, manifest.Files)
+
+	// The manifest is only a cache: a broken one is ignored
+	require.NoError(t, os.WriteFile(RemoteManifestPath(statePath), []byte("{"), 0600))
+	loaded = NewFileManager(tempDir)
+	require.NoError(t, loaded.LoadState(statePath))
+	assert.Nil(t, loaded.RemoteManifest())
+}
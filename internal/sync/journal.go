@@ -0,0 +1,331 @@
+package sync
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/itcaat/catapult/internal/repository"
+	"github.com/itcaat/catapult/internal/storage"
+)
+
+// JournalSuffix is appended to the state file path to name its journal
+const JournalSuffix = ".journal"
+
+// Journal phases
+const (
+	JournalPlanned = "planned"
+	JournalDone    = "done"
+)
+
+// Journal actions
+const (
+	ActionUpload   = "upload"
+	ActionDownload = "download"
+	ActionDelete   = "delete"
+)
+
+// JournalEntry is a single record of the sync journal. A planned entry holds
+// the sync info the file will have once the action succeeded; a done entry
+// holds the sync info it actually has.
+type JournalEntry struct {
+	Seq       int64  `json:"seq"`
+	Phase     string `json:"phase"`
+	Action    string `json:"action"`
+	Path      string `json:"path"`
+	Hash      string `json:"hash,omitempty"`
+	RemoteSHA string `json:"remote_sha,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+	Removed   bool   `json:"removed,omitempty"`
+}
+
+// Journal is a write-ahead log of sync actions kept next to the state file.
+// Every action is recorded before it touches the remote or the disk and again
+// once it completed, so a sync interrupted at any point can be resumed
+// without redoing or losing work.
+type Journal struct {
+	path string
+	seq  int64
+}
+
+// NewJournal creates a journal stored at path
+func NewJournal(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Path returns the location of the journal file
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Append durably records an entry
+func (j *Journal) Append(entry JournalEntry) error {
+	j.seq++
+	entry.Seq = j.seq
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to flush journal: %w", err)
+	}
+	return nil
+}
+
+// Entries reads all recorded entries in order. A torn last line, left by a
+// crash in the middle of a write, is ignored.
+func (j *Journal) Entries() ([]JournalEntry, error) {
+	file, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+
+	var entries []JournalEntry
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// Anything without a trailing newline was never fully written
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal: %w", err)
+		}
+
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("journal %s is corrupt: %w", j.path, err)
+		}
+		entries = append(entries, entry)
+		if entry.Seq > j.seq {
+			j.seq = entry.Seq
+		}
+	}
+	return entries, nil
+}
+
+// Reset discards all entries and records planned again, for actions that are
+// still unresolved after a checkpoint
+func (j *Journal) Reset(planned []JournalEntry) error {
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear journal: %w", err)
+	}
+	storage.SyncDir(filepath.Dir(j.path))
+
+	j.seq = 0
+	for _, entry := range planned {
+		if err := j.Append(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pendingActions replays journal entries: completed actions are returned in
+// order as done, actions planned without completing are returned by path
+func pendingActions(entries []JournalEntry) (done []JournalEntry, inFlight map[string]JournalEntry) {
+	inFlight = make(map[string]JournalEntry)
+	for _, entry := range entries {
+		switch entry.Phase {
+		case JournalPlanned:
+			inFlight[entry.Path] = entry
+		case JournalDone:
+			delete(inFlight, entry.Path)
+			done = append(done, entry)
+		}
+	}
+	return done, inFlight
+}
+
+// SetJournal enables write-ahead journaling of sync actions. The state is
+// checkpointed to statePath whenever the journal is cleared.
+func (s *Syncer) SetJournal(journal *Journal, statePath string) {
+	s.journal = journal
+	s.statePath = statePath
+	s.planned = make(map[string]JournalEntry)
+}
+
+// recoverJournal applies the actions of an interrupted sync to the state.
+// Completed actions are replayed; actions that may or may not have reached
+// the remote or the disk are checked against both.
+func (s *Syncer) recoverJournal(out io.Writer, remoteFiles map[string]*repository.RemoteFileInfo) error {
+	s.inFlight = make(map[string]JournalEntry)
+	if s.journal == nil {
+		return nil
+	}
+
+	entries, err := s.journal.Entries()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		// Drop a torn entry so new ones aren't appended to it
+		return s.journal.Reset(nil)
+	}
+
+	done, inFlight := pendingActions(entries)
+	for _, entry := range done {
+		s.applyJournalEntry(entry)
+	}
+
+	for _, relPath := range sortedJournalPaths(inFlight) {
+		entry := inFlight[relPath]
+		if s.actionCompleted(entry, remoteFiles[relPath]) {
+			s.applyJournalEntry(entry)
+		} else {
+			s.inFlight[relPath] = entry
+		}
+	}
+
+	if recovered := len(done) + len(inFlight) - len(s.inFlight); recovered > 0 {
+		fmt.Fprintf(out, "♻️  Resuming interrupted sync (%d actions recovered)\n", recovered)
+	}
+
+	return s.checkpoint()
+}
+
+// actionCompleted reports whether an action that was planned but not
+// recorded as done actually took effect
+func (s *Syncer) actionCompleted(entry JournalEntry, remoteFile *repository.RemoteFileInfo) bool {
+	localPath := filepath.Join(s.fileManager.BaseDir(), entry.Path)
+
+	switch entry.Action {
+	case ActionUpload:
+		return remoteFile != nil && remoteFile.SHA == entry.RemoteSHA &&
+			(entry.Mode == "" || remoteFile.Mode == "" || remoteFile.Mode == entry.Mode)
+	case ActionDownload:
+		content, err := s.fileManager.ReadFileContent(localPath)
+		if err != nil || s.fileManager.CalculateGitSHAFromContent(content) != entry.RemoteSHA {
+			return false
+		}
+		mode, err := s.fileManager.LocalGitMode(localPath)
+		return err == nil && (entry.Mode == "" || mode == entry.Mode)
+	case ActionDelete:
+		return remoteFile == nil
+	}
+	return false
+}
+
+// applyJournalEntry sets the sync info of a file as recorded in the journal
+func (s *Syncer) applyJournalEntry(entry JournalEntry) {
+	localPath := filepath.Join(s.fileManager.BaseDir(), entry.Path)
+	if entry.Removed || entry.Action == ActionDelete {
+		s.fileManager.RemoveFile(localPath)
+		return
+	}
+	s.fileManager.SetSyncInfo(localPath, entry.Hash, entry.RemoteSHA, entry.Mode)
+}
+
+// planAction records an action before it is carried out
+func (s *Syncer) planAction(action, relPath string, content []byte, remoteSHA, mode string) error {
+	if s.journal == nil {
+		return nil
+	}
+
+	entry := JournalEntry{
+		Phase:     JournalPlanned,
+		Action:    action,
+		Path:      relPath,
+		RemoteSHA: remoteSHA,
+		Mode:      mode,
+	}
+	if action != ActionDelete {
+		entry.Hash = s.fileManager.CalculateHashFromContent(content)
+	}
+
+	if err := s.journal.Append(entry); err != nil {
+		return err
+	}
+	s.planned[relPath] = entry
+	return nil
+}
+
+// completeAction records the sync info a file ended up with after a planned
+// action succeeded
+func (s *Syncer) completeAction(relPath, localPath string) error {
+	planned, ok := s.planned[relPath]
+	if !ok {
+		return nil
+	}
+	delete(s.planned, relPath)
+
+	entry := JournalEntry{
+		Phase:  JournalDone,
+		Action: planned.Action,
+		Path:   relPath,
+	}
+	if info, err := s.fileManager.GetFileInfo(localPath); err == nil {
+		entry.Hash = info.LastSyncedHash
+		entry.RemoteSHA = info.LastSyncedRemoteSHA
+		entry.Mode = info.LastSyncedMode
+	} else {
+		entry.Removed = true
+	}
+
+	return s.journal.Append(entry)
+}
+
+// abandonAction forgets the actions of a file whose sync failed. The error
+// means they didn't take effect, and if one did anyway, the next sync of the
+// file finds the remote and local content in agreement.
+func (s *Syncer) abandonAction(relPath string) {
+	delete(s.planned, relPath)
+	delete(s.inFlight, relPath)
+}
+
+// checkpoint saves the state and clears the journal, keeping only actions
+// whose outcome is still unknown
+func (s *Syncer) checkpoint() error {
+	if s.journal == nil {
+		return nil
+	}
+
+	if s.statePath != "" {
+		if err := s.fileManager.SaveState(s.statePath); err != nil {
+			return fmt.Errorf("failed to save state: %w", err)
+		}
+	}
+
+	unresolved := make(map[string]JournalEntry, len(s.inFlight)+len(s.planned))
+	for relPath, entry := range s.inFlight {
+		unresolved[relPath] = entry
+	}
+	for relPath, entry := range s.planned {
+		unresolved[relPath] = entry
+	}
+
+	var keep []JournalEntry
+	for _, relPath := range sortedJournalPaths(unresolved) {
+		keep = append(keep, unresolved[relPath])
+	}
+	return s.journal.Reset(keep)
+}
+
+// sortedJournalPaths returns the paths of entries in a stable order
+func sortedJournalPaths(entries map[string]JournalEntry) []string {
+	paths := make([]string, 0, len(entries))
+	for relPath := range entries {
+		paths = append(paths, relPath)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,352 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itcaat/catapult/internal/repository"
+	"github.com/itcaat/catapult/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errSimulatedCrash is raised by faultyRepository to kill a sync midway
+var errSimulatedCrash = errors.New("simulated crash")
+
+// errRejected is returned by faultyRepository for changes to a failing path
+var errRejected = errors.New("change rejected")
+
+// faultyRepository is an in-memory repository that crashes the process on
+// its Nth mutating call, either before or after the change is applied, and
+// rejects changes to its failing path
+type faultyRepository struct {
+	files      map[string]*repository.RemoteFileInfo
+	mutations  []string
+	crashAt    int
+	afterward  bool
+	failing    string
+	head       func() string // Head commit, by default counting mutations
+	made       []repository.Commit
+	interleave func() // Run once after the next commit, as another device would
+}
+
+func newFaultyRepository() *faultyRepository {
+	return &faultyRepository{files: make(map[string]*repository.RemoteFileInfo)}
+}
+
+// mutate applies a change, crashing around it when the fault is due
+func (r *faultyRepository) mutate(op, path string, apply func()) error {
+	if path == r.failing {
+		return errRejected
+	}
+	parent := r.headSHA()
+	r.mutations = append(r.mutations, op+" "+path)
+	crash := len(r.mutations) == r.crashAt
+	if crash {
+		// A restarted process doesn't crash again
+		r.crashAt = 0
+	}
+
+	if crash && !r.afterward {
+		panic(errSimulatedCrash)
+	}
+	apply()
+	r.made = append(r.made, repository.Commit{SHA: r.headSHA(), Parent: parent})
+	if crash {
+		panic(errSimulatedCrash)
+	}
+	if interleave := r.interleave; interleave != nil {
+		r.interleave = nil
+		interleave()
+	}
+	return nil
+}
+
+// headSHA names the head commit
+func (r *faultyRepository) headSHA() string {
+	if r.head != nil {
+		return r.head()
+	}
+	return fmt.Sprintf("commit-%d", len(r.mutations))
+}
+
+func (r *faultyRepository) put(path, content, mode string) {
+	r.files[path] = &repository.RemoteFileInfo{
+		Path:    path,
+		Content: content,
+		SHA:     storage.NewFileManager("").CalculateGitSHAFromContent([]byte(content)),
+		Size:    len(content),
+		Mode:    mode,
+	}
+}
+
+func (r *faultyRepository) EnsureExists(ctx context.Context) error { return nil }
+
+func (r *faultyRepository) GetDefaultBranch(ctx context.Context) (string, error) { return "main", nil }
+
+func (r *faultyRepository) CreateFile(ctx context.Context, path, content string) error {
+	return r.mutate("create", path, func() { r.put(path, content, storage.GitModeRegular) })
+}
+
+func (r *faultyRepository) GetFile(ctx context.Context, path string) (string, error) {
+	file, ok := r.files[path]
+	if !ok {
+		return "", fmt.Errorf("file not found: %s", path)
+	}
+	return file.Content, nil
+}
+
+func (r *faultyRepository) UpdateFile(ctx context.Context, path, content string) error {
+	return r.mutate("update", path, func() { r.put(path, content, storage.GitModeRegular) })
+}
+
+func (r *faultyRepository) PutFile(ctx context.Context, path, content, mode string) error {
+	return r.mutate("put", path, func() { r.put(path, content, mode) })
+}
+
+func (r *faultyRepository) MoveFile(ctx context.Context, oldPath, newPath, content, mode string) error {
+	return r.mutate("move", newPath, func() {
+		delete(r.files, oldPath)
+		r.put(newPath, content, mode)
+	})
+}
+
+func (r *faultyRepository) DeleteFile(ctx context.Context, path string) error {
+	return r.mutate("delete", path, func() { delete(r.files, path) })
+}
+
+func (r *faultyRepository) FileExists(ctx context.Context, path string) (bool, error) {
+	_, ok := r.files[path]
+	return ok, nil
+}
+
+func (r *faultyRepository) ListFiles(ctx context.Context) ([]string, error) {
+	var paths []string
+	for path := range r.files {
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func (r *faultyRepository) GetAllFilesWithContent(ctx context.Context) (map[string]*repository.RemoteFileInfo, error) {
+	files := make(map[string]*repository.RemoteFileInfo, len(r.files))
+	for path, file := range r.files {
+		copied := *file
+		files[path] = &copied
+	}
+	return files, nil
+}
+
+func (r *faultyRepository) GetFileHistory(ctx context.Context, path string, limit int) ([]repository.FileRevision, error) {
+	return nil, nil
+}
+
+func (r *faultyRepository) GetFileAt(ctx context.Context, path, ref string) (*repository.RemoteFileInfo, error) {
+	return nil, nil
+}
+
+func (r *faultyRepository) GetFilesAt(ctx context.Context, ref string, paths []string) (map[string]*repository.RemoteFileInfo, error) {
+	return nil, nil
+}
+
+func (r *faultyRepository) GetAllFilesAt(ctx context.Context, ref string, have map[string]string) (map[string]*repository.RemoteFileInfo, error) {
+	return nil, nil
+}
+
+func (r *faultyRepository) ResolveCommitAt(ctx context.Context, at time.Time) (string, error) {
+	return "", nil
+}
+
+func (r *faultyRepository) GetHeadSHA(ctx context.Context) (string, error) {
+	return r.headSHA(), nil
+}
+
+func (r *faultyRepository) TakeCommits() []repository.Commit {
+	made := r.made
+	r.made = nil
+	return made
+}
+
+func (r *faultyRepository) CompareCommits(ctx context.Context, base, head string) ([]repository.FileChange, error) {
+	return nil, nil
+}
+
+// journaledSyncer starts a fresh process: state is loaded from disk and
+// the journal is picked up from next to it
+func journaledSyncer(t *testing.T, repo repository.Repository, dir, statePath string) (*Syncer, *storage.FileManager) {
+	fileManager := storage.NewFileManager(dir)
+	if err := fileManager.LoadState(statePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		require.NoError(t, err)
+	}
+
+	syncer := New(repo, fileManager)
+	syncer.SetJournal(NewJournal(statePath+JournalSuffix), statePath)
+	return syncer, fileManager
+}
+
+// syncUntilCrash runs a sync and reports whether it was killed by the fault
+func syncUntilCrash(t *testing.T, syncer *Syncer, out io.Writer) (crashed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errSimulatedCrash {
+				panic(r)
+			}
+			crashed = true
+		}
+	}()
+
+	require.NoError(t, syncer.SyncAll(context.Background(), out))
+	return false
+}
+
+func TestSyncAllResumesAfterCrash(t *testing.T) {
+	for _, afterward := range []bool{false, true} {
+		t.Run(fmt.Sprintf("CrashAfterApplying=%v", afterward), func(t *testing.T) {
+			dir := t.TempDir()
+			statePath := filepath.Join(t.TempDir(), "state.json")
+			for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("local "+name), 0644))
+			}
+
+			repo := newFaultyRepository()
+			repo.crashAt = 3
+			repo.afterward = afterward
+
+			syncer, _ := journaledSyncer(t, repo, dir, statePath)
+			require.True(t, syncUntilCrash(t, syncer, io.Discard))
+
+			// Another device edits the files whose upload completed
+			crashed := strings.TrimPrefix(repo.mutations[len(repo.mutations)-1], "create ")
+			uploaded := make(map[string]bool)
+			for path := range repo.files {
+				uploaded[path] = true
+				if path != crashed {
+					repo.put(path, "remote edit of "+path, storage.GitModeRegular)
+				}
+			}
+			mutationsBefore := len(repo.mutations)
+
+			var out strings.Builder
+			syncer, fileManager := journaledSyncer(t, repo, dir, statePath)
+			require.False(t, syncUntilCrash(t, syncer, &out))
+
+			// Completed uploads are known to be synced, so the remote edits are
+			// pulled instead of being overwritten as conflicts
+			assert.NotContains(t, out.String(), "Conflict resolved")
+			for path := range uploaded {
+				if path == crashed {
+					continue
+				}
+				content, err := os.ReadFile(filepath.Join(dir, path))
+				require.NoError(t, err)
+				assert.Equal(t, "remote edit of "+path, string(content))
+			}
+
+			// Only the upload that never reached the remote is repeated
+			assert.Len(t, repo.mutations, mutationsBefore+3-len(uploaded))
+			assert.Len(t, repo.files, 3)
+
+			for _, file := range fileManager.GetTrackedFiles() {
+				relPath, err := filepath.Rel(dir, file.Path)
+				require.NoError(t, err)
+				assert.Equal(t, repo.files[relPath].SHA, file.LastSyncedRemoteSHA, relPath)
+				assert.Equal(t, file.Hash, file.LastSyncedHash, relPath)
+			}
+
+			// The journal is cleared once the sync finished
+			entries, err := NewJournal(statePath + JournalSuffix).Entries()
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
+
+func TestSyncAllResumesInterruptedDelete(t *testing.T) {
+	for _, afterward := range []bool{false, true} {
+		t.Run(fmt.Sprintf("CrashAfterApplying=%v", afterward), func(t *testing.T) {
+			dir := t.TempDir()
+			statePath := filepath.Join(t.TempDir(), "state.json")
+			path := filepath.Join(dir, "notes.txt")
+			require.NoError(t, os.WriteFile(path, []byte("notes"), 0644))
+
+			repo := newFaultyRepository()
+			syncer, _ := journaledSyncer(t, repo, dir, statePath)
+			require.False(t, syncUntilCrash(t, syncer, io.Discard))
+			require.Contains(t, repo.files, "notes.txt")
+
+			require.NoError(t, os.Remove(path))
+			repo.crashAt = len(repo.mutations) + 1
+			repo.afterward = afterward
+
+			syncer, _ = journaledSyncer(t, repo, dir, statePath)
+			require.True(t, syncUntilCrash(t, syncer, io.Discard))
+			mutationsBefore := len(repo.mutations)
+
+			syncer, fileManager := journaledSyncer(t, repo, dir, statePath)
+			require.False(t, syncUntilCrash(t, syncer, io.Discard))
+
+			assert.NotContains(t, repo.files, "notes.txt")
+			assert.Empty(t, fileManager.GetTrackedFiles())
+			if afterward {
+				assert.Len(t, repo.mutations, mutationsBefore, "delete must not be repeated")
+			} else {
+				assert.Len(t, repo.mutations, mutationsBefore+1)
+			}
+		})
+	}
+}
+
+func TestJournalIgnoresTornEntry(t *testing.T) {
+	journal := NewJournal(filepath.Join(t.TempDir(), "state.json"+JournalSuffix))
+	require.NoError(t, journal.Append(JournalEntry{Phase: JournalPlanned, Action: ActionUpload, Path: "a.txt"}))
+	require.NoError(t, journal.Append(JournalEntry{Phase: JournalDone, Action: ActionUpload, Path: "a.txt"}))
+
+	// A crash in the middle of appending leaves half a line behind
+	file, err := os.OpenFile(journal.Path(), os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"seq":3,"phase":"plan`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	entries, err := NewJournal(journal.Path()).Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	done, inFlight := pendingActions(entries)
+	assert.Len(t, done, 1)
+	assert.Empty(t, inFlight)
+}
+
+func TestFailedActionDoesNotLeaveJournalPending(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("local "+name), 0644))
+	}
+
+	repo := newFaultyRepository()
+	repo.failing = "b.txt"
+
+	syncer, _ := journaledSyncer(t, repo, dir, statePath)
+	require.False(t, syncUntilCrash(t, syncer, io.Discard))
+	assert.Contains(t, repo.files, "a.txt")
+	assert.NotContains(t, repo.files, "b.txt")
+
+	// The rejected upload didn't happen, so nothing is left to recover
+	entries, err := NewJournal(statePath + JournalSuffix).Entries()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.False(t, syncer.journalPending())
+
+	var out strings.Builder
+	syncer, _ = journaledSyncer(t, repo, dir, statePath)
+	require.False(t, syncUntilCrash(t, syncer, &out))
+	assert.NotContains(t, out.String(), "Resuming interrupted sync")
+}
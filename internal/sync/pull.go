@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/itcaat/catapult/internal/repository"
+	"github.com/itcaat/catapult/internal/storage"
+)
+
+// PullChanges synchronizes the files changed in the repository since the last
+// sync, downloading only those instead of every file. Local changes to other
+// files are left to the next sync. It falls back to a full sync when the last
+// synced commit is unknown or the changes since can't be listed.
+func (s *Syncer) PullChanges(ctx context.Context, out io.Writer) error {
+	manifest := s.fileManager.RemoteManifest()
+	if manifest == nil || manifest.Head() == "" || s.journalPending() {
+		return s.SyncAll(ctx, out)
+	}
+	baseSHA := manifest.Head()
+
+	headSHA, err := s.repo.GetHeadSHA(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get head commit: %w", err)
+	}
+	if headSHA == baseSHA {
+		return nil
+	}
+
+	changes, err := s.repo.CompareCommits(ctx, baseSHA, headSHA)
+	if err != nil {
+		fmt.Fprintf(out, "⚠️  Can't list remote changes (%v), syncing everything\n", err)
+		return s.SyncAll(ctx, out)
+	}
+
+	relPaths := changedPaths(changes)
+	scope := make(map[string]bool, len(relPaths))
+	for _, relPath := range relPaths {
+		scope[relPath] = true
+	}
+
+	fetch := func(ctx context.Context) (map[string]*repository.RemoteFileInfo, *storage.RemoteManifest, error) {
+		return s.fetchChanged(ctx, manifest, headSHA, relPaths)
+	}
+	rescan := func() error {
+		for _, relPath := range relPaths {
+			if err := s.fileManager.RescanFile(filepath.Join(s.fileManager.BaseDir(), relPath)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := s.run(ctx, out, rescan, fetch, scope); err != nil {
+		return err
+	}
+
+	// Look at the failed files again on the next pull
+	if len(s.lastErrors) > 0 && manifest.Head() == headSHA {
+		manifest.SetHead(baseSHA)
+	}
+	return nil
+}
+
+// fetchChanged gets the given remote files as of headSHA and records them in
+// manifest, which then describes headSHA. The times manifest is always
+// fetched, since it is rewritten from what is known about it.
+func (s *Syncer) fetchChanged(ctx context.Context, manifest *storage.RemoteManifest, headSHA string, relPaths []string) (map[string]*repository.RemoteFileInfo, *storage.RemoteManifest, error) {
+	fetchPaths := relPaths
+	if s.preserveMTime {
+		fetchPaths = append(fetchPaths[:len(fetchPaths):len(fetchPaths)], filepath.FromSlash(TimesManifestPath))
+	}
+
+	remoteFiles, err := s.repo.GetFilesAt(ctx, headSHA, fetchPaths)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get changed files: %w", err)
+	}
+	for _, relPath := range fetchPaths {
+		if remoteFile, ok := remoteFiles[relPath]; ok {
+			manifest.Set(relPath, remoteFile.SHA)
+		} else {
+			manifest.Remove(relPath)
+		}
+	}
+
+	manifest.SetHead(headSHA)
+	return remoteFiles, manifest, nil
+}
+
+// changedPaths lists the relative paths touched by changes, including the
+// old paths of renamed files
+func changedPaths(changes []repository.FileChange) []string {
+	seen := make(map[string]bool)
+	var relPaths []string
+	for _, change := range changes {
+		for _, relPath := range []string{change.PreviousPath, change.Path} {
+			if relPath != "" && !seen[relPath] {
+				seen[relPath] = true
+				relPaths = append(relPaths, relPath)
+			}
+		}
+	}
+	return relPaths
+}
+
+// journalPending reports whether an interrupted sync left actions behind,
+// which only a full sync can check against the repository
+func (s *Syncer) journalPending() bool {
+	if s.journal == nil {
+		return false
+	}
+	entries, err := s.journal.Entries()
+	return err != nil || len(entries) > 0
+}
@@ -0,0 +1,210 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itcaat/catapult/internal/repository"
+	"github.com/itcaat/catapult/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commitRepository is an in-memory repository that records the files each
+// commit of another device changed, so commits can be compared
+type commitRepository struct {
+	*faultyRepository
+	commits     [][]repository.FileChange
+	fullFetches int
+	treeFetches int
+	fileFetches []string
+	headErr     error
+}
+
+func newCommitRepository() *commitRepository {
+	r := &commitRepository{faultyRepository: newFaultyRepository()}
+	r.head = func() string {
+		return fmt.Sprintf("commit-%d-%d", len(r.commits), len(r.mutations))
+	}
+	return r
+}
+
+// commit changes a file as another device would
+func (r *commitRepository) commit(path, content, status string) {
+	if status == "removed" {
+		delete(r.files, path)
+	} else {
+		r.put(path, content, storage.GitModeRegular)
+	}
+	r.commits = append(r.commits, []repository.FileChange{{Path: path, Status: status}})
+}
+
+func (r *commitRepository) GetHeadSHA(ctx context.Context) (string, error) {
+	if r.headErr != nil {
+		return "", r.headErr
+	}
+	return r.headSHA(), nil
+}
+
+func (r *commitRepository) GetAllFilesWithContent(ctx context.Context) (map[string]*repository.RemoteFileInfo, error) {
+	r.fullFetches++
+	return r.faultyRepository.GetAllFilesWithContent(ctx)
+}
+
+func (r *commitRepository) GetFilesAt(ctx context.Context, ref string, paths []string) (map[string]*repository.RemoteFileInfo, error) {
+	r.treeFetches++
+	r.fileFetches = append(r.fileFetches, paths...)
+	files := make(map[string]*repository.RemoteFileInfo, len(paths))
+	for _, path := range paths {
+		if file, ok := r.files[path]; ok {
+			copied := *file
+			files[path] = &copied
+		}
+	}
+	return files, nil
+}
+
+func (r *commitRepository) CompareCommits(ctx context.Context, base, head string) ([]repository.FileChange, error) {
+	var from, mutations int
+	if _, err := fmt.Sscanf(base, "commit-%d-%d", &from, &mutations); err != nil {
+		return nil, err
+	}
+
+	var changes []repository.FileChange
+	for _, commit := range r.commits[from:] {
+		changes = append(changes, commit...)
+	}
+	return changes, nil
+}
+
+func TestPullChanges(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("local "+name), 0644))
+	}
+
+	repo := newCommitRepository()
+	fileManager := storage.NewFileManager(dir)
+	syncer := New(repo, fileManager)
+
+	// Without a known last commit, everything is synced
+	require.NoError(t, syncer.PullChanges(context.Background(), io.Discard))
+	assert.Equal(t, 1, repo.fullFetches)
+	assert.Len(t, repo.files, 2)
+
+	// Another device edits a file and adds one; this one edits another
+	repo.commit("a.txt", "remote edit", "modified")
+	repo.commit("c.txt", "remote new", "added")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("local edit"), 0644))
+	mutations := len(repo.mutations)
+
+	require.NoError(t, syncer.PullChanges(context.Background(), io.Discard))
+	assert.Equal(t, 1, repo.fullFetches, "only changed files are fetched")
+	assert.ElementsMatch(t, []string{"a.txt", "c.txt"}, repo.fileFetches)
+	assert.Equal(t, 1, repo.treeFetches, "the tree is read once per pull")
+
+	for path, want := range map[string]string{"a.txt": "remote edit", "c.txt": "remote new", "b.txt": "local edit"} {
+		content, err := os.ReadFile(filepath.Join(dir, path))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(content), path)
+	}
+	assert.Len(t, repo.mutations, mutations, "local changes to other files wait for the next sync")
+
+	manifest := fileManager.RemoteManifest()
+	head, _ := repo.GetHeadSHA(context.Background())
+	assert.Equal(t, head, manifest.Head())
+	sha, ok := manifest.SHA("c.txt")
+	assert.True(t, ok)
+	assert.Equal(t, repo.files["c.txt"].SHA, sha)
+
+	// Nothing is fetched while the head doesn't move
+	repo.fileFetches = nil
+	require.NoError(t, syncer.PullChanges(context.Background(), io.Discard))
+	assert.Empty(t, repo.fileFetches)
+	assert.Equal(t, 1, repo.fullFetches)
+
+	// A file deleted by another device is deleted here too, not uploaded again
+	repo.commit("c.txt", "", "removed")
+	mutations = len(repo.mutations)
+
+	require.NoError(t, syncer.PullChanges(context.Background(), io.Discard))
+	assert.Equal(t, 1, repo.fullFetches)
+	assert.NoFileExists(t, filepath.Join(dir, "c.txt"))
+	assert.NotContains(t, repo.files, "c.txt")
+	assert.Len(t, repo.mutations, mutations)
+	_, err := fileManager.GetFileInfo(filepath.Join(dir, "c.txt"))
+	assert.Error(t, err, "no longer tracked")
+	_, ok = manifest.SHA("c.txt")
+	assert.False(t, ok)
+}
+
+func TestSyncAllKeepsHeadWhenLookupFails(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("local a.txt"), 0644))
+
+	repo := newCommitRepository()
+	fileManager := storage.NewFileManager(dir)
+	syncer := New(repo, fileManager)
+	require.NoError(t, syncer.SyncAll(context.Background(), io.Discard))
+	head := fileManager.RemoteManifest().Head()
+	require.NotEmpty(t, head)
+
+	// The head can't be looked up
+	repo.headErr = fmt.Errorf("rate limited")
+	require.NoError(t, syncer.SyncAll(context.Background(), io.Discard))
+	assert.Equal(t, head, fileManager.RemoteManifest().Head())
+
+	// It still moves past this sync's own upload
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("local edit"), 0644))
+	require.NoError(t, syncer.SyncAll(context.Background(), io.Discard))
+	assert.Equal(t, repo.headSHA(), fileManager.RemoteManifest().Head())
+	assert.Equal(t, 3, repo.fullFetches)
+
+	// Changes are still listed from the kept head instead of fetching everything
+	repo.headErr = nil
+	repo.commit("b.txt", "remote new", "added")
+	require.NoError(t, syncer.PullChanges(context.Background(), io.Discard))
+	assert.Equal(t, 3, repo.fullFetches)
+	assert.Contains(t, repo.fileFetches, "b.txt")
+
+	content, err := os.ReadFile(filepath.Join(dir, "b.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "remote new", string(content))
+}
+
+func TestSyncAllKeepsCommitsOfOtherDevicesForPull(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("local a.txt"), 0644))
+
+	repo := newCommitRepository()
+	fileManager := storage.NewFileManager(dir)
+	syncer := New(repo, fileManager)
+	require.NoError(t, syncer.SyncAll(context.Background(), io.Discard))
+
+	// Another device commits right after this sync's own upload
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("local edit"), 0644))
+	repo.interleave = func() { repo.commit("b.txt", "remote new", "added") }
+	require.NoError(t, syncer.SyncAll(context.Background(), io.Discard))
+	require.NoFileExists(t, filepath.Join(dir, "b.txt"))
+	assert.NotEqual(t, repo.headSHA(), fileManager.RemoteManifest().Head())
+
+	// The next pull lists the other device's commit
+	require.NoError(t, syncer.PullChanges(context.Background(), io.Discard))
+	assert.Equal(t, []string{"b.txt"}, repo.fileFetches)
+	content, err := os.ReadFile(filepath.Join(dir, "b.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "remote new", string(content))
+}
+
+func TestChangedPaths(t *testing.T) {
+	changes := []repository.FileChange{
+		{Path: "a.txt", Status: "modified"},
+		{Path: "new.txt", PreviousPath: "old.txt", Status: "renamed"},
+		{Path: "a.txt", Status: "modified"},
+	}
+	assert.Equal(t, []string{"a.txt", "old.txt", "new.txt"}, changedPaths(changes))
+}
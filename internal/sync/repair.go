@@ -0,0 +1,149 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/itcaat/catapult/internal/repository"
+	"github.com/itcaat/catapult/internal/storage"
+)
+
+// RepairReport lists the outcome of rebuilding the sync state, by relative path
+type RepairReport struct {
+	Reconciled []string // Identical locally and remotely, marked as synced
+	Differing  []string // Content differs, flagged as needing attention
+	LocalOnly  []string // Will be uploaded by the next sync
+	RemoteOnly []string // Will be downloaded by the next sync
+}
+
+// Repair rebuilds the sync state from the local and remote content, for use
+// when the state file is lost or corrupt. Every local file is re-hashed and
+// its git blob SHA matched against the remote tree: identical files are
+// recorded as synced, and differing ones are flagged as needing attention
+// instead of being treated as conflicts. Both versions of a differing file
+// are saved under .catapult/conflicts.
+func (s *Syncer) Repair(ctx context.Context) (*RepairReport, error) {
+	s.fileManager.RehashAll()
+	if err := s.fileManager.ScanDirectory(); err != nil {
+		return nil, fmt.Errorf("failed to scan directory: %w", err)
+	}
+
+	headSHA := s.currentHead(ctx)
+	remoteFiles, err := s.repo.GetAllFilesWithContent(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote files with content: %w", err)
+	}
+	s.fileManager.SetRemoteManifest(newRemoteManifest(headSHA, remoteFiles))
+
+	report := &RepairReport{}
+	localPaths := make(map[string]bool)
+
+	for _, file := range s.fileManager.Files() {
+		if file.Deleted {
+			// Nothing to sync locally; a remote copy is downloaded again
+			// rather than deleted on the strength of lost state
+			s.fileManager.RemoveFile(file.Path)
+			continue
+		}
+
+		relPath, err := filepath.Rel(s.fileManager.BaseDir(), file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get relative path: %w", err)
+		}
+		localPaths[relPath] = true
+
+		remoteFile := remoteFiles[relPath]
+		if remoteFile == nil {
+			s.fileManager.SetSyncInfo(file.Path, "", "", "")
+			report.LocalOnly = append(report.LocalOnly, relPath)
+			continue
+		}
+
+		content, err := s.fileManager.ReadFileContent(file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.fileManager.CalculateGitSHAFromContent(content) == remoteFile.SHA {
+			s.fileManager.SetSyncInfo(file.Path, file.Hash, remoteFile.SHA, syncedMode(file, remoteFile))
+			report.Reconciled = append(report.Reconciled, relPath)
+			continue
+		}
+
+		if err := s.fileManager.SaveConflictVersions(file.Path, remoteFile.Content); err != nil {
+			return nil, fmt.Errorf("failed to save versions of %s: %w", relPath, err)
+		}
+		if err := s.fileManager.MarkNeedsAttention(file.Path); err != nil {
+			return nil, err
+		}
+		report.Differing = append(report.Differing, relPath)
+	}
+
+	for relPath, remoteFile := range remoteFiles {
+		if localPaths[relPath] || isMetadataPath(relPath) {
+			continue
+		}
+		if remoteFile.Mode == storage.GitModeSymlink && s.fileManager.SymlinkPolicy() != storage.SymlinkPreserve {
+			continue
+		}
+		report.RemoteOnly = append(report.RemoteOnly, relPath)
+	}
+
+	// Journaled actions refer to the state being replaced
+	if s.journal != nil {
+		if err := s.journal.Reset(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, paths := range [][]string{report.Reconciled, report.Differing, report.LocalOnly, report.RemoteOnly} {
+		sort.Strings(paths)
+	}
+	return report, nil
+}
+
+// syncedMode returns the git mode to record as last synced for a file whose
+// content matches the remote. A differing local mode counts as a local
+// change, so it is pushed by the next sync.
+func syncedMode(file *storage.FileInfo, remoteFile *repository.RemoteFileInfo) string {
+	if remoteFile.Mode != "" {
+		return remoteFile.Mode
+	}
+	return file.GitMode()
+}
+
+// Print writes a human-readable summary of the report
+func (r *RepairReport) Print(out io.Writer) {
+	sections := []struct {
+		title string
+		paths []string
+	}{
+		{"✅ Reconciled (identical locally and remotely)", r.Reconciled},
+		{"🔍 Needs attention (content differs; edit the file to keep the local version, delete it to take the remote one)", r.Differing},
+		{"📤 Local only (will be uploaded)", r.LocalOnly},
+		{"📥 Remote only (will be downloaded)", r.RemoteOnly},
+	}
+
+	for _, section := range sections {
+		if len(section.paths) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "%s:\n", section.title)
+		for _, path := range section.paths {
+			fmt.Fprintf(out, "  %s\n", path)
+		}
+		fmt.Fprintln(out)
+	}
+
+	fmt.Fprintf(out, "Repair Summary:\n")
+	fmt.Fprintf(out, "Reconciled: %d\n", len(r.Reconciled))
+	fmt.Fprintf(out, "Needs attention: %d\n", len(r.Differing))
+	fmt.Fprintf(out, "Local only: %d\n", len(r.LocalOnly))
+	fmt.Fprintf(out, "Remote only: %d\n", len(r.RemoteOnly))
+	if len(r.Differing) > 0 {
+		fmt.Fprintf(out, "\n💡 Both versions of each differing file are saved under %s/conflicts\n", storage.MetadataDir)
+	}
+}
@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itcaat/catapult/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepair(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	repo := newFaultyRepository()
+	repo.put("same.txt", "same", storage.GitModeRegular)
+	repo.put("differs.txt", "remote version", storage.GitModeRegular)
+	repo.put("remote-only.txt", "remote", storage.GitModeRegular)
+
+	for name, content := range map[string]string{
+		"same.txt":       "same",
+		"differs.txt":    "local version",
+		"local-only.txt": "local",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	// The state is lost: start from an empty file manager
+	fileManager := storage.NewFileManager(dir)
+	syncer := New(repo, fileManager)
+
+	report, err := syncer.Repair(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"same.txt"}, report.Reconciled)
+	assert.Equal(t, []string{"differs.txt"}, report.Differing)
+	assert.Equal(t, []string{"local-only.txt"}, report.LocalOnly)
+	assert.Equal(t, []string{"remote-only.txt"}, report.RemoteOnly)
+
+	info, err := fileManager.GetFileInfo(filepath.Join(dir, "same.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, repo.files["same.txt"].SHA, info.LastSyncedRemoteSHA)
+	assert.Equal(t, info.Hash, info.LastSyncedHash)
+
+	// Both versions of the differing file are kept for reference
+	remoteCopy, err := os.ReadFile(filepath.Join(dir, storage.MetadataDir, "conflicts", "differs.txt.remote"))
+	require.NoError(t, err)
+	assert.Equal(t, "remote version", string(remoteCopy))
+
+	// Sync leaves the differing file alone instead of resolving a conflict
+	require.NoError(t, syncer.SyncAll(ctx, io.Discard))
+	assert.Equal(t, []string{"create local-only.txt"}, repo.mutations)
+	assert.Equal(t, "remote version", repo.files["differs.txt"].Content)
+	local, err := os.ReadFile(filepath.Join(dir, "differs.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "local version", string(local))
+	_, err = os.Stat(filepath.Join(dir, "remote-only.txt"))
+	assert.NoError(t, err)
+
+	// Editing the file settles it in favour of the local version
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "differs.txt"), []byte("merged by hand"), 0644))
+	require.NoError(t, syncer.SyncAll(ctx, io.Discard))
+	assert.Equal(t, "merged by hand", repo.files["differs.txt"].Content)
+
+	info, err = fileManager.GetFileInfo(filepath.Join(dir, "differs.txt"))
+	require.NoError(t, err)
+	assert.False(t, info.NeedsAttention)
+}
+
+func TestRepair_DeleteTakesRemote(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	repo := newFaultyRepository()
+	repo.put("differs.txt", "remote version", storage.GitModeRegular)
+	path := filepath.Join(dir, "differs.txt")
+	require.NoError(t, os.WriteFile(path, []byte("local version"), 0644))
+
+	syncer := New(repo, storage.NewFileManager(dir))
+	_, err := syncer.Repair(ctx)
+	require.NoError(t, err)
+
+	// Deleting the flagged file brings back the remote version
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, syncer.SyncAll(ctx, io.Discard))
+	assert.Empty(t, repo.mutations)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "remote version", string(content))
+}
@@ -0,0 +1,125 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/itcaat/catapult/internal/repository"
+	"github.com/itcaat/catapult/internal/storage"
+)
+
+// RestoreFile brings back the version of a file at ref. The old content is
+// written locally and uploaded by a regular sync, so the restore is recorded
+// as a new commit and the newer versions stay in history.
+func (s *Syncer) RestoreFile(ctx context.Context, relPath, ref string, out io.Writer) error {
+	// Push pending local changes first so they can be restored later too
+	if err := s.SyncAll(ctx, out); err != nil {
+		return fmt.Errorf("failed to sync before restoring: %w", err)
+	}
+
+	remoteFile, err := s.repo.GetFileAt(ctx, relPath, ref)
+	if err != nil {
+		return fmt.Errorf("failed to get %s at %s: %w", relPath, ref, err)
+	}
+	if remoteFile == nil {
+		return fmt.Errorf("'%s' did not exist at %s", relPath, ref)
+	}
+
+	localPath := filepath.Join(s.fileManager.BaseDir(), relPath)
+	if err := s.fileManager.WriteFileContent(localPath, []byte(remoteFile.Content), remoteFile.Mode); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", relPath, err)
+	}
+	fmt.Fprintf(out, "⏪ Restored %s from %s\n", relPath, repository.ShortSHA(ref))
+
+	return s.SyncAll(ctx, out)
+}
+
+// RestoreAll rolls the whole folder back to ref. Files that didn't exist at
+// ref are deleted, and the result is synced like any local change.
+func (s *Syncer) RestoreAll(ctx context.Context, ref string, out io.Writer) error {
+	if err := s.SyncAll(ctx, out); err != nil {
+		return fmt.Errorf("failed to sync before restoring: %w", err)
+	}
+
+	// Only the files that differ from the local ones need to be downloaded
+	have := make(map[string]string)
+	for _, file := range s.fileManager.Files() {
+		if file.Deleted {
+			continue
+		}
+		relPath, err := filepath.Rel(s.fileManager.BaseDir(), file.Path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		content, err := s.fileManager.ReadFileContent(file.Path)
+		if err != nil {
+			continue
+		}
+		have[relPath] = s.fileManager.CalculateGitSHAFromContent(content)
+	}
+
+	oldFiles, err := s.repo.GetAllFilesAt(ctx, ref, have)
+	if err != nil {
+		return fmt.Errorf("failed to get files at %s: %w", ref, err)
+	}
+
+	var restored, removed int
+
+	// Remove files created after ref
+	for _, file := range s.fileManager.Files() {
+		relPath, err := filepath.Rel(s.fileManager.BaseDir(), file.Path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		if _, existed := oldFiles[relPath]; existed || file.Deleted {
+			continue
+		}
+
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", relPath, err)
+		}
+		removed++
+	}
+
+	// Bring back every file as it was at ref
+	for relPath, oldFile := range oldFiles {
+		if isMetadataPath(relPath) {
+			continue
+		}
+		if oldFile.Mode == storage.GitModeSymlink && s.fileManager.SymlinkPolicy() != storage.SymlinkPreserve {
+			continue
+		}
+
+		localPath := filepath.Join(s.fileManager.BaseDir(), relPath)
+		content := []byte(oldFile.Content)
+		if sha, ok := have[relPath]; ok && sha == oldFile.SHA {
+			if s.modeMatches(localPath, oldFile.Mode) {
+				continue
+			}
+
+			// Only the mode differs, and the content may not have been downloaded
+			content, err = s.fileManager.ReadFileContent(localPath)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", relPath, err)
+			}
+		}
+
+		if err := s.fileManager.WriteFileContent(localPath, content, oldFile.Mode); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", relPath, err)
+		}
+		restored++
+	}
+
+	fmt.Fprintf(out, "⏪ Rolled back to %s: %d files restored, %d files removed\n", repository.ShortSHA(ref), restored, removed)
+
+	return s.SyncAll(ctx, out)
+}
+
+// modeMatches reports whether the local file already has a remote git mode
+func (s *Syncer) modeMatches(localPath, remoteMode string) bool {
+	mode, err := s.fileManager.LocalGitMode(localPath)
+	return err == nil && (remoteMode == "" || !s.modeSupported(mode, remoteMode) || mode == remoteMode)
+}
@@ -0,0 +1,45 @@
+package sync
+
+import "sync/atomic"
+
+// Stats counts the files a Syncer changed since it was created
+type Stats struct {
+	Uploaded   int64
+	Downloaded int64
+	Deleted    int64
+	Conflicts  int64
+}
+
+// syncStats accumulates Stats; it is updated while syncing and read by
+// monitoring concurrently
+type syncStats struct {
+	uploaded   atomic.Int64
+	downloaded atomic.Int64
+	deleted    atomic.Int64
+	conflicts  atomic.Int64
+}
+
+// record counts a file that synced without error
+func (s *syncStats) record(status SyncStatus) {
+	switch status {
+	case SyncStatusLocalChanges:
+		s.uploaded.Add(1)
+	case SyncStatusRemoteChanges:
+		s.downloaded.Add(1)
+	case SyncStatusDeleted:
+		s.deleted.Add(1)
+	case SyncStatusConflict:
+		s.conflicts.Add(1)
+	}
+}
+
+// Stats returns how many files the syncer uploaded, downloaded, deleted and
+// resolved conflicts of so far
+func (s *Syncer) Stats() Stats {
+	return Stats{
+		Uploaded:   s.stats.uploaded.Load(),
+		Downloaded: s.stats.downloaded.Load(),
+		Deleted:    s.stats.deleted.Load(),
+		Conflicts:  s.stats.conflicts.Load(),
+	}
+}
@@ -2,14 +2,18 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/itcaat/catapult/internal/hooks"
 	"github.com/itcaat/catapult/internal/issues"
 	"github.com/itcaat/catapult/internal/repository"
 	"github.com/itcaat/catapult/internal/storage"
@@ -24,6 +28,8 @@ const (
 	SyncStatusRemoteChanges
 	SyncStatusConflict
 	SyncStatusDeleted // New status for files that were deleted
+	SyncStatusNeedsAttention
+	SyncStatusRemoteDeleted // Deleted locally after another device deleted it
 )
 
 // SyncResult represents the result of a file synchronization
@@ -33,12 +39,58 @@ type SyncResult struct {
 	Error  error
 }
 
+// FileErrors lists the files that failed in a sync that otherwise completed,
+// by relative path
+type FileErrors map[string]error
+
+func (e FileErrors) Error() string {
+	paths := make([]string, 0, len(e))
+	for path := range e {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	messages := make([]string, 0, len(paths))
+	for _, path := range paths {
+		messages = append(messages, fmt.Sprintf("%s: %v", path, e[path]))
+	}
+	return fmt.Sprintf("%d files failed to sync: %s", len(e), strings.Join(messages, "; "))
+}
+
+// Only returns the errors of the given relative paths, or nil if none of
+// them failed
+func (e FileErrors) Only(paths []string) error {
+	only := make(FileErrors)
+	for _, path := range paths {
+		if err, failed := e[path]; failed {
+			only[path] = err
+		}
+	}
+	if len(only) == 0 {
+		return nil
+	}
+	return only
+}
+
 // Syncer handles file synchronization between local storage and GitHub
 type Syncer struct {
 	repo         repository.Repository
 	fileManager  *storage.FileManager
 	issueManager issues.IssueManager
+	hooks        *hooks.Runner
 	logger       *log.Logger
+
+	preserveMTime bool
+	recordCTime   bool
+	times         *TimesManifest
+
+	journal   *Journal
+	statePath string
+	planned   map[string]JournalEntry // Actions of this run not yet completed
+	inFlight  map[string]JournalEntry // Actions of an interrupted run with unknown outcome
+
+	lastErrors FileErrors // Files that failed in the last run
+	stats      syncStats
 }
 
 // New creates a new Syncer instance
@@ -59,20 +111,137 @@ func NewWithIssueManager(repo repository.Repository, fileManager *storage.FileMa
 	}
 }
 
+// SetHooks configures the hook runner invoked around synchronization
+func (s *Syncer) SetHooks(runner *hooks.Runner) {
+	s.hooks = runner
+}
+
 // SyncAll synchronizes all files in the directory
 func (s *Syncer) SyncAll(ctx context.Context, out io.Writer) error {
+	return s.sync(ctx, out, s.fileManager.ScanDirectory)
+}
+
+// SyncFiles synchronizes all files like SyncAll, but only rescans the given
+// paths instead of the whole directory. The state of other local files is
+// taken as is, which suits callers that know what changed, like the watcher.
+func (s *Syncer) SyncFiles(ctx context.Context, relPaths []string, out io.Writer) error {
+	return s.sync(ctx, out, func() error {
+		for _, relPath := range relPaths {
+			if err := s.fileManager.RescanFile(filepath.Join(s.fileManager.BaseDir(), relPath)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sync synchronizes all tracked and remote files after updating the local
+// files with scan
+func (s *Syncer) sync(ctx context.Context, out io.Writer, scan func() error) error {
+	return s.run(ctx, out, scan, s.fetchAll, nil)
+}
+
+// fetchRemote gets the remote files a sync compares against, along with the
+// manifest recording them
+type fetchRemote func(ctx context.Context) (map[string]*repository.RemoteFileInfo, *storage.RemoteManifest, error)
+
+// fetchAll gets every remote file. The head commit is looked up first, so
+// the files are at least as new as it.
+func (s *Syncer) fetchAll(ctx context.Context) (map[string]*repository.RemoteFileInfo, *storage.RemoteManifest, error) {
+	headSHA := s.currentHead(ctx)
+	remoteFiles, err := s.repo.GetAllFilesWithContent(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get remote files with content: %w", err)
+	}
+	return remoteFiles, newRemoteManifest(headSHA, remoteFiles), nil
+}
+
+// advanceHead moves the head of manifest past the commits this sync made.
+// If another device committed in between, the head is kept, so the changes
+// it made are still listed on the next pull.
+func (s *Syncer) advanceHead(manifest *storage.RemoteManifest) {
+	commits, ok := repository.TakeCommits(s.repo)
+	if !ok {
+		return
+	}
+
+	headSHA := manifest.Head()
+	for _, commit := range commits {
+		if commit.Parent != headSHA {
+			return
+		}
+		headSHA = commit.SHA
+	}
+	manifest.SetHead(headSHA)
+}
+
+// currentHead returns the head commit of the repository. When it can't be
+// looked up, such as in an empty repository, the head recorded by the last
+// sync is kept: changes listed from an older commit include the newer ones.
+func (s *Syncer) currentHead(ctx context.Context) string {
+	headSHA, err := s.repo.GetHeadSHA(ctx)
+	if err == nil {
+		return headSHA
+	}
+	if manifest := s.fileManager.RemoteManifest(); manifest != nil {
+		return manifest.Head()
+	}
+	return ""
+}
+
+// run synchronizes files after updating the local files with scan and
+// getting the remote ones with fetch. Only the relative paths in scope are
+// synced, or every file if scope is nil.
+func (s *Syncer) run(ctx context.Context, out io.Writer, scan func() error, fetch fetchRemote, scope map[string]bool) error {
+	s.lastErrors = make(FileErrors)
+
 	// Scan directory for local files
-	if err := s.fileManager.ScanDirectory(); err != nil {
+	if err := scan(); err != nil {
 		return fmt.Errorf("failed to scan directory: %w", err)
 	}
 
-	// Get local files
-	localFiles := s.fileManager.GetTrackedFiles()
+	// Run pre-sync hook; a failure aborts this run
+	if s.hooks != nil && s.hooks.Enabled(hooks.EventPreSync) {
+		if err := s.hooks.Run(ctx, hooks.EventPreSync, s.localHookFiles()); err != nil {
+			return fmt.Errorf("pre-sync hook failed, aborting sync: %w", err)
+		}
 
-	// Get all remote files with content efficiently
-	remoteFiles, err := s.repo.GetAllFilesWithContent(ctx)
+		// The hook may have created or modified files
+		if err := s.fileManager.ScanDirectory(); err != nil {
+			return fmt.Errorf("failed to scan directory: %w", err)
+		}
+	}
+
+	// Only commits made from here on follow the fetched head
+	repository.TakeCommits(s.repo)
+
+	// Get the remote files with content
+	remoteFiles, manifest, err := fetch(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get remote files with content: %w", err)
+		return err
+	}
+	s.fileManager.SetRemoteManifest(manifest)
+
+	// Finish what an interrupted sync left behind
+	s.planned = make(map[string]JournalEntry)
+	if err := s.recoverJournal(out, remoteFiles); err != nil {
+		return fmt.Errorf("failed to recover sync journal: %w", err)
+	}
+
+	// Get local files
+	localFiles := s.fileManager.Files()
+
+	// Load the times manifest kept alongside the files
+	s.times = nil
+	if s.preserveMTime {
+		manifestFile := remoteFiles[filepath.FromSlash(TimesManifestPath)]
+		manifest, err := newTimesManifest(manifestFile)
+		if err != nil {
+			fmt.Fprintf(out, "⚠️  %v, recreating it\n", err)
+			manifest, _ = newTimesManifest(nil)
+			manifest.exists = manifestFile != nil
+		}
+		s.times = manifest
 	}
 
 	// Create a map of all files (local + remote)
@@ -84,12 +253,25 @@ func (s *Syncer) SyncAll(ctx context.Context, out io.Writer) error {
 		if err != nil {
 			return fmt.Errorf("failed to get relative path: %w", err)
 		}
+		if scope != nil && !scope[relPath] {
+			continue
+		}
 		allFiles[relPath] = file
 	}
 
 	// Add remote files that don't exist locally
-	for remotePath := range remoteFiles {
+	for remotePath, remoteFile := range remoteFiles {
+		// Catapult metadata is never synced as a regular file
+		if isMetadataPath(remotePath) || (scope != nil && !scope[remotePath]) {
+			continue
+		}
+
 		if _, exists := allFiles[remotePath]; !exists {
+			// Symlinks are only restored as links when preserving them
+			if remoteFile.Mode == storage.GitModeSymlink && s.fileManager.SymlinkPolicy() != storage.SymlinkPreserve {
+				continue
+			}
+
 			// Create a virtual FileInfo for remote-only file
 			localPath := filepath.Join(s.fileManager.BaseDir(), remotePath)
 			allFiles[remotePath] = &storage.FileInfo{
@@ -102,11 +284,28 @@ func (s *Syncer) SyncAll(ctx context.Context, out io.Writer) error {
 	fmt.Fprintf(out, "Syncing %d files...\n", len(allFiles))
 
 	// Track results
-	var synced, updated, pulled, conflicted, deleted int
+	var synced, updated, pulled, conflicted, deleted, attention int
+	var hookFiles, downloadedFiles []hooks.File
 
-	// Sync each file
+	// Sync each file; moved files are committed as moves
+	moved := s.moveFiles(ctx, allFiles, remoteFiles)
 	for relPath, file := range allFiles {
-		result := s.syncFileByPath(ctx, file, relPath, remoteFiles[relPath])
+		result, ok := moved[relPath]
+		if !ok {
+			result = s.syncFileByPath(ctx, file, relPath, remoteFiles[relPath])
+		}
+		hookFile := s.hookFile(relPath, result, remoteFiles[relPath])
+		hookFiles = append(hookFiles, hookFile)
+
+		if result.Error == nil {
+			if err := s.completeAction(relPath, result.Path); err != nil {
+				fmt.Fprintf(out, "⚠️  %v\n", err)
+			}
+			delete(s.inFlight, relPath)
+			s.updateTimes(out, result, relPath)
+			s.updateRemoteManifest(manifest, relPath, result)
+			s.stats.record(result.Status)
+		}
 
 		// Show what's happening with each file
 		switch result.Status {
@@ -118,14 +317,27 @@ func (s *Syncer) SyncAll(ctx context.Context, out io.Writer) error {
 		case SyncStatusRemoteChanges:
 			fmt.Fprintf(out, "📥 Downloaded: %s\n", relPath)
 			pulled++
+			if result.Error == nil {
+				downloadedFiles = append(downloadedFiles, hookFile)
+			}
 		case SyncStatusConflict:
 			fmt.Fprintf(out, "⚠️  Conflict resolved (local version kept): %s\n", relPath)
 			conflicted++
+			s.runHook(ctx, out, hooks.EventOnConflict, []hooks.File{hookFile})
 		case SyncStatusDeleted:
 			fmt.Fprintf(out, "🗑️  Deleted from repository: %s\n", relPath)
 			deleted++
+		case SyncStatusRemoteDeleted:
+			fmt.Fprintf(out, "🗑️  Deleted locally (removed from repository): %s\n", relPath)
+			deleted++
+		case SyncStatusNeedsAttention:
+			fmt.Fprintf(out, "🔍 Needs attention (edit to keep local, delete to take remote): %s\n", relPath)
+			attention++
 		}
 		if result.Error != nil {
+			s.abandonAction(relPath)
+			s.lastErrors[relPath] = result.Error
+
 			// Record the sync error in FileInfo for status display
 			if err := s.fileManager.RecordSyncError(result.Path, result.Error); err != nil {
 				// Log error but continue
@@ -154,10 +366,165 @@ func (s *Syncer) SyncAll(ctx context.Context, out io.Writer) error {
 	fmt.Fprintf(out, "Pulled: %d\n", pulled)
 	fmt.Fprintf(out, "Conflicts: %d\n", conflicted)
 	fmt.Fprintf(out, "Deleted: %d\n", deleted)
+	if attention > 0 {
+		fmt.Fprintf(out, "Needs attention: %d\n", attention)
+	}
+
+	if err := s.saveTimesManifest(ctx); err != nil {
+		fmt.Fprintf(out, "⚠️  %v\n", err)
+	}
+
+	s.advanceHead(manifest)
+
+	if err := s.checkpoint(); err != nil {
+		fmt.Fprintf(out, "⚠️  %v\n", err)
+	}
+
+	if len(downloadedFiles) > 0 {
+		s.runHook(ctx, out, hooks.EventPostDownload, sortHookFiles(downloadedFiles))
+	}
+	s.runHook(ctx, out, hooks.EventPostSync, sortHookFiles(hookFiles))
 
 	return nil
 }
 
+// LastErrors returns the files that failed in the last sync, which still
+// returns nil for them
+func (s *Syncer) LastErrors() FileErrors {
+	errs := make(FileErrors, len(s.lastErrors))
+	for path, err := range s.lastErrors {
+		errs[path] = err
+	}
+	return errs
+}
+
+// ReportFailure reports a file that can't be synced, creating an issue if
+// issue management is enabled
+func (s *Syncer) ReportFailure(path string, err error) {
+	if s.issueManager != nil {
+		s.createIssueForError(path, err)
+	}
+}
+
+// newRemoteManifest records the blob SHAs of the remote files
+func newRemoteManifest(headSHA string, remoteFiles map[string]*repository.RemoteFileInfo) *storage.RemoteManifest {
+	shas := make(map[string]string, len(remoteFiles))
+	for relPath, remoteFile := range remoteFiles {
+		shas[relPath] = remoteFile.SHA
+	}
+	return storage.NewRemoteManifest(headSHA, shas)
+}
+
+// updateRemoteManifest records a change this sync made to the repository
+func (s *Syncer) updateRemoteManifest(manifest *storage.RemoteManifest, relPath string, result SyncResult) {
+	switch result.Status {
+	case SyncStatusDeleted, SyncStatusRemoteDeleted:
+		manifest.Remove(relPath)
+	case SyncStatusLocalChanges, SyncStatusConflict:
+		if info, err := s.fileManager.GetFileInfo(result.Path); err == nil && info.LastSyncedRemoteSHA != "" {
+			manifest.Set(relPath, info.LastSyncedRemoteSHA)
+		}
+	}
+}
+
+// updateTimes records or restores file times after a file was synced
+func (s *Syncer) updateTimes(out io.Writer, result SyncResult, relPath string) {
+	if s.times == nil {
+		return
+	}
+
+	switch result.Status {
+	case SyncStatusLocalChanges, SyncStatusConflict:
+		s.recordTimes(result.Path, relPath)
+	case SyncStatusRemoteChanges:
+		if err := s.restoreTimes(result.Path, relPath); err != nil {
+			fmt.Fprintf(out, "⚠️  Failed to restore modification time of %s: %v\n", relPath, err)
+		}
+	case SyncStatusDeleted, SyncStatusRemoteDeleted:
+		s.times.Remove(relPath)
+	case SyncStatusSynced:
+		// Fill in files synced before times were recorded
+		if _, ok := s.times.Get(relPath); !ok {
+			s.recordTimes(result.Path, relPath)
+		}
+	}
+}
+
+// runHook runs a post-operation hook, reporting failures without aborting
+func (s *Syncer) runHook(ctx context.Context, out io.Writer, event hooks.Event, files []hooks.File) {
+	if s.hooks == nil {
+		return
+	}
+
+	if err := s.hooks.Run(ctx, event, files); err != nil {
+		fmt.Fprintf(out, "⚠️  %v\n", err)
+		if s.logger != nil {
+			s.logger.Printf("Hook error: %v", err)
+		}
+	}
+}
+
+// localHookFiles describes the currently tracked local files for hooks
+func (s *Syncer) localHookFiles() []hooks.File {
+	var files []hooks.File
+	for _, file := range s.fileManager.Files() {
+		if file.Deleted {
+			continue
+		}
+		relPath, err := filepath.Rel(s.fileManager.BaseDir(), file.Path)
+		if err != nil {
+			continue
+		}
+		files = append(files, hooks.File{
+			Path:     filepath.ToSlash(relPath),
+			LocalSHA: file.Hash,
+		})
+	}
+	return sortHookFiles(files)
+}
+
+// hookFile describes the outcome of syncing a single file for hooks
+func (s *Syncer) hookFile(relPath string, result SyncResult, remoteFile *repository.RemoteFileInfo) hooks.File {
+	file := hooks.File{
+		Path:   filepath.ToSlash(relPath),
+		Action: hookAction(result.Status),
+	}
+	if remoteFile != nil {
+		file.RemoteSHA = remoteFile.SHA
+	}
+	if info, err := s.fileManager.GetFileInfo(result.Path); err == nil {
+		file.LocalSHA = info.Hash
+	}
+	if result.Error != nil {
+		file.Error = result.Error.Error()
+	}
+	return file
+}
+
+// hookAction maps a sync status to the action name reported to hooks
+func hookAction(status SyncStatus) string {
+	switch status {
+	case SyncStatusLocalChanges:
+		return "upload"
+	case SyncStatusRemoteChanges:
+		return "download"
+	case SyncStatusConflict:
+		return "conflict"
+	case SyncStatusDeleted, SyncStatusRemoteDeleted:
+		return "delete"
+	default:
+		return "unchanged"
+	}
+}
+
+// sortHookFiles orders hook files by path for stable payloads
+func sortHookFiles(files []hooks.File) []hooks.File {
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
 // syncFileByPath synchronizes a single file using relative path
 func (s *Syncer) syncFileByPath(ctx context.Context, file *storage.FileInfo, relPath string, remoteFile *repository.RemoteFileInfo) SyncResult {
 	// Check if file exists in remote
@@ -165,17 +532,26 @@ func (s *Syncer) syncFileByPath(ctx context.Context, file *storage.FileInfo, rel
 
 	if !remoteExists {
 		// File doesn't exist in remote, create it if it exists locally
-		if _, err := os.Stat(file.Path); os.IsNotExist(err) {
+		if _, err := os.Lstat(file.Path); os.IsNotExist(err) {
 			// Neither local nor remote exists - this shouldn't happen
 			return SyncResult{Path: file.Path, Status: SyncStatusSynced}
 		}
 
-		content, err := os.ReadFile(file.Path)
+		// Synced before and unchanged since: another device deleted it
+		if file.LastSyncedRemoteSHA != "" && file.Hash != "" && file.Hash == file.LastSyncedHash {
+			if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+				return SyncResult{Path: file.Path, Error: fmt.Errorf("failed to delete local file: %w", err)}
+			}
+			s.fileManager.RemoveFile(file.Path)
+			return SyncResult{Path: file.Path, Status: SyncStatusRemoteDeleted}
+		}
+
+		content, err := s.fileManager.ReadFileContent(file.Path)
 		if err != nil {
 			return SyncResult{Path: file.Path, Error: err}
 		}
 
-		if err := s.repo.CreateFile(ctx, relPath, string(content)); err != nil {
+		if err := s.uploadFile(ctx, file.Path, relPath, content, nil); err != nil {
 			return SyncResult{Path: file.Path, Error: err}
 		}
 
@@ -189,7 +565,7 @@ func (s *Syncer) syncFileByPath(ctx context.Context, file *storage.FileInfo, rel
 	}
 
 	// Check if local file exists or is marked as deleted
-	_, statErr := os.Stat(file.Path)
+	_, statErr := os.Lstat(file.Path)
 	localFileDeleted := os.IsNotExist(statErr) || file.Deleted
 
 	if localFileDeleted {
@@ -199,6 +575,9 @@ func (s *Syncer) syncFileByPath(ctx context.Context, file *storage.FileInfo, rel
 
 		if file.LastSyncedRemoteSHA != "" {
 			// File was previously synced but now deleted locally - delete from remote
+			if err := s.planAction(ActionDelete, relPath, nil, "", ""); err != nil {
+				return SyncResult{Path: file.Path, Error: err}
+			}
 			if err := s.repo.DeleteFile(ctx, relPath); err != nil {
 				return SyncResult{Path: file.Path, Error: fmt.Errorf("failed to delete remote file: %w", err)}
 			}
@@ -209,17 +588,12 @@ func (s *Syncer) syncFileByPath(ctx context.Context, file *storage.FileInfo, rel
 			return SyncResult{Path: file.Path, Status: SyncStatusDeleted}
 		} else {
 			// File was never synced locally - download from remote
-			// Create directory if it doesn't exist
-			if err := os.MkdirAll(filepath.Dir(file.Path), 0755); err != nil {
-				return SyncResult{Path: file.Path, Error: err}
-			}
-
-			if err := os.WriteFile(file.Path, []byte(remoteFile.Content), 0644); err != nil {
-				return SyncResult{Path: file.Path, Error: err}
+			if err := s.downloadFile(relPath, file, remoteFile); err != nil {
+				return s.downloadFailed(file, remoteFile, err)
 			}
 
-			// Rescan directory to pick up the newly downloaded file
-			if err := s.fileManager.ScanDirectory(); err != nil {
+			// Rescan the newly downloaded file to track it
+			if err := s.fileManager.RescanFile(file.Path); err != nil {
 				return SyncResult{Path: file.Path, Error: err}
 			}
 
@@ -232,19 +606,36 @@ func (s *Syncer) syncFileByPath(ctx context.Context, file *storage.FileInfo, rel
 		}
 	}
 
+	// Flagged by repair: wait for the user to edit or delete the file
+	if file.NeedsAttention {
+		return SyncResult{Path: file.Path, Status: SyncStatusNeedsAttention}
+	}
+
+	// Unchanged on both sides since the last sync, according to the stat
+	// cache; skip reading the content
+	if s.unchangedSinceSync(file, remoteFile) {
+		return SyncResult{Path: file.Path, Status: SyncStatusSynced}
+	}
+
 	// Get local file content
-	localContent, err := os.ReadFile(file.Path)
+	localContent, err := s.fileManager.ReadFileContent(file.Path)
 	if err != nil {
 		return SyncResult{Path: file.Path, Error: err}
 	}
 
 	// Compare content
 	if string(localContent) == remoteFile.Content {
-		// Content is the same, update sync info
+		// Content is the same, reconcile file modes
+		status, err := s.syncFileMode(ctx, file, relPath, localContent, remoteFile)
+		if err != nil {
+			return SyncResult{Path: file.Path, Error: err}
+		}
+
+		// Update sync info
 		if err := s.fileManager.UpdateSyncInfo(file.Path, remoteFile.SHA); err != nil {
 			return SyncResult{Path: file.Path, Error: err}
 		}
-		return SyncResult{Path: file.Path, Status: SyncStatusSynced}
+		return SyncResult{Path: file.Path, Status: status}
 	}
 
 	// Content is different - check if file was modified locally since last sync
@@ -259,8 +650,8 @@ func (s *Syncer) syncFileByPath(ctx context.Context, file *storage.FileInfo, rel
 	// If local file hasn't changed since last sync, just pull remote changes
 	if lastSyncedHash == currentLocalHash {
 		// Local file unchanged, remote file changed - pull remote changes
-		if err := os.WriteFile(file.Path, []byte(remoteFile.Content), 0644); err != nil {
-			return SyncResult{Path: file.Path, Error: err}
+		if err := s.downloadFile(relPath, file, remoteFile); err != nil {
+			return s.downloadFailed(file, remoteFile, err)
 		}
 
 		// Update sync info
@@ -271,18 +662,238 @@ func (s *Syncer) syncFileByPath(ctx context.Context, file *storage.FileInfo, rel
 		return SyncResult{Path: file.Path, Status: SyncStatusRemoteChanges}
 	}
 
+	// Remote file unchanged since last sync, local file changed - push the
+	// local edit. Restores take this path too, being edits of the file.
+	if file.LastSyncedRemoteSHA != "" && file.LastSyncedRemoteSHA == remoteFile.SHA {
+		if err := s.uploadFile(ctx, file.Path, relPath, localContent, remoteFile); err != nil {
+			return SyncResult{Path: file.Path, Error: err}
+		}
+		if err := s.fileManager.UpdateSyncInfo(file.Path, s.fileManager.CalculateGitSHAFromContent(localContent)); err != nil {
+			return SyncResult{Path: file.Path, Error: err}
+		}
+		return SyncResult{Path: file.Path, Status: SyncStatusLocalChanges}
+	}
+
 	// Both local and remote have changes - this is a conflict
-	if err := s.resolveConflict(ctx, file, relPath, localContent, []byte(remoteFile.Content)); err != nil {
+	if err := s.resolveConflict(ctx, file, relPath, localContent, remoteFile); err != nil {
 		return SyncResult{Path: file.Path, Status: SyncStatusConflict, Error: err}
 	}
 
 	return SyncResult{Path: file.Path, Status: SyncStatusConflict}
 }
 
+// moveFiles commits the files that were moved locally as moves, rather than
+// as the deletion of one file and the upload of another. A file counts as
+// moved when a synced file is gone while the repository still has it, and a
+// new file with the same content and mode appeared. It returns the results
+// of both paths of each move; a failed move is left to the regular sync.
+func (s *Syncer) moveFiles(ctx context.Context, allFiles map[string]*storage.FileInfo, remoteFiles map[string]*repository.RemoteFileInfo) map[string]SyncResult {
+	relPaths := make([]string, 0, len(allFiles))
+	for relPath := range allFiles {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+
+	// Synced files that are gone, by the blob SHA they were synced at
+	gone := make(map[string][]string)
+	for _, relPath := range relPaths {
+		file, remoteFile := allFiles[relPath], remoteFiles[relPath]
+		if file.LastSyncedRemoteSHA == "" || remoteFile == nil || remoteFile.SHA != file.LastSyncedRemoteSHA || !localMissing(file) {
+			continue
+		}
+		gone[file.LastSyncedRemoteSHA] = append(gone[file.LastSyncedRemoteSHA], relPath)
+	}
+	if len(gone) == 0 {
+		return nil
+	}
+
+	results := make(map[string]SyncResult)
+	for _, newPath := range relPaths {
+		file := allFiles[newPath]
+		if file.LastSyncedRemoteSHA != "" || remoteFiles[newPath] != nil || localMissing(file) {
+			continue
+		}
+
+		content, err := s.fileManager.ReadFileContent(file.Path)
+		if err != nil {
+			continue
+		}
+		candidates := gone[s.fileManager.CalculateGitSHAFromContent(content)]
+		if len(candidates) == 0 {
+			continue
+		}
+		oldPath := candidates[0]
+		oldFile, remoteFile := allFiles[oldPath], remoteFiles[oldPath]
+
+		mode, err := s.fileManager.LocalGitMode(file.Path)
+		if err != nil || (remoteFile.Mode != "" && mode != remoteFile.Mode) {
+			continue
+		}
+
+		if err := s.moveFile(ctx, oldPath, newPath, content, mode); err != nil {
+			s.abandonAction(oldPath)
+			s.abandonAction(newPath)
+			if s.logger != nil {
+				s.logger.Printf("Failed to move %s to %s, syncing them separately: %v", oldPath, newPath, err)
+			}
+			continue
+		}
+		gone[remoteFile.SHA] = candidates[1:]
+
+		s.fileManager.RemoveFile(oldFile.Path)
+		results[oldPath] = SyncResult{Path: oldFile.Path, Status: SyncStatusDeleted}
+		results[newPath] = SyncResult{Path: file.Path, Status: SyncStatusLocalChanges}
+		if err := s.fileManager.UpdateSyncInfo(file.Path, remoteFile.SHA); err != nil {
+			results[newPath] = SyncResult{Path: file.Path, Error: err}
+		}
+	}
+	return results
+}
+
+// moveFile commits the move of a synced file to a new path
+func (s *Syncer) moveFile(ctx context.Context, oldPath, newPath string, content []byte, mode string) error {
+	if err := s.planAction(ActionDelete, oldPath, nil, "", ""); err != nil {
+		return err
+	}
+	if err := s.planAction(ActionUpload, newPath, content, s.fileManager.CalculateGitSHAFromContent(content), mode); err != nil {
+		return err
+	}
+	return s.repo.MoveFile(ctx, oldPath, newPath, string(content), mode)
+}
+
+// localMissing reports whether a tracked file is gone from the disk
+func localMissing(file *storage.FileInfo) bool {
+	if file.Deleted {
+		return true
+	}
+	_, err := os.Lstat(file.Path)
+	return os.IsNotExist(err)
+}
+
+// unchangedSinceSync reports whether neither the local file nor the remote
+// file changed since they were last synced
+func (s *Syncer) unchangedSinceSync(file *storage.FileInfo, remoteFile *repository.RemoteFileInfo) bool {
+	if file.Hash == "" || file.Hash != file.LastSyncedHash || file.LastSyncedRemoteSHA != remoteFile.SHA {
+		return false
+	}
+	return remoteFile.Mode == "" || file.GitMode() == remoteFile.Mode || !s.modeSupported(file.GitMode(), remoteFile.Mode)
+}
+
+// downloadFile atomically replaces the scanned local file with the remote version.
+// The write is verified against the remote blob SHA and abandoned if the local
+// file changed since it was scanned.
+func (s *Syncer) downloadFile(relPath string, file *storage.FileInfo, remoteFile *repository.RemoteFileInfo) error {
+	if err := s.planAction(ActionDownload, relPath, []byte(remoteFile.Content), remoteFile.SHA, remoteFile.Mode); err != nil {
+		return err
+	}
+	return s.fileManager.WriteFileAtomic(file.Path, []byte(remoteFile.Content), remoteFile.Mode, remoteFile.SHA, file)
+}
+
+// downloadFailed turns a failed download into a sync result. A file edited
+// while syncing is kept as is and reported as a conflict, with the remote
+// version saved next to it.
+func (s *Syncer) downloadFailed(file *storage.FileInfo, remoteFile *repository.RemoteFileInfo, err error) SyncResult {
+	var changedErr *storage.ChangedOnDiskError
+	if !errors.As(err, &changedErr) {
+		return SyncResult{Path: file.Path, Error: err}
+	}
+
+	if _, statErr := os.Lstat(file.Path); statErr == nil {
+		// Track the edited file so its versions can be saved
+		if err := s.fileManager.RescanFile(file.Path); err != nil {
+			return SyncResult{Path: file.Path, Status: SyncStatusConflict, Error: err}
+		}
+		if err := s.fileManager.SaveConflictVersions(file.Path, remoteFile.Content); err != nil {
+			return SyncResult{Path: file.Path, Status: SyncStatusConflict, Error: err}
+		}
+	}
+
+	return SyncResult{Path: file.Path, Status: SyncStatusConflict}
+}
+
+// syncFileMode reconciles the file mode of a file whose content is identical
+// locally and remotely. A mode change on either side is propagated to the
+// other; if both changed, the local mode wins.
+func (s *Syncer) syncFileMode(ctx context.Context, file *storage.FileInfo, relPath string, content []byte, remoteFile *repository.RemoteFileInfo) (SyncStatus, error) {
+	if remoteFile.Mode == "" {
+		return SyncStatusSynced, nil
+	}
+
+	localMode, err := s.fileManager.LocalGitMode(file.Path)
+	if err != nil {
+		return SyncStatusSynced, err
+	}
+	if localMode == remoteFile.Mode || !s.modeSupported(localMode, remoteFile.Mode) {
+		return SyncStatusSynced, nil
+	}
+
+	// Remote mode unchanged since last sync (or unknown): push the local mode
+	if file.LastSyncedMode == "" || file.LastSyncedMode == remoteFile.Mode {
+		if err := s.planAction(ActionUpload, relPath, content, remoteFile.SHA, localMode); err != nil {
+			return SyncStatusSynced, err
+		}
+		if err := s.repo.PutFile(ctx, relPath, string(content), localMode); err != nil {
+			return SyncStatusSynced, err
+		}
+		return SyncStatusLocalChanges, nil
+	}
+
+	// Remote mode changed: apply it locally
+	if localMode == storage.GitModeSymlink || remoteFile.Mode == storage.GitModeSymlink {
+		if err := s.downloadFile(relPath, file, remoteFile); err != nil {
+			return SyncStatusSynced, err
+		}
+	} else {
+		if err := s.planAction(ActionDownload, relPath, content, remoteFile.SHA, remoteFile.Mode); err != nil {
+			return SyncStatusSynced, err
+		}
+		if err := s.fileManager.ApplyGitMode(file.Path, remoteFile.Mode); err != nil {
+			return SyncStatusSynced, err
+		}
+	}
+	return SyncStatusRemoteChanges, nil
+}
+
+// modeSupported reports whether a mode difference can be represented locally.
+// Windows has no executable bit, so 100644/100755 differences are ignored there.
+func (s *Syncer) modeSupported(localMode, remoteMode string) bool {
+	if runtime.GOOS != "windows" {
+		return true
+	}
+	return localMode == storage.GitModeSymlink || remoteMode == storage.GitModeSymlink
+}
+
+// uploadFile uploads local content, preserving the local git file mode.
+// Regular files use the Contents API; executables and symlinks need PutFile.
+func (s *Syncer) uploadFile(ctx context.Context, localPath, relPath string, content []byte, remoteFile *repository.RemoteFileInfo) error {
+	localMode, err := s.fileManager.LocalGitMode(localPath)
+	if err != nil {
+		return err
+	}
+
+	remoteMode := ""
+	if remoteFile != nil {
+		remoteMode = remoteFile.Mode
+	}
+
+	if err := s.planAction(ActionUpload, relPath, content, s.fileManager.CalculateGitSHAFromContent(content), localMode); err != nil {
+		return err
+	}
+
+	if localMode != storage.GitModeRegular || (remoteMode != "" && remoteMode != storage.GitModeRegular) {
+		return s.repo.PutFile(ctx, relPath, string(content), localMode)
+	}
+
+	if remoteFile == nil {
+		return s.repo.CreateFile(ctx, relPath, string(content))
+	}
+	return s.repo.UpdateFile(ctx, relPath, string(content))
+}
+
 // resolveConflict resolves a file conflict
-func (s *Syncer) resolveConflict(ctx context.Context, file *storage.FileInfo, relPath string, localContent, remoteContent []byte) error {
+func (s *Syncer) resolveConflict(ctx context.Context, file *storage.FileInfo, relPath string, localContent []byte, remoteFile *repository.RemoteFileInfo) error {
 	// For now, just use local content
-	if err := s.repo.UpdateFile(ctx, relPath, string(localContent)); err != nil {
+	if err := s.uploadFile(ctx, file.Path, relPath, localContent, remoteFile); err != nil {
 		return err
 	}
 
@@ -2,14 +2,21 @@ package sync
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
+	"github.com/itcaat/catapult/internal/config"
+	"github.com/itcaat/catapult/internal/hooks"
 	"github.com/itcaat/catapult/internal/repository"
 	"github.com/itcaat/catapult/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockRepository is a mock implementation of the repository interface
@@ -42,6 +49,16 @@ func (m *MockRepository) UpdateFile(ctx context.Context, path, content string) e
 	return args.Error(0)
 }
 
+func (m *MockRepository) PutFile(ctx context.Context, path, content, mode string) error {
+	args := m.Called(ctx, path, content, mode)
+	return args.Error(0)
+}
+
+func (m *MockRepository) MoveFile(ctx context.Context, oldPath, newPath, content, mode string) error {
+	args := m.Called(ctx, oldPath, newPath, content, mode)
+	return args.Error(0)
+}
+
 func (m *MockRepository) DeleteFile(ctx context.Context, path string) error {
 	args := m.Called(ctx, path)
 	return args.Error(0)
@@ -62,6 +79,46 @@ func (m *MockRepository) GetAllFilesWithContent(ctx context.Context) (map[string
 	return args.Get(0).(map[string]*repository.RemoteFileInfo), args.Error(1)
 }
 
+func (m *MockRepository) GetFileHistory(ctx context.Context, path string, limit int) ([]repository.FileRevision, error) {
+	args := m.Called(ctx, path, limit)
+	revisions, _ := args.Get(0).([]repository.FileRevision)
+	return revisions, args.Error(1)
+}
+
+func (m *MockRepository) GetFileAt(ctx context.Context, path, ref string) (*repository.RemoteFileInfo, error) {
+	args := m.Called(ctx, path, ref)
+	file, _ := args.Get(0).(*repository.RemoteFileInfo)
+	return file, args.Error(1)
+}
+
+func (m *MockRepository) GetFilesAt(ctx context.Context, ref string, paths []string) (map[string]*repository.RemoteFileInfo, error) {
+	args := m.Called(ctx, ref, paths)
+	files, _ := args.Get(0).(map[string]*repository.RemoteFileInfo)
+	return files, args.Error(1)
+}
+
+func (m *MockRepository) GetAllFilesAt(ctx context.Context, ref string, have map[string]string) (map[string]*repository.RemoteFileInfo, error) {
+	args := m.Called(ctx, ref, have)
+	files, _ := args.Get(0).(map[string]*repository.RemoteFileInfo)
+	return files, args.Error(1)
+}
+
+func (m *MockRepository) ResolveCommitAt(ctx context.Context, at time.Time) (string, error) {
+	args := m.Called(ctx, at)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) GetHeadSHA(ctx context.Context) (string, error) {
+	args := m.Called(ctx)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) CompareCommits(ctx context.Context, base, head string) ([]repository.FileChange, error) {
+	args := m.Called(ctx, base, head)
+	changes, _ := args.Get(0).([]repository.FileChange)
+	return changes, args.Error(1)
+}
+
 func TestSyncAll(t *testing.T) {
 	// Create temporary directory
 	tempDir, err := os.MkdirTemp("", "catapult-test-*")
@@ -81,6 +138,7 @@ func TestSyncAll(t *testing.T) {
 
 	// Create mock repository
 	mockRepo := new(MockRepository)
+	mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
 
 	// Create sync instance
 	syncer := New(mockRepo, fileManager)
@@ -88,6 +146,7 @@ func TestSyncAll(t *testing.T) {
 	t.Run("SyncNewFiles", func(t *testing.T) {
 		mockRepo.ExpectedCalls = nil
 		mockRepo.Calls = nil
+		mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
 
 		// Mock GetAllFilesWithContent to return empty map (no remote files)
 		mockRepo.On("GetAllFilesWithContent", mock.Anything).Return(map[string]*repository.RemoteFileInfo{}, nil).Once()
@@ -100,11 +159,13 @@ func TestSyncAll(t *testing.T) {
 		err := syncer.SyncAll(context.Background(), os.Stdout)
 		assert.NoError(t, err)
 		mockRepo.AssertExpectations(t)
+		assert.Equal(t, Stats{Uploaded: 2}, syncer.Stats())
 	})
 
 	t.Run("SyncRemoteFiles", func(t *testing.T) {
 		mockRepo.ExpectedCalls = nil
 		mockRepo.Calls = nil
+		mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
 
 		// Calculate Git SHA for local content to match remote
 		localGitSHA1 := fileManager.CalculateGitSHAFromContent([]byte("test content 1"))
@@ -127,7 +188,7 @@ func TestSyncAll(t *testing.T) {
 			"remote.txt": {
 				Path:    "remote.txt",
 				Content: "remote file content",
-				SHA:     "sha3",
+				SHA:     fileManager.CalculateGitSHAFromContent([]byte("remote file content")),
 				Size:    len("remote file content"),
 			},
 		}
@@ -167,6 +228,7 @@ func TestSyncAll(t *testing.T) {
 
 		mockRepo.ExpectedCalls = nil
 		mockRepo.Calls = nil
+		mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
 
 		// Mock GetAllFilesWithContent to return empty map
 		mockRepo.On("GetAllFilesWithContent", mock.Anything).Return(map[string]*repository.RemoteFileInfo{}, nil).Once()
@@ -179,6 +241,13 @@ func TestSyncAll(t *testing.T) {
 		err = errorSyncer.SyncAll(context.Background(), os.Stdout)
 		assert.NoError(t, err) // Sync continues despite errors
 		mockRepo.AssertExpectations(t)
+
+		// The failed file is reported for callers that retry it
+		lastErrors := errorSyncer.LastErrors()
+		assert.Len(t, lastErrors, 1)
+		assert.ErrorIs(t, lastErrors["error1.txt"], assert.AnError)
+		assert.Nil(t, lastErrors.Only([]string{"error2.txt"}))
+		assert.Error(t, lastErrors.Only([]string{"error1.txt", "error2.txt"}))
 	})
 }
 
@@ -198,6 +267,7 @@ func TestSyncFileByPath(t *testing.T) {
 
 	// Create mock repository
 	mockRepo := new(MockRepository)
+	mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
 
 	// Create sync instance
 	syncer := New(mockRepo, fileManager)
@@ -209,6 +279,7 @@ func TestSyncFileByPath(t *testing.T) {
 	t.Run("NewFile", func(t *testing.T) {
 		mockRepo.ExpectedCalls = nil
 		mockRepo.Calls = nil
+		mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
 
 		// Mock CreateFile
 		mockRepo.On("CreateFile", mock.Anything, "test.txt", "test content").Return(nil).Once()
@@ -226,6 +297,7 @@ func TestSyncFileByPath(t *testing.T) {
 	t.Run("RemoteOnlyFile", func(t *testing.T) {
 		mockRepo.ExpectedCalls = nil
 		mockRepo.Calls = nil
+		mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
 
 		// Create a path for non-existent local file
 		remoteOnlyFile := filepath.Join(tempDir, "remote_only.txt")
@@ -234,7 +306,7 @@ func TestSyncFileByPath(t *testing.T) {
 		remoteFileInfo := &repository.RemoteFileInfo{
 			Path:    "remote_only.txt",
 			Content: "remote content",
-			SHA:     "remotesha123",
+			SHA:     fileManager.CalculateGitSHAFromContent([]byte("remote content")),
 			Size:    len("remote content"),
 		}
 
@@ -256,6 +328,7 @@ func TestSyncFileByPath(t *testing.T) {
 	t.Run("ExistingFileNoChanges", func(t *testing.T) {
 		mockRepo.ExpectedCalls = nil
 		mockRepo.Calls = nil
+		mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
 
 		// Calculate Git SHA for test content
 		localGitSHA := fileManager.CalculateGitSHAFromContent([]byte("test content"))
@@ -281,6 +354,7 @@ func TestSyncFileByPath(t *testing.T) {
 	t.Run("FileReadError", func(t *testing.T) {
 		mockRepo.ExpectedCalls = nil
 		mockRepo.Calls = nil
+		mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
 
 		// Create a file that exists but will cause read error
 		// We'll create a directory with the same name as the file to cause read error
@@ -297,3 +371,381 @@ func TestSyncFileByPath(t *testing.T) {
 		mockRepo.AssertExpectations(t)
 	})
 }
+
+func TestSyncAllPreSyncHookAborts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script hooks are not supported on Windows")
+	}
+
+	tempDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(tempDir, "test.txt"), []byte("test content"), 0644)
+	assert.NoError(t, err)
+
+	hookDir := t.TempDir()
+	hookPath := filepath.Join(hookDir, "pre-sync.sh")
+	err = os.WriteFile(hookPath, []byte("#!/bin/sh\nexit 1\n"), 0755)
+	assert.NoError(t, err)
+
+	fileManager := storage.NewFileManager(tempDir)
+	mockRepo := new(MockRepository)
+	mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
+	syncer := New(mockRepo, fileManager)
+	syncer.SetHooks(hooks.NewRunner(&config.HookConfig{PreSync: hookPath}, tempDir, nil))
+
+	err = syncer.SyncAll(context.Background(), io.Discard)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "pre-sync hook failed")
+
+	// No repository calls should have been made
+	mockRepo.AssertNotCalled(t, "GetAllFilesWithContent", mock.Anything)
+	mockRepo.AssertNotCalled(t, "CreateFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSyncFileModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes and symlinks are not supported on Windows")
+	}
+
+	tempDir := t.TempDir()
+	script := filepath.Join(tempDir, "run.sh")
+	err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0755)
+	assert.NoError(t, err)
+
+	fileManager := storage.NewFileManager(tempDir)
+	assert.NoError(t, fileManager.ScanDirectory())
+
+	mockRepo := new(MockRepository)
+	mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
+	syncer := New(mockRepo, fileManager)
+
+	t.Run("UploadExecutable", func(t *testing.T) {
+		mockRepo.On("PutFile", mock.Anything, "run.sh", "#!/bin/sh\n", storage.GitModeExecutable).Return(nil).Once()
+
+		result := syncer.syncFileByPath(context.Background(), &storage.FileInfo{Path: script}, "run.sh", nil)
+		assert.NoError(t, result.Error)
+		assert.Equal(t, SyncStatusLocalChanges, result.Status)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("DownloadSymlink", func(t *testing.T) {
+		linkPath := filepath.Join(tempDir, "latest")
+		remoteFile := &repository.RemoteFileInfo{
+			Path:    "latest",
+			Content: "run.sh",
+			SHA:     fileManager.CalculateGitSHAFromContent([]byte("run.sh")),
+			Mode:    storage.GitModeSymlink,
+		}
+
+		result := syncer.syncFileByPath(context.Background(), &storage.FileInfo{Path: linkPath}, "latest", remoteFile)
+		assert.NoError(t, result.Error)
+		assert.Equal(t, SyncStatusRemoteChanges, result.Status)
+
+		target, err := os.Readlink(linkPath)
+		assert.NoError(t, err)
+		assert.Equal(t, "run.sh", target)
+	})
+
+	t.Run("RemoteModeChange", func(t *testing.T) {
+		info, err := fileManager.GetFileInfo(script)
+		assert.NoError(t, err)
+
+		// Remote turned the executable into a regular file
+		remoteFile := &repository.RemoteFileInfo{
+			Path:    "run.sh",
+			Content: "#!/bin/sh\n",
+			SHA:     fileManager.CalculateGitSHAFromContent([]byte("#!/bin/sh\n")),
+			Mode:    storage.GitModeRegular,
+		}
+		file := *info
+		file.LastSyncedMode = storage.GitModeExecutable
+
+		result := syncer.syncFileByPath(context.Background(), &file, "run.sh", remoteFile)
+		assert.NoError(t, result.Error)
+		assert.Equal(t, SyncStatusRemoteChanges, result.Status)
+
+		stat, err := os.Stat(script)
+		assert.NoError(t, err)
+		assert.Equal(t, storage.GitModeRegular, storage.GitModeFromFileMode(stat.Mode()))
+	})
+}
+
+func TestSyncAllPreservesModTimes(t *testing.T) {
+	tempDir := t.TempDir()
+	localFile := filepath.Join(tempDir, "local.txt")
+	err := os.WriteFile(localFile, []byte("local content"), 0644)
+	assert.NoError(t, err)
+
+	localMTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(localFile, localMTime, localMTime))
+
+	remoteMTime := time.Date(2019, 6, 7, 8, 9, 10, 0, time.UTC)
+	manifest := `{"version": 1, "files": {"remote.txt": {"mtime": "` + remoteMTime.Format(time.RFC3339) + `"}}}`
+
+	fileManager := storage.NewFileManager(tempDir)
+	mockRepo := new(MockRepository)
+	mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
+	syncer := New(mockRepo, fileManager)
+	syncer.SetPreserveTimes(true, false)
+
+	remoteFiles := map[string]*repository.RemoteFileInfo{
+		"remote.txt": {
+			Path:    "remote.txt",
+			Content: "remote content",
+			SHA:     fileManager.CalculateGitSHAFromContent([]byte("remote content")),
+		},
+		TimesManifestPath: {
+			Path:    TimesManifestPath,
+			Content: manifest,
+			SHA:     "manifestsha",
+		},
+	}
+	mockRepo.On("GetAllFilesWithContent", mock.Anything).Return(remoteFiles, nil).Once()
+	mockRepo.On("CreateFile", mock.Anything, "local.txt", "local content").Return(nil).Once()
+
+	var savedManifest string
+	mockRepo.On("UpdateFile", mock.Anything, TimesManifestPath, mock.Anything).Run(func(args mock.Arguments) {
+		savedManifest = args.String(2)
+	}).Return(nil).Once()
+
+	err = syncer.SyncAll(context.Background(), io.Discard)
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+
+	// The manifest itself must not be downloaded as a file
+	_, err = os.Stat(filepath.Join(tempDir, storage.MetadataDir, "times.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Downloaded file gets its original modification time back
+	info, err := os.Stat(filepath.Join(tempDir, "remote.txt"))
+	assert.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(remoteMTime))
+
+	// Restored time must not look like a local edit
+	changed, err := fileManager.HasChanges(filepath.Join(tempDir, "remote.txt"))
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// Uploaded file's time is recorded in the manifest
+	var saved TimesManifest
+	assert.NoError(t, json.Unmarshal([]byte(savedManifest), &saved))
+	assert.True(t, saved.Files["local.txt"].ModTime.Equal(localMTime))
+	assert.True(t, saved.Files["remote.txt"].ModTime.Equal(remoteMTime))
+}
+
+// syncedFileManager creates a file manager whose files are all in sync with remoteFiles
+func syncedFileManager(t *testing.T, dir string, remoteFiles map[string]*repository.RemoteFileInfo) *storage.FileManager {
+	fileManager := storage.NewFileManager(dir)
+	for relPath, remoteFile := range remoteFiles {
+		err := os.WriteFile(filepath.Join(dir, relPath), []byte(remoteFile.Content), 0644)
+		assert.NoError(t, err)
+		remoteFile.SHA = fileManager.CalculateGitSHAFromContent([]byte(remoteFile.Content))
+	}
+	assert.NoError(t, fileManager.ScanDirectory())
+	for relPath, remoteFile := range remoteFiles {
+		assert.NoError(t, fileManager.UpdateSyncInfo(filepath.Join(dir, relPath), remoteFile.SHA))
+	}
+	return fileManager
+}
+
+func TestRestoreFile(t *testing.T) {
+	tempDir := t.TempDir()
+	remoteFiles := map[string]*repository.RemoteFileInfo{
+		"notes.txt": {Path: "notes.txt", Content: "version 2"},
+	}
+	fileManager := syncedFileManager(t, tempDir, remoteFiles)
+
+	mockRepo := new(MockRepository)
+	mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
+	syncer := New(mockRepo, fileManager)
+
+	mockRepo.On("GetAllFilesWithContent", mock.Anything).Return(remoteFiles, nil)
+	mockRepo.On("GetFileAt", mock.Anything, "notes.txt", "abc1234").Return(&repository.RemoteFileInfo{
+		Path:    "notes.txt",
+		Content: "version 1",
+		Mode:    storage.GitModeRegular,
+	}, nil).Once()
+	// The old version is uploaded as a new commit
+	mockRepo.On("UpdateFile", mock.Anything, "notes.txt", "version 1").Return(nil).Once()
+
+	err := syncer.RestoreFile(context.Background(), "notes.txt", "abc1234", io.Discard)
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	// Restoring is a local edit, not a conflict
+	assert.Equal(t, Stats{Uploaded: 1}, syncer.Stats())
+
+	content, err := os.ReadFile(filepath.Join(tempDir, "notes.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "version 1", string(content))
+
+	t.Run("MissingAtRef", func(t *testing.T) {
+		mockRepo.On("GetFileAt", mock.Anything, "later.txt", "abc1234").Return(nil, nil).Once()
+
+		err := syncer.RestoreFile(context.Background(), "later.txt", "abc1234", io.Discard)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "did not exist")
+	})
+}
+
+func TestRestoreAll(t *testing.T) {
+	tempDir := t.TempDir()
+	remoteFiles := map[string]*repository.RemoteFileInfo{
+		"keep.txt": {Path: "keep.txt", Content: "version 2"},
+		"new.txt":  {Path: "new.txt", Content: "created later"},
+		"same.txt": {Path: "same.txt", Content: "unchanged"},
+	}
+	fileManager := syncedFileManager(t, tempDir, remoteFiles)
+
+	sha := func(content string) string {
+		return fileManager.CalculateGitSHAFromContent([]byte(content))
+	}
+	// Files matching the local content are listed without it
+	oldFiles := map[string]*repository.RemoteFileInfo{
+		"keep.txt": {Path: "keep.txt", Content: "version 1", SHA: sha("version 1"), Mode: storage.GitModeRegular},
+		"gone.txt": {Path: "gone.txt", Content: "deleted later", SHA: sha("deleted later"), Mode: storage.GitModeRegular},
+		"same.txt": {Path: "same.txt", SHA: sha("unchanged"), Mode: storage.GitModeRegular},
+	}
+
+	mockRepo := new(MockRepository)
+	mockRepo.On("GetHeadSHA", mock.Anything).Return("head", nil).Maybe()
+	syncer := New(mockRepo, fileManager)
+
+	have := map[string]string{"keep.txt": sha("version 2"), "new.txt": sha("created later"), "same.txt": sha("unchanged")}
+	mockRepo.On("GetAllFilesWithContent", mock.Anything).Return(remoteFiles, nil)
+	mockRepo.On("GetAllFilesAt", mock.Anything, "abc1234", have).Return(oldFiles, nil).Once()
+	mockRepo.On("UpdateFile", mock.Anything, "keep.txt", "version 1").Return(nil).Once()
+	mockRepo.On("CreateFile", mock.Anything, "gone.txt", "deleted later").Return(nil).Once()
+	mockRepo.On("DeleteFile", mock.Anything, "new.txt").Return(nil).Once()
+
+	err := syncer.RestoreAll(context.Background(), "abc1234", io.Discard)
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	assert.Equal(t, Stats{Uploaded: 2, Deleted: 1}, syncer.Stats())
+
+	_, err = os.Stat(filepath.Join(tempDir, "new.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	content, err := os.ReadFile(filepath.Join(tempDir, "gone.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "deleted later", string(content))
+
+	content, err = os.ReadFile(filepath.Join(tempDir, "same.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "unchanged", string(content))
+}
+
+func TestSyncFileByPath_ChangedWhileSyncing(t *testing.T) {
+	tempDir := t.TempDir()
+	fileManager := storage.NewFileManager(tempDir)
+	path := filepath.Join(tempDir, "notes.txt")
+
+	// Scanned as missing, but recreated before the download is written
+	file := &storage.FileInfo{Path: path, Deleted: true}
+	assert.NoError(t, os.WriteFile(path, []byte("created while syncing"), 0644))
+
+	remoteFile := &repository.RemoteFileInfo{
+		Path:    "notes.txt",
+		Content: "remote edit",
+		SHA:     fileManager.CalculateGitSHAFromContent([]byte("remote edit")),
+	}
+
+	syncer := New(new(MockRepository), fileManager)
+	result := syncer.syncFileByPath(context.Background(), file, "notes.txt", remoteFile)
+	assert.NoError(t, result.Error)
+	assert.Equal(t, SyncStatusConflict, result.Status)
+
+	// The local file is kept and the remote version saved for merging
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "created while syncing", string(content))
+
+	saved, err := os.ReadFile(filepath.Join(tempDir, storage.MetadataDir, "conflicts", "notes.txt.remote"))
+	assert.NoError(t, err)
+	assert.Equal(t, "remote edit", string(saved))
+}
+
+func TestSyncFiles_RescansOnlyGivenPaths(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644))
+
+	repo := newFaultyRepository()
+	syncer := New(repo, storage.NewFileManager(dir))
+	require.NoError(t, syncer.SyncAll(context.Background(), io.Discard))
+
+	// Both files change, but only one is reported
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a2"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b2"), 0644))
+	require.NoError(t, syncer.SyncFiles(context.Background(), []string{"a.txt"}, io.Discard))
+
+	assert.Equal(t, "a2", repo.files["a.txt"].Content)
+	assert.Equal(t, "b", repo.files["b.txt"].Content)
+
+	// A full sync picks up the rest
+	require.NoError(t, syncer.SyncAll(context.Background(), io.Discard))
+	assert.Equal(t, "b2", repo.files["b.txt"].Content)
+}
+
+func TestSyncAll_RecordsRemoteManifest(t *testing.T) {
+	dir := t.TempDir()
+	repo := newFaultyRepository()
+	repo.put("remote.txt", "remote", storage.GitModeRegular)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "local.txt"), []byte("local"), 0644))
+
+	fileManager := storage.NewFileManager(dir)
+	syncer := New(repo, fileManager)
+	require.NoError(t, syncer.SyncAll(context.Background(), io.Discard))
+
+	// The manifest includes this sync's own uploads and the head after them
+	manifest := fileManager.RemoteManifest()
+	require.NotNil(t, manifest)
+	assert.Equal(t, "commit-1", manifest.CommitSHA)
+	for path, file := range repo.files {
+		sha, ok := manifest.SHA(path)
+		assert.True(t, ok, path)
+		assert.Equal(t, file.SHA, sha, path)
+	}
+
+	status, err := fileManager.GetSyncStatus(filepath.Join(dir, "local.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, storage.SyncStatusSynced, status)
+
+	// Another device changes the file
+	repo.put("local.txt", "edited elsewhere", storage.GitModeRegular)
+	fileManager.SetRemoteManifest(newRemoteManifest("commit-2", repo.files))
+	status, err = fileManager.GetSyncStatus(filepath.Join(dir, "local.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, storage.SyncStatusRemoteChanges, status)
+}
+
+func TestSyncFiles_CommitsRenameAsMove(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "docs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "draft.txt"), []byte("draft"), 0644))
+
+	repo := newFaultyRepository()
+	fileManager := storage.NewFileManager(dir)
+	syncer := New(repo, fileManager)
+	require.NoError(t, syncer.SyncAll(context.Background(), io.Discard))
+
+	// One file is only moved, the other is also edited
+	require.NoError(t, os.Rename(filepath.Join(dir, "notes.txt"), filepath.Join(dir, "docs", "notes.txt")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "draft.txt"), filepath.Join(dir, "final.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "final.txt"), []byte("final"), 0644))
+	mutations := len(repo.mutations)
+
+	movedPath := filepath.Join("docs", "notes.txt")
+	require.NoError(t, syncer.SyncFiles(context.Background(), []string{"notes.txt", movedPath, "draft.txt", "final.txt"}, io.Discard))
+
+	assert.ElementsMatch(t, []string{"move " + movedPath, "delete draft.txt", "create final.txt"}, repo.mutations[mutations:])
+	assert.NotContains(t, repo.files, "notes.txt")
+	require.Contains(t, repo.files, movedPath)
+	assert.Equal(t, "notes", repo.files[movedPath].Content)
+	assert.Equal(t, Stats{Uploaded: 4, Deleted: 2}, syncer.Stats())
+
+	_, err := fileManager.GetFileInfo(filepath.Join(dir, "notes.txt"))
+	assert.Error(t, err, "the old path is no longer tracked")
+	status, err := fileManager.GetSyncStatus(filepath.Join(dir, movedPath))
+	require.NoError(t, err)
+	assert.Equal(t, storage.SyncStatusSynced, status)
+}
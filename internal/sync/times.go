@@ -0,0 +1,150 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/itcaat/catapult/internal/repository"
+	"github.com/itcaat/catapult/internal/storage"
+)
+
+// TimesManifestPath is the repository path of the file times manifest
+const TimesManifestPath = storage.MetadataDir + "/times.json"
+
+// FileTimes holds the original times of a synced file
+type FileTimes struct {
+	ModTime    time.Time `json:"mtime"`
+	ChangeTime time.Time `json:"ctime,omitempty"`
+}
+
+// TimesManifest records original file times so they survive syncing between devices
+type TimesManifest struct {
+	Version int                  `json:"version"`
+	Files   map[string]FileTimes `json:"files"`
+
+	raw     string // Content as fetched from the repository
+	exists  bool
+	changed bool
+}
+
+// newTimesManifest parses the manifest from its remote file, if any
+func newTimesManifest(remoteFile *repository.RemoteFileInfo) (*TimesManifest, error) {
+	manifest := &TimesManifest{Version: 1, Files: make(map[string]FileTimes)}
+	if remoteFile == nil {
+		return manifest, nil
+	}
+
+	manifest.exists = true
+	manifest.raw = remoteFile.Content
+	if err := json.Unmarshal([]byte(remoteFile.Content), manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse times manifest: %w", err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]FileTimes)
+	}
+	return manifest, nil
+}
+
+// Get returns the recorded times for a file
+func (m *TimesManifest) Get(relPath string) (FileTimes, bool) {
+	times, ok := m.Files[filepath.ToSlash(relPath)]
+	return times, ok
+}
+
+// Set records the times for a file
+func (m *TimesManifest) Set(relPath string, times FileTimes) {
+	key := filepath.ToSlash(relPath)
+	if existing, ok := m.Files[key]; ok && existing.ModTime.Equal(times.ModTime) && existing.ChangeTime.Equal(times.ChangeTime) {
+		return
+	}
+	m.Files[key] = times
+	m.changed = true
+}
+
+// Remove forgets the times for a file
+func (m *TimesManifest) Remove(relPath string) {
+	key := filepath.ToSlash(relPath)
+	if _, ok := m.Files[key]; ok {
+		delete(m.Files, key)
+		m.changed = true
+	}
+}
+
+// isMetadataPath reports whether a repository path belongs to catapult's metadata
+func isMetadataPath(relPath string) bool {
+	first := strings.SplitN(path.Clean(filepath.ToSlash(relPath)), "/", 2)[0]
+	return first == storage.MetadataDir
+}
+
+// SetPreserveTimes enables recording and restoring file times through the
+// times manifest. Change times can only be recorded, not restored.
+func (s *Syncer) SetPreserveTimes(mtime, ctime bool) {
+	s.preserveMTime = mtime
+	s.recordCTime = mtime && ctime
+}
+
+// recordTimes stores the current local times of an uploaded file
+func (s *Syncer) recordTimes(localPath, relPath string) {
+	if s.times == nil {
+		return
+	}
+
+	mtime, ctime, err := s.fileManager.FileTimes(localPath)
+	if err != nil {
+		return
+	}
+
+	times := FileTimes{ModTime: mtime.UTC()}
+	if s.recordCTime && !ctime.IsZero() {
+		times.ChangeTime = ctime.UTC()
+	}
+	s.times.Set(relPath, times)
+}
+
+// restoreTimes applies the recorded modification time to a downloaded file
+func (s *Syncer) restoreTimes(localPath, relPath string) error {
+	if s.times == nil {
+		return nil
+	}
+
+	times, ok := s.times.Get(relPath)
+	if !ok || times.ModTime.IsZero() {
+		return nil
+	}
+	return s.fileManager.RestoreModTime(localPath, times.ModTime)
+}
+
+// saveTimesManifest uploads the times manifest if it changed during the sync
+func (s *Syncer) saveTimesManifest(ctx context.Context) error {
+	if s.times == nil || !s.times.changed {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.times, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode times manifest: %w", err)
+	}
+	content := string(data) + "\n"
+	if content == s.times.raw {
+		return nil
+	}
+
+	if s.times.exists {
+		err = s.repo.UpdateFile(ctx, TimesManifestPath, content)
+	} else {
+		err = s.repo.CreateFile(ctx, TimesManifestPath, content)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save times manifest: %w", err)
+	}
+
+	s.times.raw = content
+	s.times.exists = true
+	s.times.changed = false
+	return nil
+}